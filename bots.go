@@ -19,7 +19,11 @@ const (
 	buypack    string = "buyNewPack"
 	battle     string = "battle"
 	usecard    string = "useCard"
+	endturn    string = "endTurn"
 	giveup     string = "giveUp"
+	mulligan   string = "mulligan"
+	react      string = "react"
+	rematch    string = "rematch"
 	ping       string = "ping"
 	registered string = "registered"
 	loggedin   string = "loggedIn"
@@ -34,6 +38,15 @@ const (
 	newvictory string = "newVictory"
 	newtie     string = "newTie"
 	pong       string = "pong"
+
+	mulliganresult string = "mulliganResult"
+	reactionwindow string = "reactionWindow"
+	reactionclosed string = "reactionClosed"
+	gameevent      string = "gameEvent"
+	rematchoffer   string = "rematchOffer"
+	rematchclosed  string = "rematchClosed"
+
+	reacao CardType = "reacao" // carta de reação
 )
 
 type CardType string
@@ -60,6 +73,7 @@ type Card struct {
 	CardRarity CardRarity `json:"cardrarity"`
 	CardEffect CardEffect `json:"cardeffect"`
 	Points     int        `json:"points"`
+	Instance   string     `json:"instance,omitempty"` // cópia da carta na partida
 }
 
 type MatchInfo struct {
@@ -174,6 +188,7 @@ func (b *BotClient) handleResponse(msg Message) {
 	case gamestart:
 		var payload struct {
 			Info        string
+			Ruleset     struct{ Mulligan bool }
 			Turn        string
 			Hand        []Card
 			Sanity      map[string]int
@@ -190,7 +205,10 @@ func (b *BotClient) handleResponse(msg Message) {
 			b.hand[i] = &payload.Hand[i]
 		}
 		b.logInfo("Partida encontrada contra %s! Começando a batalha...", b.matchInfo.OpponentUsername)
-		if b.matchInfo.CurrentTurnUID == b.uid {
+		if payload.Ruleset.Mulligan {
+			// o turno só começa depois do mulligan
+			b.mulligan()
+		} else if b.matchInfo.CurrentTurnUID == b.uid {
 			b.logInfo("É o nosso turno! Vamo jogar!")
 			b.turnSignal <- struct{}{}
 		} else {
@@ -208,6 +226,38 @@ func (b *BotClient) handleResponse(msg Message) {
 		} else {
 			b.logInfo("Turno do oponente, aguardando...")
 		}
+	case reactionwindow:
+		// reage com a primeira reação da mão (sem nenhuma, card vazio passa)
+		cid := ""
+		for _, card := range b.hand {
+			if card.CardType == reacao {
+				cid = card.Instance
+				break
+			}
+		}
+		b.send(react, map[string]string{"UID": b.uid, "card": cid})
+	case reactionclosed:
+	case mulliganresult:
+		var payload struct {
+			Hand     []Card
+			Returned int
+		}
+		json.Unmarshal(msg.Data, &payload)
+		b.hand = make([]*Card, len(payload.Hand))
+		for i := range payload.Hand {
+			b.hand[i] = &payload.Hand[i]
+		}
+		b.logInfo("Mulligan feito, trocamos %d carta(s).", payload.Returned)
+	case cardused:
+		var payload struct {
+			Player       string
+			Card         Card
+			SanityDeltas map[string]int
+		}
+		json.Unmarshal(msg.Data, &payload)
+		// b.logInfo("%s jogou %s: %v", payload.Player, payload.Card.Name, payload.SanityDeltas) // tirei por info dump
+	case gameevent:
+		// os eventos avulsos (estados, compras...) já chegam resumidos no updateInfo
 	case notify:
 		var payload struct {
 			Message string
@@ -220,21 +270,31 @@ func (b *BotClient) handleResponse(msg Message) {
 			Sanity      map[string]int
 			DreamStates map[string]DreamState
 			Round       int
+			Hand        []Card
 		}
 		json.Unmarshal(msg.Data, &payload)
 		b.matchInfo.Sanity = payload.Sanity
 		b.matchInfo.DreamStates = payload.DreamStates
 		b.matchInfo.Round = payload.Round
+		// a mão do servidor já vem com a carta comprada no turno
+		b.hand = make([]*Card, len(payload.Hand))
+		for i := range payload.Hand {
+			b.hand[i] = &payload.Hand[i]
+		}
 		b.logInfo("Estado atualizado. Nossa sanidade: %d, Sanidade do oponente: %d", b.matchInfo.Sanity[b.uid], b.matchInfo.Sanity[b.getOpponentUID()])
 	case newvictory:
 		b.inBattle = false
-		b.logInfo("Vitória! Desconectando")
+		b.logInfo("Vitória! Desconectando (%s)", b.summary(msg.Data))
 	case newloss:
 		b.inBattle = false
-		b.logInfo("Derrota. Desconectando")
+		b.logInfo("Derrota. Desconectando (%s)", b.summary(msg.Data))
 	case newtie:
 		b.inBattle = false
-		b.logInfo("Empate. Desconectando")
+		b.logInfo("Empate. Desconectando (%s)", b.summary(msg.Data))
+	case rematchoffer:
+		// bot não pede revanche
+		b.send(rematch, map[string]interface{}{"UID": b.uid, "accept": false})
+	case rematchclosed:
 	default:
 		var errPayload struct {
 			Error string `json:"error"`
@@ -283,6 +343,21 @@ func (b *BotClient) buyPack() {
 	b.send(buypack, map[string]string{"UID": b.uid})
 }
 
+// summary resume o fim da partida numa linha pro log
+func (b *BotClient) summary(data json.RawMessage) string {
+	var payload struct {
+		Reason  string
+		Rounds  int
+		Players map[string]struct {
+			Rating       int
+			RatingChange int
+		}
+	}
+	json.Unmarshal(data, &payload)
+	me := payload.Players[b.uid]
+	return fmt.Sprintf("%s em %d rodadas, rating %d (%+d)", payload.Reason, payload.Rounds, me.Rating, me.RatingChange)
+}
+
 // enqueue entra na fila de matchmaking
 func (b *BotClient) enqueue() {
 	b.logInfo("Entrando na fila de batalha...")
@@ -291,17 +366,37 @@ func (b *BotClient) enqueue() {
 
 // playCard joga uma carta da mão
 func (b *BotClient) playCard() {
-	if len(b.hand) == 0 {
-		b.logInfo("Mão vazia, sem cartas para jogar...")
-		b.giveUp()
+	// reação só vale no turno do oponente
+	index := -1
+	for i, card := range b.hand {
+		if card.CardType != reacao {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		b.logInfo("Sem carta para jogar, passando a vez...")
+		b.send(endturn, nil)
 		return
 	}
-	cardToPlay := b.hand[0]
+
+	cardToPlay := b.hand[index]
 	// b.logInfo("Jogando a carta %s...", cardToPlay.Name) // tirei por ser info dump
 	b.send(usecard, map[string]Card{"card": *cardToPlay})
 
 	// Remove a carta da mão localmente pra não confundir o bot
-	b.hand = b.hand[1:]
+	b.hand = append(b.hand[:index], b.hand[index+1:]...)
+}
+
+// mulligan devolve as cartas de 0 pontos da mão inicial
+func (b *BotClient) mulligan() {
+	cids := []string{}
+	for _, card := range b.hand {
+		if card.Points == 0 {
+			cids = append(cids, card.Instance)
+		}
+	}
+	b.send(mulligan, map[string]interface{}{"UID": b.uid, "cards": cids})
 }
 
 // giveUp desiste da partida
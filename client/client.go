@@ -5,10 +5,13 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,11 +30,36 @@ var (
 
 	// dados do jogo
 	inventory  []*Card
+	cardSets   map[string]CardSet
 	invMu      sync.RWMutex
+	invSignal  chan struct{}
 	hand       []*Card
 	matchInfo  *MatchInfo
 	inBattle   bool
 	turnSignal chan struct{}
+	// sinal para escolher o mulligan no começo da partida
+	mulliganSignal chan struct{}
+	// sinal e dados da janela de reação aberta
+	reactionSignal chan struct{}
+	reactionWindow ReactionWindow
+	// últimos replays recebidos e sinal de que a lista chegou
+	replays      []ReplayInfo
+	replaySignal chan struct{}
+	// assistindo uma partida dos outros (as mensagens da partida vão para handleSpectatorMessage)
+	spectating     bool
+	spectateSignal chan bool
+	// desafios recebidos esperando resposta
+	challenges   []ChallengeInfo
+	challengesMu sync.Mutex
+	// revanche oferecida no fim da partida: o sinal chega com a oferta e
+	// rematchDone avisa se a revanche começou (true) ou foi fechada (false)
+	rematchOpen   bool
+	rematchSignal chan struct{}
+	rematchDone   chan bool
+	lastSummary   json.RawMessage // reimpresso com a oferta (cada mensagem limpa a tela)
+	// fila em que o jogador espera (vazio = fora da fila)
+	queuedRuleset string
+	queuedQueue   string
 
 	// Novo mutex para dados da partida
 	matchMu sync.RWMutex
@@ -41,13 +69,29 @@ const (
 	register   string = "register"
 	login      string = "login"
 	buypack    string = "buyNewPack"
+	getinv     string = "getInventory"
 	battle     string = "battle"
 	usecard    string = "useCard"
 	giveup     string = "giveUp"
+	mulligan   string = "mulligan"
+	react      string = "react"
+	endturn    string = "endTurn"
+	getreplay  string = "getReplay"
+	spectate   string = "spectate"
+	leavespec  string = "leaveSpectate"
+	challenge  string = "challenge"
+	answerch   string = "answerChallenge"
+	newlobby   string = "createLobby"
+	joinlobby  string = "joinLobby"
+	endlobby   string = "closeLobby"
+	rematch    string = "rematch"
+	leavequeue string = "leaveQueue"
+	practice   string = "practice"
 	ping       string = "ping"
 	registered string = "registered"
 	loggedin   string = "loggedIn"
 	packbought string = "packBought"
+	inventoryr string = "inventory"
 	enqueued   string = "enqueued"
 	gamestart  string = "gameStart"
 	cardused   string = "cardUsed"
@@ -58,6 +102,28 @@ const (
 	newvictory string = "newVictory"
 	newtie     string = "newTie"
 	pong       string = "pong"
+
+	mulliganresult string = "mulliganResult"
+	reactionwindow string = "reactionWindow"
+	reactionclosed string = "reactionClosed"
+	gameevent      string = "gameEvent"
+	replaylist     string = "replayList"
+	replayfile     string = "replay"
+	spectatingr    string = "spectating"
+	spectateleft   string = "spectateLeft"
+	matchended     string = "matchEnded"
+	challengesent  string = "challengeSent"
+	challengerecv  string = "challengeReceived"
+	challengeclose string = "challengeClosed"
+	lobbycreated   string = "lobbyCreated"
+	lobbyclosed    string = "lobbyClosed"
+	lobbyjoined    string = "lobbyJoined"
+	rematchoffer   string = "rematchOffer"
+	rematchaccept  string = "rematchAccepted"
+	rematchclosed  string = "rematchClosed"
+	seriesended    string = "seriesEnded"
+	queuestatus    string = "queueStatus"
+	queueleft      string = "queueLeft"
 )
 
 type CardType string
@@ -66,6 +132,8 @@ const (
 	REM  CardType = "rem"
 	NREM CardType = "nrem"
 	Pill CardType = "pill"
+
+	Reaction CardType = "reacao" // só na janela de reação, no turno do oponente
 )
 
 type CardRarity string
@@ -115,13 +183,204 @@ type Card struct {
 	CardRarity CardRarity `json:"cardrarity"`
 	CardEffect CardEffect `json:"cardeffect"`
 	Points     int        `json:"points"`
+	Cost       int        `json:"cost,omitempty"` // lucidez para jogar
+	Set        string     `json:"set,omitempty"`
+	Instance   string     `json:"instance,omitempty"` // cópia da carta na partida
+}
+
+// metadados de uma coleção de cartas
+type CardSet struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	ReleaseDate string `json:"releaseDate"`
+}
+
+// regras da partida (vêm no gameStart)
+type Ruleset struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	StartingSanity  int    `json:"startingSanity"`
+	HandSize        int    `json:"handSize"`
+	SleepyDrain     int    `json:"sleepyDrain"`
+	ConsciousRegen  int    `json:"consciousRegen"`
+	ScaredDrain     int    `json:"scaredDrain"`
+	ConsciousRounds int    `json:"consciousRounds"`
+	ParalyzedRounds int    `json:"paralyzedRounds"`
+	ScaredRounds    int    `json:"scaredRounds"`
+	DrawPerTurn     int    `json:"drawPerTurn"`
+	Mulligan        bool   `json:"mulligan"`
+	TurnTimeout     int    `json:"turnTimeout"`
+	MulliganTimeout int    `json:"mulliganTimeout"`
+
+	Compensation Compensation             `json:"compensation"`
+	StateLocks   map[DreamState]StateLock `json:"stateLocks"`
+	Lucidity     *Lucidity                `json:"lucidity"` // nil = uma carta por turno, sem custo
+}
+
+// lucidez: enche a cada turno, com máximo começando em Starting e crescendo Growth até Max
+type Lucidity struct {
+	Starting int `json:"starting"`
+	Growth   int `json:"growth"`
+	Max      int `json:"max"`
+}
+
+// o que ganha quem não começa a partida
+type Compensation struct {
+	Sanity    int  `json:"sanity"`
+	Cards     int  `json:"cards"`
+	Conscious bool `json:"conscious"`
+}
+
+// estados que não pegam enquanto o jogador está num estado (e por Rounds depois)
+type StateLock struct {
+	States []DreamState `json:"states"`
+	Rounds int          `json:"rounds"`
+}
+
+// carta do oponente esperando a nossa reação
+type ReactionWindow struct {
+	Card    Card   `json:"card"`
+	From    string `json:"from"`
+	Timeout int    `json:"timeout"`
+}
+
+// evento da partida (gameEvent, ou dentro do cardUsed)
+type GameEvent struct {
+	Type   string     `json:"type"`
+	Round  int        `json:"round"`
+	Player string     `json:"player"`
+	Target string     `json:"target"`
+	Card   *Card      `json:"card"`
+	State  DreamState `json:"state"`
+	Amount int        `json:"amount"`
+	Reason string     `json:"reason"`
+}
+
+// carta resolvida e tudo o que ela causou
+type CardUsed struct {
+	Player       string         `json:"player"`
+	Card         Card           `json:"card"`
+	Target       string         `json:"target"`
+	Reaction     bool           `json:"reaction"`
+	SanityDeltas map[string]int `json:"sanityDeltas"`
+	StateChanges []struct {
+		Player string     `json:"player"`
+		State  DreamState `json:"state"`
+	} `json:"stateChanges"`
+	Events []GameEvent `json:"events"`
+	Round  int         `json:"round"`
+}
+
+// resumo do fim da partida (vem no newVictory/newLoss/newTie)
+type MatchSummary struct {
+	Reason  string                   `json:"reason"`
+	Winners []string                 `json:"winners"`
+	Rounds  int                      `json:"rounds"`
+	Ruleset string                   `json:"ruleset"`
+	Replay  string                   `json:"replay"`
+	Series  *Series                  `json:"series"`
+	Players map[string]PlayerSummary `json:"players"`
+}
+
+type Series struct {
+	ID            int            `json:"id"`
+	BestOf        int            `json:"bestOf"`
+	Games         int            `json:"games"`
+	Wins          map[string]int `json:"wins"`
+	Ties          int            `json:"ties"`
+	Finished      bool           `json:"finished"`
+	Winner        string         `json:"winner"`
+	RatingChanges map[string]int `json:"ratingChanges"`
+	Ranked        bool           `json:"ranked"`   // false = fila casual, não mexe no rating
+	Practice      bool           `json:"practice"` // treino contra bot
+}
+
+type SeriesEnded struct {
+	Series *Series `json:"series"`
+	Player string  `json:"player"`
+	Reason string  `json:"reason"`
+}
+
+type RematchInfo struct {
+	Timeout int     `json:"timeout"`
+	Player  string  `json:"player"`
+	Reason  string  `json:"reason"`
+	Series  *Series `json:"series"`
+}
+
+type ChallengeInfo struct {
+	ID      int    `json:"id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Ruleset string `json:"ruleset"`
+	BestOf  int    `json:"bestOf"`
+	Timeout int    `json:"timeout"`
+	Reason  string `json:"reason"`
+}
+
+type LobbyInfo struct {
+	Code    string `json:"code"`
+	Host    string `json:"host"`
+	Ruleset string `json:"ruleset"`
+	BestOf  int    `json:"bestOf"`
+	Reason  string `json:"reason"`
+	// só nos rulesets de mais de dois: quem já entrou e quantos faltam
+	Players []string `json:"players"`
+	Needed  int      `json:"needed"`
+}
+
+type QueueInfo struct {
+	Queue    string `json:"queue"`
+	Ruleset  string `json:"ruleset"`
+	Position int    `json:"position"`
+	Size     int    `json:"size"`
+	Needed   int    `json:"needed"`
+	Waited   int    `json:"waited"`
+	Estimate int    `json:"estimate"` // -1 = o servidor ainda não tem média
+}
+
+type ReplayInfo struct {
+	ID      string `json:"id"`
+	Ruleset string `json:"ruleset"`
+	Players []struct {
+		UID      string `json:"uid"`
+		Username string `json:"username"`
+	} `json:"players"`
+	Result *struct {
+		Winners []string `json:"winners"`
+		Reason  string   `json:"reason"`
+	} `json:"result"`
+	Actions int       `json:"actions"`
+	Started time.Time `json:"started"`
+}
+
+type PlayerSummary struct {
+	Username     string     `json:"username"`
+	Sanity       int        `json:"sanity"`
+	DreamState   DreamState `json:"dreamState"`
+	CardsPlayed  []Card     `json:"cardsPlayed"`
+	DamageDealt  int        `json:"damageDealt"`
+	DamageTaken  int        `json:"damageTaken"`
+	Healed       int        `json:"healed"`
+	Rating       int        `json:"rating"`
+	RatingChange int        `json:"ratingChange"`
 }
 
 type MatchInfo struct {
 	OpponentUsername string
+	Players          map[string]string // nomes por UID
+	Order            []string          // UIDs na ordem dos turnos
+	Teams            map[string]int    // só em duplas
+	Eliminated       map[string]bool
+	Ruleset          Ruleset
 	Sanity           map[string]int
 	DreamStates      map[string]DreamState
 	CurrentTurnUID   string
+	HandSizes        map[string]int
+	LibrarySizes     map[string]int
+	Discards         map[string][]Card
+	Lucidity         map[string]int
+	MaxLucidity      map[string]int
 	Round            int
 }
 
@@ -143,6 +402,14 @@ func main() {
 
 	// Canal com buffer para evitar deadlock
 	turnSignal = make(chan struct{}, 1)
+	mulliganSignal = make(chan struct{}, 1)
+	reactionSignal = make(chan struct{}, 1)
+	invSignal = make(chan struct{}, 1)
+	replaySignal = make(chan struct{}, 1)
+	spectateSignal = make(chan bool, 1)
+	rematchSignal = make(chan struct{}, 1)
+	rematchDone = make(chan bool, 1)
+	cardSets = make(map[string]CardSet)
 	matchInfo = &MatchInfo{
 		Sanity:      make(map[string]int),
 		DreamStates: make(map[string]DreamState),
@@ -165,6 +432,9 @@ func handleServerMessages() {
 			return
 		}
 
+		if spectating && handleSpectatorMessage(msg) {
+			continue
+		}
 		handleResponse(msg)
 	}
 }
@@ -172,9 +442,25 @@ func handleServerMessages() {
 func showMenu() {
 	reader := bufio.NewReader(os.Stdin)
 	for {
+		// a oferta de revanche pode chegar com o menu parado em qualquer lugar
+		select {
+		case <-rematchSignal:
+			handleRematch(reader, "")
+			continue
+		default:
+		}
+
 		if inBattle {
-			<-turnSignal
-			handleBattleTurn()
+			select {
+			case <-turnSignal:
+				handleBattleTurn()
+			case <-mulliganSignal:
+				handleMulligan()
+			case <-reactionSignal:
+				handleReaction()
+			case <-rematchSignal:
+				handleRematch(reader, "")
+			}
 			continue
 		}
 
@@ -186,10 +472,23 @@ func showMenu() {
 		} else {
 			fmt.Println("3. Comprar booster")
 			fmt.Println("4. Ver inventário")
-			fmt.Println("5. Batalhar")
+			if queuedRuleset != "" {
+				fmt.Printf("5. Sair da fila (%s, %s)\n", queuedQueue, queuedRuleset)
+			} else {
+				fmt.Println("5. Batalhar")
+			}
 			fmt.Println("6. Ping")
+			fmt.Println("7. Replays")
+			fmt.Println("8. Assistir partida")
+			challengesMu.Lock()
+			fmt.Printf("9. Jogar com amigo (%d desafio(s) recebido(s))\n", len(challenges))
+			challengesMu.Unlock()
+			fmt.Println("10. Treinar contra bot")
+			if rematchOpen {
+				fmt.Println("s/n. Responder revanche")
+			}
 		}
-		fmt.Println("7. Sair")
+		fmt.Println("11. Sair")
 		fmt.Print("Escolha uma opção: ")
 
 		input, _ := reader.ReadString('\n')
@@ -206,19 +505,42 @@ func showMenu() {
 			}
 		case "3":
 			if loggedIn {
-				handleBuyPack()
+				handleBuyPack(reader)
 			}
 		case "4":
 			if loggedIn {
+				requestInventory()
 				printInventory()
 			}
 		case "5":
-			if loggedIn {
-				handleEnqueue()
+			if loggedIn && queuedRuleset != "" {
+				leaveQueue()
+			} else if loggedIn {
+				handleEnqueue(reader)
 			}
 		case "6":
 			testLatency()
 		case "7":
+			if loggedIn {
+				handleReplays(reader)
+			}
+		case "8":
+			if loggedIn {
+				handleSpectate(reader)
+			}
+		case "9":
+			if loggedIn {
+				handleFriendMatch(reader)
+			}
+		case "10":
+			if loggedIn {
+				handlePractice(reader)
+			}
+		case "s", "n":
+			if rematchOpen {
+				handleRematch(reader, choice)
+			}
+		case "11":
 			fmt.Println("💤 Bons sonhos...")
 			return
 		default:
@@ -255,37 +577,210 @@ func handleResponse(msg Message) {
 		}
 		invMu.Unlock()
 		fmt.Println("🎁 Novo booster adquirido! Veja em seu inventário")
+	case inventoryr:
+		var payload struct {
+			Cards []Card             `json:"cards"`
+			Sets  map[string]CardSet `json:"sets"`
+		}
+		json.Unmarshal(msg.Data, &payload)
+		invMu.Lock()
+		inventory = make([]*Card, len(payload.Cards))
+		for i := range payload.Cards {
+			inventory[i] = &payload.Cards[i]
+		}
+		cardSets = payload.Sets
+		invMu.Unlock()
+		select {
+		case invSignal <- struct{}{}:
+		default:
+		}
 	case enqueued:
-		fmt.Println("⏳ Entrou na fila. Aguardando oponente...")
+		var info QueueInfo
+		json.Unmarshal(msg.Data, &info)
+		if inBattle {
+			// o pareamento foi mais rápido que a resposta: o gameStart já chegou
+			break
+		}
+		queuedRuleset = info.Ruleset
+		queuedQueue = info.Queue
+		fmt.Println("⏳ Entrou na fila. Aguardando oponente... (menu 5 para sair)")
+		printQueueInfo(info)
+	case queuestatus:
+		var info QueueInfo
+		json.Unmarshal(msg.Data, &info)
+		printQueueInfo(info)
+	case queueleft:
+		var info QueueInfo
+		json.Unmarshal(msg.Data, &info)
+		queuedRuleset = ""
+		queuedQueue = ""
+		fmt.Printf("🚪 Você saiu da fila %s (%s) depois de %ds.\n", info.Queue, info.Ruleset, info.Waited)
+	case challengesent:
+		var info ChallengeInfo
+		json.Unmarshal(msg.Data, &info)
+		fmt.Printf("📨 Desafio enviado para %s (%s%s). Esperando resposta por %ds...\n", info.To, info.Ruleset, bestOfLabel(info.BestOf), info.Timeout)
+	case challengerecv:
+		var info ChallengeInfo
+		json.Unmarshal(msg.Data, &info)
+		challengesMu.Lock()
+		challenges = append(challenges, info)
+		challengesMu.Unlock()
+		fmt.Printf("⚔️ %s te desafiou para uma partida (%s%s)! Responda em até %ds no menu 9 (Jogar com amigo).\n", info.From, info.Ruleset, bestOfLabel(info.BestOf), info.Timeout)
+	case challengeclose:
+		var info ChallengeInfo
+		json.Unmarshal(msg.Data, &info)
+		challengesMu.Lock()
+		challenges = slices.DeleteFunc(challenges, func(c ChallengeInfo) bool { return c.ID == info.ID })
+		challengesMu.Unlock()
+		other := info.To
+		if other == username {
+			other = info.From
+		}
+		switch info.Reason {
+		case "recusou":
+			fmt.Printf("🚫 Desafio entre %s e %s recusado.\n", info.From, info.To)
+		case "expirou":
+			fmt.Printf("⌛ O desafio entre %s e %s expirou.\n", info.From, info.To)
+		case "desconectou":
+			fmt.Printf("🔌 %s desconectou, desafio cancelado.\n", other)
+		case "em partida":
+			fmt.Printf("⚔️ %s entrou em outra partida, desafio cancelado.\n", other)
+		default:
+			fmt.Printf("🚫 Desafio cancelado: %s\n", info.Reason)
+		}
+	case lobbycreated:
+		var info LobbyInfo
+		json.Unmarshal(msg.Data, &info)
+		fmt.Printf("🔒 Partida privada criada (%s%s)! Código: %s\n", info.Ruleset, bestOfLabel(info.BestOf), info.Code)
+		if info.Needed > 1 {
+			fmt.Printf("Passe o código para os amigos; a partida começa quando entrarem mais %d.\n", info.Needed)
+		} else {
+			fmt.Println("Passe o código para seu amigo; a partida começa quando ele entrar.")
+		}
+	case lobbyjoined:
+		var info LobbyInfo
+		json.Unmarshal(msg.Data, &info)
+		fmt.Printf("👥 Partida privada %s: %s. Falta(m) %d jogador(es).\n", info.Code, strings.Join(info.Players, ", "), info.Needed)
+	case lobbyclosed:
+		var info LobbyInfo
+		json.Unmarshal(msg.Data, &info)
+		fmt.Printf("🔓 Partida privada %s fechada.\n", info.Code)
 	case gamestart:
 		var payload struct {
-			Info        string
-			Turn        string
-			Hand        []Card
-			Sanity      map[string]int
-			DreamStates map[string]DreamState
+			Info         string
+			Ruleset      Ruleset
+			Turn         string
+			FirstPlayer  string
+			Hand         []Card
+			LibrarySizes map[string]int
+			Sanity       map[string]int
+			DreamStates  map[string]DreamState
+			Lucidity     map[string]int
+			MaxLucidity  map[string]int
+			Series       *Series
+			Order        []string
+			Players      map[string]string
+			Teams        map[string]int
+			Bots         []string
 		}
 		json.Unmarshal(msg.Data, &payload)
 		inBattle = true
+		queuedRuleset = "" // o servidor tira da fila quem entra numa partida
+		queuedQueue = ""
+		if rematchOpen {
+			rematchOpen = false
+			select {
+			case rematchDone <- true:
+			default:
+			}
+		}
+		// o servidor cancela os desafios de quem entra numa partida
+		challengesMu.Lock()
+		challenges = nil
+		challengesMu.Unlock()
 		matchMu.Lock()
+		matchInfo.Ruleset = payload.Ruleset
+		matchInfo.LibrarySizes = payload.LibrarySizes
+		matchInfo.HandSizes = nil
+		matchInfo.Discards = nil
 		hand = make([]*Card, len(payload.Hand))
 		for i := range payload.Hand {
 			hand[i] = &payload.Hand[i]
 		}
 		matchInfo.OpponentUsername = payload.Info
+		matchInfo.Order = payload.Order
+		matchInfo.Players = payload.Players
+		matchInfo.Teams = payload.Teams
+		matchInfo.Eliminated = nil
 		matchInfo.Sanity = payload.Sanity
 		matchInfo.DreamStates = payload.DreamStates
 		matchInfo.CurrentTurnUID = payload.Turn
+		matchInfo.Lucidity = payload.Lucidity
+		matchInfo.MaxLucidity = payload.MaxLucidity
 		matchMu.Unlock()
 
 		fmt.Printf("⚔️ Partida encontrada! Você está batalhando contra %s.\n", matchInfo.OpponentUsername)
+		for _, id := range otherPlayers() {
+			if isAlly(id) {
+				fmt.Printf("🤝 Sua dupla: %s\n", playerName(id))
+			}
+		}
+		printRuleset(matchInfo.Ruleset)
 		fmt.Println("Sanidade inicial:")
 		fmt.Printf("Você: %d\n", matchInfo.Sanity[uid])
-		fmt.Printf("Seu oponente: %d\n", matchInfo.Sanity[getOpponentUID()])
-		if matchInfo.CurrentTurnUID == uid {
+		if others := otherPlayers(); len(others) == 1 {
+			fmt.Printf("Seu oponente: %d\n", matchInfo.Sanity[others[0]])
+		} else {
+			for _, id := range others {
+				fmt.Printf("%s: %d\n", otherLabel(id), matchInfo.Sanity[id])
+			}
+		}
+		if series := payload.Series; series != nil && (series.BestOf > 0 || series.Games > 0) {
+			printSeries(series)
+		}
+		if len(payload.Bots) > 0 {
+			var bots []string
+			for _, id := range payload.Bots {
+				bots = append(bots, playerName(id))
+			}
+			if payload.Series != nil && payload.Series.Practice {
+				fmt.Printf("🤖 Treino contra %s. A partida não vale rating nem estatísticas.\n", strings.Join(bots, ", "))
+			} else {
+				fmt.Printf("🤖 A fila demorou: %s é bot do servidor. A partida não vale rating nem estatísticas.\n", strings.Join(bots, ", "))
+			}
+		} else if payload.Series != nil && !payload.Series.Ranked {
+			fmt.Println("🎲 Partida casual: não vale rating.")
+		}
+		if payload.Series != nil && payload.Series.Games > 0 {
+			// na série quem começa vai alternando, sem cara ou coroa
+			if payload.FirstPlayer == uid {
+				fmt.Println("🔁 Sua vez de começar nesta partida da série!")
+			} else {
+				fmt.Printf("🔁 %s começa esta partida da série. Você recebe a compensação do ruleset.\n", playerName(payload.FirstPlayer))
+			}
+		} else if len(payload.Order) > 2 {
+			// com mais gente é um sorteio; a ordem dos turnos já sai dele
+			names := make([]string, len(payload.Order))
+			for i, id := range payload.Order {
+				names[i] = payload.Players[id]
+			}
+			fmt.Printf("🎲 Ordem sorteada: %s.\n", strings.Join(names, " → "))
+			if payload.FirstPlayer != uid {
+				fmt.Println("Você não começa e recebe a compensação do ruleset.")
+			}
+		} else if payload.FirstPlayer == uid {
+			fmt.Println("🪙 Você ganhou o cara ou coroa e começa!")
+		} else {
+			fmt.Printf("🪙 %s ganhou o cara ou coroa e começa. Você recebe a compensação do ruleset.\n", playerName(payload.FirstPlayer))
+		}
+		fmt.Printf("Cartas: %d na mão, %d na pilha de compra\n", len(hand), matchInfo.LibrarySizes[uid])
+		if matchInfo.Ruleset.Mulligan {
+			// o primeiro turno só começa depois do mulligan (chega um newTurn)
+			mulliganSignal <- struct{}{}
+		} else if matchInfo.CurrentTurnUID == uid {
 			turnSignal <- struct{}{}
 		} else {
-			fmt.Printf("⏳ Turno do seu oponente. Aguarde...\n")
+			fmt.Printf("⏳ Turno %s. Aguarde...\n", turnOf(matchInfo.CurrentTurnUID))
 		}
 	case newturn:
 		var payload struct {
@@ -300,9 +795,13 @@ func handleResponse(msg Message) {
 			fmt.Printf("\n--- Status do Jogo ---\n")
 			fmt.Printf("Rodada: %d\n", matchInfo.Round)
 			fmt.Printf("Sua Sanidade: %d (%s)\n", matchInfo.Sanity[uid], strings.Title(string(matchInfo.DreamStates[uid])))
-			opponentUID := getOpponentUID()
-			fmt.Printf("Sanidade do Oponente: %d (%s)\n", matchInfo.Sanity[opponentUID], strings.Title(string(matchInfo.DreamStates[opponentUID])))
-			fmt.Println("\n➡️ É o seu turno! Escolha uma carta para jogar (pelo número) ou digite `gv` para desistir.")
+			printOthersSanity()
+			if matchInfo.Ruleset.Lucidity != nil {
+				fmt.Printf("Sua Lucidez: %d/%d\n", matchInfo.Lucidity[uid], matchInfo.MaxLucidity[uid])
+				fmt.Println("\n➡️ É o seu turno! Jogue cartas (pelo número) enquanto tiver lucidez, digite `fim` para acabar o turno ou `gv` para desistir.")
+			} else {
+				fmt.Println("\n➡️ É o seu turno! Escolha uma carta para jogar (pelo número), `fim` para passar a vez se não tiver nenhuma ou `gv` para desistir.")
+			}
 			// Limpa o canal antes de enviar um novo sinal
 			select {
 			case <-turnSignal:
@@ -313,10 +812,65 @@ func handleResponse(msg Message) {
 			fmt.Printf("\n--- Status do Jogo ---\n")
 			fmt.Printf("Rodada: %d\n", matchInfo.Round)
 			fmt.Printf("Sua Sanidade: %d (%s)\n", matchInfo.Sanity[uid], strings.Title(string(matchInfo.DreamStates[uid])))
-			opponentUID := getOpponentUID()
-			fmt.Printf("Sanidade do Oponente: %d (%s)\n", matchInfo.Sanity[opponentUID], strings.Title(string(matchInfo.DreamStates[opponentUID])))
-			fmt.Printf("\n⏳ Turno do seu oponente. Aguarde...\n")
+			printOthersSanity()
+			fmt.Printf("\n⏳ Turno %s. Aguarde...\n", turnOf(matchInfo.CurrentTurnUID))
+		}
+	case reactionwindow:
+		var payload ReactionWindow
+		json.Unmarshal(msg.Data, &payload)
+		matchMu.Lock()
+		reactionWindow = payload
+		matchMu.Unlock()
+		select {
+		case reactionSignal <- struct{}{}:
+		default:
+		}
+	case reactionclosed:
+		var payload struct {
+			Reason string
+		}
+		json.Unmarshal(msg.Data, &payload)
+		if payload.Reason == "anulada" {
+			fmt.Println("🛡️ Janela de reação fechada: quem jogou a carta saiu da partida.")
+		} else {
+			fmt.Printf("🛡️ Janela de reação fechada (%s).\n", payload.Reason)
+		}
+	case mulliganresult:
+		var payload struct {
+			Hand        []Card
+			Returned    int
+			LibrarySize int
+		}
+		json.Unmarshal(msg.Data, &payload)
+		matchMu.Lock()
+		hand = make([]*Card, len(payload.Hand))
+		for i := range payload.Hand {
+			hand[i] = &payload.Hand[i]
+		}
+		matchMu.Unlock()
+
+		if payload.Returned > 0 {
+			fmt.Printf("🔄 Mulligan: você trocou %d carta(s). Sua mão agora:\n", payload.Returned)
+		} else {
+			fmt.Println("🔄 Mulligan: você ficou com a mão. Sua mão:")
 		}
+		printHand()
+	case cardused:
+		var payload CardUsed
+		json.Unmarshal(msg.Data, &payload)
+		printCardUsed(payload)
+	case gameevent:
+		var event GameEvent
+		json.Unmarshal(msg.Data, &event)
+		if event.Type == "playerEliminated" {
+			matchMu.Lock()
+			if matchInfo.Eliminated == nil {
+				matchInfo.Eliminated = make(map[string]bool)
+			}
+			matchInfo.Eliminated[event.Player] = true
+			matchMu.Unlock()
+		}
+		printGameEvent(event)
 	case notify:
 		var payload struct {
 			Message string
@@ -325,32 +879,143 @@ func handleResponse(msg Message) {
 		fmt.Printf("📣 %s\n", payload.Message)
 	case updateinfo:
 		var payload struct {
-			Turn        string
-			Sanity      map[string]int
-			DreamStates map[string]DreamState
-			Round       int
+			Turn         string
+			Sanity       map[string]int
+			DreamStates  map[string]DreamState
+			Round        int
+			Hand         []Card
+			HandSizes    map[string]int
+			LibrarySizes map[string]int
+			Discards     map[string][]Card
+			Lucidity     map[string]int
+			MaxLucidity  map[string]int
+			Eliminated   map[string]bool
 		}
 		json.Unmarshal(msg.Data, &payload)
 		matchMu.Lock()
+		matchInfo.Eliminated = payload.Eliminated
 		matchInfo.Sanity = payload.Sanity
 		matchInfo.DreamStates = payload.DreamStates
 		matchInfo.Round = payload.Round
+		matchInfo.HandSizes = payload.HandSizes
+		matchInfo.LibrarySizes = payload.LibrarySizes
+		matchInfo.Discards = payload.Discards
+		matchInfo.Lucidity = payload.Lucidity
+		matchInfo.MaxLucidity = payload.MaxLucidity
+		// a mão que vale é a do servidor (já com as compras)
+		hand = make([]*Card, len(payload.Hand))
+		for i := range payload.Hand {
+			hand[i] = &payload.Hand[i]
+		}
 		matchMu.Unlock()
 
 		fmt.Printf("\n--- Status do Jogo ---\n")
 		fmt.Printf("Rodada: %d\n", matchInfo.Round)
 		fmt.Printf("Sua Sanidade: %d (%s)\n", matchInfo.Sanity[uid], strings.Title(string(matchInfo.DreamStates[uid])))
-		opponentUID := getOpponentUID()
-		fmt.Printf("Sanidade do Oponente: %d (%s)\n", matchInfo.Sanity[opponentUID], strings.Title(string(matchInfo.DreamStates[opponentUID])))
+		printOthersSanity()
+		fmt.Printf("Suas cartas: %d na mão, %d na pilha, %d no descarte\n", matchInfo.HandSizes[uid], matchInfo.LibrarySizes[uid], len(matchInfo.Discards[uid]))
+		for _, id := range otherPlayers() {
+			if matchInfo.Eliminated[id] {
+				continue
+			}
+			fmt.Printf("Cartas %s: %d na mão, %d na pilha, %d no descarte\n", ofOther(id), matchInfo.HandSizes[id], matchInfo.LibrarySizes[id], len(matchInfo.Discards[id]))
+			if discard := matchInfo.Discards[id]; len(discard) > 0 {
+				fmt.Printf("Última carta %s: %s\n", ofOther(id), discard[len(discard)-1].Name)
+			}
+		}
+		if matchInfo.Ruleset.Lucidity != nil {
+			line := fmt.Sprintf("Lucidez: você %d/%d", matchInfo.Lucidity[uid], matchInfo.MaxLucidity[uid])
+			for _, id := range otherPlayers() {
+				if !matchInfo.Eliminated[id] {
+					line += fmt.Sprintf(", %s %d/%d", otherLabel(id), matchInfo.Lucidity[id], matchInfo.MaxLucidity[id])
+				}
+			}
+			fmt.Println(line)
+			// com lucidez o turno continua depois da carta, até mandarmos `fim`
+			if matchInfo.CurrentTurnUID == uid {
+				select {
+				case <-turnSignal:
+				default:
+				}
+				turnSignal <- struct{}{}
+			}
+		}
+	case replaylist:
+		var list []ReplayInfo
+		json.Unmarshal(msg.Data, &list)
+		replays = list
+		select {
+		case replaySignal <- struct{}{}:
+		default:
+		}
+	case replayfile:
+		// guarda o arquivo do jeito que veio, para rodar no cmd/replay do servidor
+		var info ReplayInfo
+		json.Unmarshal(msg.Data, &info)
+		filename := filepath.Join("replays", info.ID+".json")
+		if err := os.MkdirAll("replays", 0o755); err != nil {
+			fmt.Printf("❌ Erro ao salvar replay: %v\n", err)
+			return
+		}
+		if err := os.WriteFile(filename, msg.Data, 0o644); err != nil {
+			fmt.Printf("❌ Erro ao salvar replay: %v\n", err)
+			return
+		}
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+		fmt.Printf("💾 Replay salvo em %s (de dentro de server/: go run ./cmd/replay %s)\n", filename, filename)
 	case newvictory:
 		inBattle = false
 		fmt.Println("\n🎉 Vitória! Você venceu a partida!")
+		printSummary(msg.Data)
 	case newloss:
 		inBattle = false
 		fmt.Println("\n💔 Derrota. Você perdeu a partida.")
+		printSummary(msg.Data)
 	case newtie:
 		inBattle = false
 		fmt.Println("\n🤝 Empate! A partida terminou em um empate.")
+		printSummary(msg.Data)
+	case rematchoffer:
+		var offer RematchInfo
+		json.Unmarshal(msg.Data, &offer)
+		rematchOpen = true
+		printSummary(lastSummary)
+		fmt.Printf("\n🔁 Revanche? Responda s/n em até %ds (placar: %s)\n", offer.Timeout, seriesScore(offer.Series))
+		select {
+		case rematchSignal <- struct{}{}:
+		default:
+		}
+	case seriesended:
+		var info SeriesEnded
+		json.Unmarshal(msg.Data, &info)
+		inBattle = false
+		fmt.Printf("\n🏳️ %s saiu da série (%s).\n", info.Player, info.Reason)
+		printSeries(info.Series)
+	case rematchaccept:
+		var info RematchInfo
+		json.Unmarshal(msg.Data, &info)
+		if info.Player != username {
+			printSummary(lastSummary)
+			fmt.Printf("\n🔁 %s aceitou a revanche! Jogar a revanche? (s/n): ", info.Player)
+		}
+	case rematchclosed:
+		var info RematchInfo
+		json.Unmarshal(msg.Data, &info)
+		rematchOpen = false
+		switch info.Reason {
+		case "recusou":
+			fmt.Printf("🚫 %s recusou a revanche.\n", info.Player)
+		case "expirou":
+			fmt.Println("⌛ O tempo para a revanche acabou.")
+		default:
+			fmt.Printf("🚫 Sem revanche: %s %s.\n", info.Player, info.Reason)
+		}
+		select {
+		case rematchDone <- false:
+		default:
+		}
 	default:
 		// Se for um erro do servidor, exibe a mensagem de erro
 		var errPayload struct {
@@ -407,9 +1072,14 @@ func handleLogin(reader *bufio.Reader) {
 	enc.Encode(req)
 }
 
-func handleBuyPack() {
+func handleBuyPack(reader *bufio.Reader) {
+	fmt.Print("Coleção (código, ex: P1) ou Enter para qualquer uma: ")
+	set, _ := reader.ReadString('\n')
+	set = strings.TrimSpace(set)
+
 	data, _ := json.Marshal(map[string]string{
 		"UID": uid,
+		"set": set,
 	})
 	req := Message{
 		Request: buypack,
@@ -419,9 +1089,19 @@ func handleBuyPack() {
 	enc.Encode(req)
 }
 
-func handleEnqueue() {
+func handleEnqueue(reader *bufio.Reader) {
+	fmt.Print("Fila (ranqueada, serie, casual, relampago) ou Enter para a padrão: ")
+	queue, _ := reader.ReadString('\n')
+	queue = strings.TrimSpace(queue)
+
+	fmt.Print("Ruleset (ex: classico, rapido, pesadelo, lucido, roda, duplas) ou Enter para o padrão (ou o da fila): ")
+	ruleset, _ := reader.ReadString('\n')
+	ruleset = strings.TrimSpace(ruleset)
+
 	data, _ := json.Marshal(map[string]string{
-		"UID": uid,
+		"UID":     uid,
+		"queue":   queue,
+		"ruleset": ruleset,
 	})
 	req := Message{
 		Request: battle,
@@ -431,6 +1111,28 @@ func handleEnqueue() {
 	enc.Encode(req)
 }
 
+func handlePractice(reader *bufio.Reader) {
+	fmt.Print("Nível do bot (facil, medio, dificil) ou Enter para o médio: ")
+	level, _ := reader.ReadString('\n')
+	level = strings.TrimSpace(level)
+
+	fmt.Print("Ruleset (ex: classico, rapido, pesadelo, lucido, roda, duplas) ou Enter para o padrão: ")
+	ruleset, _ := reader.ReadString('\n')
+	ruleset = strings.TrimSpace(ruleset)
+
+	data, _ := json.Marshal(map[string]string{
+		"UID":     uid,
+		"level":   level,
+		"ruleset": ruleset,
+	})
+	req := Message{
+		Request: practice,
+		UID:     uid,
+		Data:    data,
+	}
+	enc.Encode(req)
+}
+
 func handleBattleTurn() {
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Printf("\nSua mão atual:\n")
@@ -444,6 +1146,13 @@ func handleBattleTurn() {
 		return
 	}
 
+	// sem lucidez, "fim" só passa a vez de quem não tem carta para jogar
+	// (o servidor recusa se tiver)
+	if input == "fim" {
+		endTurn()
+		return
+	}
+
 	matchMu.RLock()
 	index, err := strconv.Atoi(input)
 	if err != nil || index < 1 || index > len(hand) {
@@ -460,13 +1169,137 @@ func handleBattleTurn() {
 	cardToPlay := hand[index-1]
 	matchMu.RUnlock()
 
-	useCard(cardToPlay)
+	if cardToPlay.CardType == Reaction {
+		fmt.Println("❌ Cartas de reação só podem ser jogadas em resposta a uma carta do oponente. Sem outra carta, digite `fim` para passar a vez.")
+		select {
+		case <-turnSignal:
+		default:
+		}
+		turnSignal <- struct{}{}
+		return
+	}
+
+	if matchInfo.Ruleset.Lucidity != nil && cardToPlay.Cost > matchInfo.Lucidity[uid] {
+		fmt.Printf("❌ Lucidez insuficiente: %s custa %d e você tem %d. Digite `fim` para acabar o turno.\n", cardToPlay.Name, cardToPlay.Cost, matchInfo.Lucidity[uid])
+		select {
+		case <-turnSignal:
+		default:
+		}
+		turnSignal <- struct{}{}
+		return
+	}
+
+	// com mais de um oponente a carta precisa de alvo (a pílula é sempre em si)
+	target := ""
+	matchMu.RLock()
+	foes := livingOpponents()
+	matchMu.RUnlock()
+	if cardToPlay.CardType != Pill && len(foes) > 1 {
+		for i, id := range foes {
+			fmt.Printf("%d) %s - sanidade %d (%s)\n", i+1, playerName(id), matchInfo.Sanity[id], strings.Title(string(matchInfo.DreamStates[id])))
+		}
+		fmt.Printf("Em quem jogar %s? ", cardToPlay.Name)
+		line, _ := reader.ReadString('\n')
+		index, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil || index < 1 || index > len(foes) {
+			fmt.Println("❌ Alvo inválido. Escolha o oponente pelo número.")
+			select {
+			case <-turnSignal:
+			default:
+			}
+			turnSignal <- struct{}{}
+			return
+		}
+		target = foes[index-1]
+	}
+
+	useCard(cardToPlay, target)
 }
 
-func useCard(card *Card) {
-	data, _ := json.Marshal(map[string]Card{
-		"card": *card,
+// escolhe uma reação para a carta do oponente (ou passa)
+func handleReaction() {
+	reader := bufio.NewReader(os.Stdin)
+
+	matchMu.RLock()
+	window := reactionWindow
+	var reactions []*Card
+	for _, c := range hand {
+		// com lucidez só aparecem as reações que dá para pagar
+		if c.CardType == Reaction && (matchInfo.Ruleset.Lucidity == nil || c.Cost <= matchInfo.Lucidity[uid]) {
+			reactions = append(reactions, c)
+		}
+	}
+	matchMu.RUnlock()
+
+	// a janela abre mesmo sem reação na mão, para o oponente não saber
+	if len(reactions) == 0 {
+		fmt.Printf("\n🛡️ %s jogou %s (%s). Você não tem reação para usar.\n", window.From, window.Card.Name, window.Card.Desc)
+		fmt.Printf("Enter para passar (%ds): ", window.Timeout)
+	} else {
+		fmt.Printf("\n🛡️ %s jogou %s (%s). Você pode reagir!\n", window.From, window.Card.Name, window.Card.Desc)
+		for i, c := range reactions {
+			fmt.Printf("%d) %s - %s\n", i+1, c.Name, c.Desc)
+		}
+		fmt.Printf("Escolha a reação pelo número ou Enter para passar (%ds): ", window.Timeout)
+	}
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+
+	cid := ""
+	if index, err := strconv.Atoi(input); err == nil && index >= 1 && index <= len(reactions) {
+		cid = reactions[index-1].Instance
+	} else if input != "" {
+		fmt.Println("❌ Reação inválida, passando.")
+	}
+
+	data, _ := json.Marshal(map[string]string{
+		"UID":  uid,
+		"card": cid,
+	})
+	enc.Encode(Message{Request: react, UID: uid, Data: data})
+}
+
+// escolhe as cartas da mão inicial para devolver à pilha
+func handleMulligan() {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("\nSua mão inicial:\n")
+	printHand()
+	fmt.Printf("Mulligan: digite os números das cartas para trocar (ex: 1 3 5) ou Enter para manter (%ds): ", matchInfo.Ruleset.MulliganTimeout)
+	input, _ := reader.ReadString('\n')
+
+	matchMu.RLock()
+	var cids []string
+	for _, field := range strings.Fields(input) {
+		index, err := strconv.Atoi(field)
+		if err != nil || index < 1 || index > len(hand) {
+			fmt.Printf("❌ Carta %q inválida, ignorada.\n", field)
+			continue
+		}
+		cids = append(cids, hand[index-1].Instance)
+	}
+	matchMu.RUnlock()
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"UID":   uid,
+		"cards": cids,
 	})
+	enc.Encode(Message{Request: mulligan, UID: uid, Data: data})
+	if len(matchInfo.Order) > 2 {
+		fmt.Println("⏳ Aguardando o mulligan dos oponentes...")
+	} else {
+		fmt.Println("⏳ Aguardando o mulligan do oponente...")
+	}
+}
+
+// joga a carta; target vazio deixa o servidor escolher o único oponente
+func useCard(card *Card, target string) {
+	request := map[string]interface{}{
+		"card": *card,
+	}
+	if target != "" {
+		request["target"] = target
+	}
+	data, _ := json.Marshal(request)
 	req := Message{
 		Request: usecard,
 		UID:     uid,
@@ -478,13 +1311,45 @@ func useCard(card *Card) {
 	defer matchMu.Unlock()
 	// remove a carta da mão localmente
 	for i, c := range hand {
-		if c.CID == card.CID {
+		if c.Instance == card.Instance {
 			hand = append(hand[:i], hand[i+1:]...)
 			break
 		}
 	}
 }
 
+// acaba o turno (com lucidez) ou passa a vez sem carta para jogar
+func endTurn() {
+	matchMu.Lock()
+	// o próximo updateInfo já é do fim do turno, não pede outra jogada
+	matchInfo.CurrentTurnUID = ""
+	matchMu.Unlock()
+
+	data, _ := json.Marshal(map[string]string{"UID": uid})
+	enc.Encode(Message{Request: endturn, UID: uid, Data: data})
+}
+
+// sai da fila (a resposta é o queueLeft)
+func leaveQueue() {
+	data, _ := json.Marshal(map[string]string{"UID": uid})
+	enc.Encode(Message{Request: leavequeue, UID: uid, Data: data})
+	time.Sleep(500 * time.Millisecond) // dá tempo de ver a resposta antes do menu limpar a tela
+}
+
+// posição na fila e quanto ainda deve demorar
+func printQueueInfo(info QueueInfo) {
+	line := fmt.Sprintf("⏳ Fila %s (%s): posição %d de %d (%d por partida), esperando há %ds", info.Queue, info.Ruleset, info.Position, info.Size, info.Needed, info.Waited)
+	switch {
+	case info.Estimate < 0:
+		line += ", sem estimativa ainda"
+	case info.Estimate == 0:
+		line += ", deve sair a qualquer momento"
+	default:
+		line += fmt.Sprintf(", estimativa de mais %ds", info.Estimate)
+	}
+	fmt.Println(line)
+}
+
 func giveUp() {
 	req := Message{
 		Request: giveup,
@@ -493,15 +1358,651 @@ func giveUp() {
 	enc.Encode(req)
 }
 
-func getOpponentUID() string {
+// os outros jogadores da partida, na ordem dos turnos
+func otherPlayers() []string {
+	var others []string
+	for _, id := range matchInfo.Order {
+		if id != uid {
+			others = append(others, id)
+		}
+	}
+	return others
+}
+
+// em duplas, se o jogador é do nosso time
+func isAlly(id string) bool {
+	team, ok := matchInfo.Teams[id]
+	return ok && id != uid && team == matchInfo.Teams[uid]
+}
+
+// quem ainda pode receber nossas cartas
+func livingOpponents() []string {
+	var foes []string
+	for _, id := range otherPlayers() {
+		if !matchInfo.Eliminated[id] && !isAlly(id) {
+			foes = append(foes, id)
+		}
+	}
+	return foes
+}
+
+// outro jogador nas linhas de status: "oponente" no um contra um, o nome
+// (e se é da dupla) com mais gente
+func otherLabel(id string) string {
+	if len(matchInfo.Order) <= 2 {
+		return "oponente"
+	}
+	if isAlly(id) {
+		return playerName(id) + " (sua dupla)"
+	}
+	return playerName(id)
+}
+
+// "do oponente" / "de fulano"
+func ofOther(id string) string {
+	if len(matchInfo.Order) <= 2 {
+		return "do oponente"
+	}
+	return "de " + otherLabel(id)
+}
+
+// "do seu oponente" / "de fulano" para o aviso de esperar o turno
+func turnOf(id string) string {
+	if len(matchInfo.Order) <= 2 {
+		return "do seu oponente"
+	}
+	return "de " + playerName(id)
+}
+
+// sanidade e estado de cada um dos outros jogadores
+func printOthersSanity() {
+	others := otherPlayers()
+	if len(others) == 1 {
+		fmt.Printf("Sanidade do Oponente: %d (%s)\n", matchInfo.Sanity[others[0]], strings.Title(string(matchInfo.DreamStates[others[0]])))
+		return
+	}
+	for _, id := range others {
+		if matchInfo.Eliminated[id] {
+			fmt.Printf("Sanidade %s: eliminado\n", ofOther(id))
+			continue
+		}
+		fmt.Printf("Sanidade %s: %d (%s)\n", ofOther(id), matchInfo.Sanity[id], strings.Title(string(matchInfo.DreamStates[id])))
+	}
+}
+
+// nome de um jogador da partida como o cliente mostra
+func playerName(id string) string {
+	if id == uid && !spectating {
+		return "Você"
+	}
+	if name, ok := matchInfo.Players[id]; ok {
+		return name
+	}
+	return matchInfo.OpponentUsername
+}
+
+// mostra a carta resolvida e o que ela causou
+func printCardUsed(used CardUsed) {
+	if used.Reaction {
+		fmt.Printf("🛡️ %s reagiu com %s\n", playerName(used.Player), used.Card.Name)
+	} else if len(matchInfo.Order) > 2 && used.Target != "" && used.Target != used.Player {
+		fmt.Printf("🃏 %s jogou %s em %s\n", playerName(used.Player), used.Card.Name, playerName(used.Target))
+	} else {
+		fmt.Printf("🃏 %s jogou %s\n", playerName(used.Player), used.Card.Name)
+	}
+	for id, delta := range used.SanityDeltas {
+		fmt.Printf("   %s: %+d de sanidade\n", playerName(id), delta)
+	}
+	for _, change := range used.StateChanges {
+		fmt.Printf("   %s: agora %s\n", playerName(change.Player), change.State)
+	}
+	for _, event := range used.Events {
+		printGameEvent(event)
+	}
+}
+
+// mostra um evento da partida; o que já aparece em outra mensagem é ignorado
+func printGameEvent(event GameEvent) {
+	switch event.Type {
+	case "turnSkipped":
+		if event.Reason == "paralisado" {
+			fmt.Printf("🚫 %s está paralisado e perde o turno\n", playerName(event.Player))
+		} else if event.Reason == "semJogada" {
+			fmt.Printf("⏭️ %s não tinha carta para jogar e passou a vez\n", playerName(event.Player))
+		} else {
+			fmt.Printf("⌛ %s perdeu o turno por timeout\n", playerName(event.Player))
+		}
+	case "sanityChanged":
+		fmt.Printf("   %s: %+d de sanidade (%s)\n", playerName(event.Target), event.Amount, event.Reason)
+	case "stateChanged":
+		fmt.Printf("   %s: agora %s\n", playerName(event.Target), event.State)
+	case "stateResisted":
+		fmt.Printf("   %s está imune e resistiu ao estado %s\n", playerName(event.Target), event.State)
+	case "effectCanceled":
+		fmt.Printf("   a reação de %s anulou o estado %s\n", playerName(event.Target), event.State)
+	case "damageReflected":
+		fmt.Printf("   %s devolveu %d de dano para %s\n", playerName(event.Player), event.Amount, playerName(event.Target))
+	case "cardsDrawn":
+		// a compra do turno aparece no updateInfo
+		if event.Amount > 0 && event.Reason != "turno" {
+			fmt.Printf("   %s comprou %d carta(s)\n", playerName(event.Target), event.Amount)
+		}
+	case "cardsDiscarded":
+		if event.Amount > 0 {
+			fmt.Printf("   %s descartou %d carta(s)\n", playerName(event.Target), event.Amount)
+		}
+	case "mulliganDone":
+		if event.Player != uid {
+			fmt.Printf("🔄 %s trocou %d carta(s) no mulligan\n", playerName(event.Player), event.Amount)
+		}
+	case "reactionOpened":
+		if event.Target == uid {
+			fmt.Printf("⏳ Aguardando a reação de %s...\n", playerName(event.Player))
+		}
+	case "playerEliminated":
+		if event.Player == uid && !spectating {
+			fmt.Printf("☠️ Você foi eliminado (%s)! Acompanhe o fim da partida.\n", endReasons[event.Reason])
+		} else {
+			fmt.Printf("☠️ %s foi eliminado (%s)\n", playerName(event.Player), endReasons[event.Reason])
+		}
+	case "gameEnded":
+		switch event.Reason {
+		case "deckOut":
+			fmt.Printf("📭 %s precisou comprar e não tinha mais cartas\n", playerName(event.Player))
+		case "forfeit":
+			fmt.Printf("🏳️ %s desistiu\n", playerName(event.Player))
+		}
+	}
+}
+
+// motivos de fim de partida como o cliente mostra
+var endReasons = map[string]string{
+	"sanityZero":     "sanidade zerada",
+	"cardsExhausted": "acabaram as cartas",
+	"deckOut":        "sem cartas",
+	"forfeit":        "desistência",
+	"disconnect":     "desconexão",
+	"timeout":        "tempo esgotado",
+}
+
+// tela de resultado da partida
+func printSummary(data json.RawMessage) {
+	lastSummary = data
+	var summary MatchSummary
+	if err := json.Unmarshal(data, &summary); err != nil || summary.Players == nil {
+		return
+	}
+
+	fmt.Println(strings.Repeat("=", 40))
+	fmt.Printf("Motivo: %s | Rodadas: %d | Ruleset: %s\n", endReasons[summary.Reason], summary.Rounds, summary.Ruleset)
+	ids := append([]string{uid}, otherPlayers()...)
+	if spectating {
+		ids = slices.Sorted(maps.Keys(summary.Players))
+	}
+	for _, id := range ids {
+		player, ok := summary.Players[id]
+		if !ok {
+			continue
+		}
+		fmt.Printf("\n%s (%s)\n", playerName(id), player.Username)
+		fmt.Printf(" Sanidade final: %d (%s)\n", player.Sanity, player.DreamState)
+		fmt.Printf(" Cartas jogadas: %d | Dano causado: %d | Dano sofrido: %d | Cura: %d\n", len(player.CardsPlayed), player.DamageDealt, player.DamageTaken, player.Healed)
+		fmt.Printf(" Rating: %d (%+d)\n", player.Rating, player.RatingChange)
+	}
+	if series := summary.Series; series != nil && (series.BestOf > 0 || series.Games > 1) {
+		fmt.Println()
+		printSeries(series)
+	}
+	if summary.Replay != "" && !spectating {
+		fmt.Printf("\nReplay: %s (baixe no menu Replays)\n", summary.Replay)
+	}
+	fmt.Println(strings.Repeat("=", 40))
+}
+
+// placar da série do ponto de vista de quem joga (ou dos dois, para quem assiste)
+func seriesScore(series *Series) string {
+	if series == nil {
+		return "-"
+	}
+	ids := append([]string{uid}, otherPlayers()...)
+	if spectating {
+		ids = slices.Sorted(maps.Keys(series.Wins))
+	}
+	var score string
+	if len(ids) == 2 {
+		score = fmt.Sprintf("%s %d x %d %s", playerName(ids[0]), series.Wins[ids[0]], series.Wins[ids[1]], playerName(ids[1]))
+	} else {
+		// com mais gente, as vitórias de cada um
+		wins := make([]string, len(ids))
+		for i, id := range ids {
+			wins[i] = fmt.Sprintf("%s %d", playerName(id), series.Wins[id])
+		}
+		score = strings.Join(wins, ", ")
+	}
+	if series.Ties > 0 {
+		score += fmt.Sprintf(" (%d empate(s))", series.Ties)
+	}
+	return score
+}
+
+// " - melhor de N" para as mensagens de desafio e partida privada
+func bestOfLabel(bestOf int) string {
+	if bestOf == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", melhor de %d", bestOf)
+}
+
+// placar da série e, numa melhor de N encerrada, o resultado e o rating
+func printSeries(series *Series) {
+	if series.BestOf == 0 {
+		fmt.Printf("🏆 Série #%d (%d partida(s)): %s\n", series.ID, series.Games, seriesScore(series))
+		return
+	}
+	if !series.Finished {
+		fmt.Printf("🏆 Melhor de %d (série #%d), partida %d: %s\n", series.BestOf, series.ID, series.Games+1, seriesScore(series))
+		return
+	}
+
+	fmt.Printf("🏆 Melhor de %d (série #%d) encerrada em %d partida(s): %s\n", series.BestOf, series.ID, series.Games, seriesScore(series))
+	switch series.Winner {
+	case "":
+		fmt.Println(" A série terminou empatada.")
+	case uid:
+		fmt.Println(" 🎉 Você venceu a série!")
+	default:
+		fmt.Printf(" %s venceu a série.\n", playerName(series.Winner))
+	}
+	if change, ok := series.RatingChanges[uid]; ok && !spectating {
+		fmt.Printf(" Rating da série: %+d\n", change)
+	}
+}
+
+// responde a oferta de revanche (answer vazio pergunta); aceitando, espera o oponente decidir
+func handleRematch(reader *bufio.Reader, answer string) {
+	// a oferta pode ter chegado pelo sinal e também pela opção do menu
+	select {
+	case <-rematchSignal:
+	default:
+	}
+	select {
+	case <-rematchDone:
+	default:
+	}
+	if !rematchOpen {
+		return
+	}
+
+	if answer == "" {
+		fmt.Print("Jogar a revanche? (s/n): ")
+		answer, _ = reader.ReadString('\n')
+	}
+	accept := strings.EqualFold(strings.TrimSpace(answer), "s")
+	if !rematchOpen {
+		fmt.Println("⌛ A revanche já foi fechada.")
+		time.Sleep(1 * time.Second)
+		return
+	}
+
+	data, _ := json.Marshal(map[string]any{"UID": uid, "accept": accept})
+	enc.Encode(Message{Request: rematch, UID: uid, Data: data})
+	if !accept {
+		time.Sleep(500 * time.Millisecond)
+		return
+	}
+
+	fmt.Println("⏳ Esperando o oponente...")
+	select {
+	case started := <-rematchDone:
+		if !started {
+			time.Sleep(1500 * time.Millisecond) // dá tempo de ler o motivo
+		}
+	case <-time.After(30 * time.Second):
+		fmt.Println("⏰ servidor não respondeu")
+	}
+}
+
+// tamanho da série para desafio e partida privada (Enter = partida avulsa)
+func readBestOf(reader *bufio.Reader) int {
+	fmt.Print("Melhor de quantas partidas (3, 5, 7 ou 9) ou Enter para partida avulsa: ")
+	input, _ := reader.ReadString('\n')
+	bestOf, _ := strconv.Atoi(strings.TrimSpace(input))
+	return bestOf
+}
+
+// desafios e partidas privadas
+func handleFriendMatch(reader *bufio.Reader) {
+	fmt.Println("\n--- Jogar com amigo ---")
+	fmt.Println("1. Desafiar jogador")
+	fmt.Println("2. Responder desafio")
+	fmt.Println("3. Criar partida privada")
+	fmt.Println("4. Entrar com código")
+	fmt.Println("5. Fechar (ou sair da) partida privada")
+	fmt.Print("Escolha uma opção (Enter para voltar): ")
+	input, _ := reader.ReadString('\n')
+
+	request := map[string]any{"UID": uid}
+	var kind string
+
+	switch strings.TrimSpace(input) {
+	case "1":
+		fmt.Print("Nome do jogador: ")
+		name, _ := reader.ReadString('\n')
+		fmt.Print("Ruleset (ex: classico, rapido, pesadelo, lucido) ou Enter para o padrão: ")
+		ruleset, _ := reader.ReadString('\n')
+		kind = challenge
+		request["username"] = strings.TrimSpace(name)
+		request["ruleset"] = strings.TrimSpace(ruleset)
+		request["bestOf"] = readBestOf(reader)
+	case "2":
+		challengesMu.Lock()
+		pending := slices.Clone(challenges)
+		challengesMu.Unlock()
+		if len(pending) == 0 {
+			fmt.Println("Nenhum desafio esperando resposta.")
+			time.Sleep(1 * time.Second)
+			return
+		}
+		for i, c := range pending {
+			fmt.Printf("%d. %s (%s)\n", i+1, c.From, c.Ruleset)
+		}
+		fmt.Print("Número do desafio: ")
+		line, _ := reader.ReadString('\n')
+		choice, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil || choice < 1 || choice > len(pending) {
+			return
+		}
+		fmt.Print("Aceitar? (s/n): ")
+		answer, _ := reader.ReadString('\n')
+		kind = answerch
+		request["challenge"] = pending[choice-1].ID
+		request["accept"] = strings.EqualFold(strings.TrimSpace(answer), "s")
+		challengesMu.Lock()
+		challenges = slices.DeleteFunc(challenges, func(c ChallengeInfo) bool { return c.ID == pending[choice-1].ID })
+		challengesMu.Unlock()
+	case "3":
+		fmt.Print("Ruleset (ex: classico, rapido, pesadelo, lucido, roda, duplas) ou Enter para o padrão: ")
+		ruleset, _ := reader.ReadString('\n')
+		kind = newlobby
+		request["ruleset"] = strings.TrimSpace(ruleset)
+		request["bestOf"] = readBestOf(reader)
+	case "4":
+		fmt.Print("Código da partida: ")
+		code, _ := reader.ReadString('\n')
+		kind = joinlobby
+		request["code"] = strings.TrimSpace(code)
+	case "5":
+		kind = endlobby
+	default:
+		return
+	}
+
+	data, _ := json.Marshal(request)
+	enc.Encode(Message{Request: kind, UID: uid, Data: data})
+	time.Sleep(500 * time.Millisecond) // dá tempo de ver a resposta antes do menu limpar a tela
+}
+
+// assiste uma partida até ela acabar ou o jogador apertar Enter
+func handleSpectate(reader *bufio.Reader) {
+	fmt.Print("ID da partida ou nome de um dos jogadores: ")
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
+
+	request := map[string]any{"UID": uid}
+	if id, err := strconv.Atoi(input); err == nil {
+		request["match"] = id
+	} else {
+		request["username"] = input
+	}
+	data, _ := json.Marshal(request)
+
+	// descarta um aviso velho antes de pedir
+	select {
+	case <-spectateSignal:
+	default:
+	}
+	spectating = true
+	enc.Encode(Message{Request: spectate, UID: uid, Data: data})
+
+	// espera a confirmação (ou o erro) do servidor
+	select {
+	case ok := <-spectateSignal:
+		if !ok {
+			spectating = false
+			time.Sleep(1500 * time.Millisecond) // dá tempo de ler o erro
+			return
+		}
+	case <-time.After(2 * time.Second):
+		fmt.Println("⏰ servidor não respondeu")
+		spectating = false
+		return
+	}
+
+	reader.ReadString('\n') // Enter sai
+	if spectating {
+		data, _ = json.Marshal(map[string]string{"UID": uid})
+		enc.Encode(Message{Request: leavespec, UID: uid, Data: data})
+	}
+	spectating = false
+}
+
+// mensagens de quem está assistindo; devolve false para as que não são da partida
+func handleSpectatorMessage(msg Message) bool {
+	switch msg.Request {
+	case spectatingr:
+		var payload struct {
+			Match   int
+			Players []string
+			Delay   int
+		}
+		json.Unmarshal(msg.Data, &payload)
+		fmt.Printf("👀 Assistindo a partida %d (%s), com %d segundos de atraso. Enter para sair.\n", payload.Match, strings.Join(payload.Players, " x "), payload.Delay)
+		spectateSignal <- true
+	case gamestart:
+		var payload struct {
+			Info        string
+			Ruleset     Ruleset
+			Turn        string
+			Order       []string
+			Players     map[string]string
+			Teams       map[string]int
+			Sanity      map[string]int
+			DreamStates map[string]DreamState
+			HandSizes   map[string]int
+			Round       int
+			Series      *Series
+		}
+		json.Unmarshal(msg.Data, &payload)
+		matchMu.Lock()
+		matchInfo.Order = payload.Order
+		matchInfo.Players = payload.Players
+		matchInfo.Teams = payload.Teams
+		matchInfo.Eliminated = nil
+		matchInfo.Ruleset = payload.Ruleset
+		matchInfo.Sanity = payload.Sanity
+		matchInfo.DreamStates = payload.DreamStates
+		matchInfo.HandSizes = payload.HandSizes
+		matchInfo.Round = payload.Round
+		matchInfo.CurrentTurnUID = payload.Turn
+		matchMu.Unlock()
+
+		fmt.Printf("⚔️ %s\n", payload.Info)
+		printRuleset(payload.Ruleset)
+		if series := payload.Series; series != nil && (series.BestOf > 0 || series.Games > 0) {
+			printSeries(series)
+		}
+		printSpectatorStatus()
+	case newturn:
+		var payload struct {
+			Turn string
+		}
+		json.Unmarshal(msg.Data, &payload)
+		matchMu.Lock()
+		matchInfo.CurrentTurnUID = payload.Turn
+		matchMu.Unlock()
+		fmt.Printf("\n➡️ Turno de %s\n", playerName(payload.Turn))
+	case updateinfo:
+		var payload struct {
+			Sanity      map[string]int
+			DreamStates map[string]DreamState
+			Round       int
+			HandSizes   map[string]int
+			Eliminated  map[string]bool
+		}
+		json.Unmarshal(msg.Data, &payload)
+		matchMu.Lock()
+		matchInfo.Eliminated = payload.Eliminated
+		matchInfo.Sanity = payload.Sanity
+		matchInfo.DreamStates = payload.DreamStates
+		matchInfo.Round = payload.Round
+		matchInfo.HandSizes = payload.HandSizes
+		matchMu.Unlock()
+		printSpectatorStatus()
+	case cardused:
+		var payload CardUsed
+		json.Unmarshal(msg.Data, &payload)
+		printCardUsed(payload)
+	case gameevent:
+		var event GameEvent
+		json.Unmarshal(msg.Data, &event)
+		printGameEvent(event)
+	case notify:
+		var payload struct {
+			Message string
+		}
+		json.Unmarshal(msg.Data, &payload)
+		fmt.Printf("📣 %s\n", payload.Message)
+	case matchended:
+		fmt.Println("\n🏁 A partida acabou!")
+		printSummary(msg.Data)
+		fmt.Println("Enter para voltar ao menu.")
+		spectating = false
+	case spectateleft:
+	case "erro":
+		// erro do spectate: avisa o handleSpectate depois de mostrar
+		handleResponse(msg)
+		select {
+		case spectateSignal <- false:
+		default:
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// sanidade, estado e mão de cada jogador da partida assistida
+func printSpectatorStatus() {
 	matchMu.RLock()
 	defer matchMu.RUnlock()
-	for id := range matchInfo.Sanity {
-		if id != uid {
-			return id
+
+	fmt.Printf("\n--- Rodada %d ---\n", matchInfo.Round)
+	for _, id := range slices.Sorted(maps.Keys(matchInfo.Players)) {
+		name := matchInfo.Players[id]
+		if team, ok := matchInfo.Teams[id]; ok {
+			name += fmt.Sprintf(" (time %d)", team+1)
 		}
+		if matchInfo.Eliminated[id] {
+			fmt.Printf("%s: eliminado\n", name)
+			continue
+		}
+		fmt.Printf("%s: sanidade %d (%s), %d cartas na mão\n", name, matchInfo.Sanity[id], strings.Title(string(matchInfo.DreamStates[id])), matchInfo.HandSizes[id])
 	}
-	return ""
+}
+
+// lista os últimos replays e baixa o escolhido
+func handleReplays(reader *bufio.Reader) {
+	data, _ := json.Marshal(map[string]string{
+		"UID": uid,
+	})
+	enc.Encode(Message{Request: getreplay, UID: uid, Data: data})
+
+	select {
+	case <-replaySignal:
+	case <-time.After(2 * time.Second):
+		fmt.Println("⏰ servidor não respondeu")
+		return
+	}
+
+	if len(replays) == 0 {
+		fmt.Println("Nenhuma partida gravada ainda.")
+		return
+	}
+
+	fmt.Println("\n--- Últimas partidas ---")
+	for i, info := range replays {
+		names := make([]string, len(info.Players))
+		for j, player := range info.Players {
+			names[j] = player.Username
+		}
+		result := "sem resultado"
+		if info.Result != nil {
+			result = endReasons[info.Result.Reason]
+			switch {
+			case len(info.Result.Winners) == 0:
+				result += ", empate"
+			case slices.Contains(info.Result.Winners, uid):
+				result += ", vitória"
+			default:
+				result += ", derrota"
+			}
+		}
+		fmt.Printf("%d. %s | %s | %s | %s\n", i+1, info.Started.Local().Format("02/01 15:04"), strings.Join(names, " x "), info.Ruleset, result)
+	}
+
+	fmt.Print("Número do replay para baixar (Enter para voltar): ")
+	input, _ := reader.ReadString('\n')
+	choice, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || choice < 1 || choice > len(replays) {
+		return
+	}
+
+	data, _ = json.Marshal(map[string]string{
+		"UID":    uid,
+		"replay": replays[choice-1].ID,
+	})
+	enc.Encode(Message{Request: getreplay, UID: uid, Data: data})
+	time.Sleep(500 * time.Millisecond) // dá tempo de salvar antes do menu limpar a tela
+}
+
+// pede o inventário ao servidor e espera a resposta
+func requestInventory() {
+	data, _ := json.Marshal(map[string]string{
+		"UID": uid,
+	})
+	req := Message{
+		Request: getinv,
+		UID:     uid,
+		Data:    data,
+	}
+	enc.Encode(req)
+
+	select {
+	case <-invSignal:
+	case <-time.After(2 * time.Second):
+		fmt.Println("⏰ servidor não respondeu, mostrando inventário local")
+	}
+}
+
+// nome da coleção para mostrar junto da carta
+func setLabel(code string) string {
+	invMu.RLock()
+	defer invMu.RUnlock()
+	return setLabelLocked(code)
+}
+
+// mesma coisa, mas para quem já segura o invMu
+func setLabelLocked(code string) string {
+	if code == "" {
+		return "?"
+	}
+	if set, ok := cardSets[code]; ok {
+		return fmt.Sprintf("%s (%s)", set.Name, code)
+	}
+	return code
 }
 
 // função que mostra inventário
@@ -528,6 +2029,7 @@ func printInventory() {
 			}
 		}
 		fmt.Printf(" Raridade: %s\n", strings.Title(string(c.CardRarity)))
+		fmt.Printf(" Coleção: %s\n", setLabelLocked(c.Set))
 		fmt.Printf(" Efeito: %s\n", strings.Title(string(c.CardEffect)))
 		fmt.Printf(" Descrição: %s\n", strings.Title(c.Desc))
 		fmt.Println(strings.Repeat("-", 40))
@@ -537,6 +2039,34 @@ func printInventory() {
 
 }
 
+// mostra as regras da partida
+func printRuleset(r Ruleset) {
+	fmt.Printf("📜 Ruleset: %s", r.Name)
+	if r.Description != "" {
+		fmt.Printf(" - %s", r.Description)
+	}
+	fmt.Println()
+	fmt.Printf(" Sanidade inicial: %d | Cartas na mão: %d | Compra por turno: %d | Tempo por turno: %ds\n", r.StartingSanity, r.HandSize, r.DrawPerTurn, r.TurnTimeout)
+	if c := r.Compensation; c.Sanity > 0 || c.Cards > 0 || c.Conscious {
+		fmt.Printf(" Compensação de quem não começa: +%d sanidade, +%d carta(s)", c.Sanity, c.Cards)
+		if c.Conscious {
+			fmt.Print(", começa consciente")
+		}
+		fmt.Println()
+	}
+	if r.Mulligan {
+		fmt.Printf(" Mulligan: pode trocar cartas da mão inicial uma vez (%ds)\n", r.MulliganTimeout)
+	}
+	fmt.Printf(" Adormecido: -%d/rodada | Consciente: +%d/rodada (%d rodadas)\n", r.SleepyDrain, r.ConsciousRegen, r.ConsciousRounds)
+	fmt.Printf(" Assustado: -%d/rodada (%d rodadas) | Paralisado: %d rodada(s)\n", r.ScaredDrain, r.ScaredRounds, r.ParalyzedRounds)
+	for state, lock := range r.StateLocks {
+		fmt.Printf(" Imunidade: depois de %s, imune a %v por %d rodada(s)\n", state, lock.States, lock.Rounds)
+	}
+	if l := r.Lucidity; l != nil {
+		fmt.Printf(" Lucidez: começa em %d, +%d por turno até %d; cartas custam lucidez e dá para jogar várias por turno\n", l.Starting, l.Growth, l.Max)
+	}
+}
+
 func printHand() {
 	matchMu.RLock()
 	defer matchMu.RUnlock()
@@ -547,7 +2077,11 @@ func printHand() {
 	}
 	fmt.Println(strings.Repeat("=", 40))
 	for i, c := range hand {
-		fmt.Printf("%d) %s (Tipo: %s, Pontos: %d, Efeito: %s)\n", i+1, c.Name, c.CardType, c.Points, c.CardEffect)
+		if matchInfo.Ruleset.Lucidity != nil {
+			fmt.Printf("%d) %s (Custo: %d, Tipo: %s, Pontos: %d, Efeito: %s, Coleção: %s)\n", i+1, c.Name, c.Cost, c.CardType, c.Points, c.CardEffect, setLabel(c.Set))
+			continue
+		}
+		fmt.Printf("%d) %s (Tipo: %s, Pontos: %d, Efeito: %s, Coleção: %s)\n", i+1, c.Name, c.CardType, c.Points, c.CardEffect, setLabel(c.Set))
 	}
 	fmt.Println(strings.Repeat("=", 40))
 }
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"pbl-redes/engine"
+)
+
+// bots do servidor: completam a partida de quem esperou demais na fila
+// (botAfter da fila) ou jogam o treino (practice) contra o nível escolhido
+// (os níveis ficam em aiLevels.go)
+// o bot é um User sem conexão; na partida ele ganha um aiSeat no lugar do
+// encoder da conexão, então recebe as mesmas mensagens que um jogador e
+// responde pelo inbox, como os handlers fazem para quem está na rede
+// partida com bot não vale rating nem entra nas estatísticas
+
+// quanto o bot "pensa" antes de responder (dá tempo do oponente ver a jogada)
+const botThinkTime = 1500 * time.Millisecond
+
+// bot novo (com mm.mu travado); joga com uma cópia do deck de quem ele
+// enfrenta, para a partida ficar parelha
+func (mm *MatchManager) newBot(rival *User, level string) *User {
+	mm.nextBot++
+	return &User{
+		UID:      fmt.Sprintf("bot-%d", mm.nextBot),
+		Username: fmt.Sprintf("Bot %d (%s)", mm.nextBot, level),
+		Deck:     slices.Clone(rival.Deck),
+		Rating:   StartingRating,
+		IsBot:    true,
+		BotLevel: level,
+	}
+}
+
+// treino: partida na hora contra bots do nível escolhido, fora do rating e
+// das estatísticas como toda partida com bot
+func (mm *MatchManager) StartPractice(p *User, ruleset Ruleset, level string) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if p.IsInBattle {
+		return errors.New("player já está em jogo")
+	}
+	if err := ruleset.checkDeck(p); err != nil {
+		return err
+	}
+
+	players := []*User{p}
+	for len(players) < ruleset.PlayerCount() {
+		players = append(players, mm.newBot(p, level))
+	}
+	series := mm.newSeries(players, 0, false)
+	series.Practice = true
+	mm.startMatch(players, ruleset, series)
+	return nil
+}
+
+// lugar do bot na partida; as escolhas dele saem da seed da partida
+func newAISeat(m *Match, bot *User) *aiSeat {
+	return &aiSeat{user: bot, match: m, rng: rand.New(rand.NewSource(deriveSeed(m.Seed, bot.UID)))}
+}
+
+// a partida tem bot?
+func (m *Match) hasBots() bool {
+	return slices.ContainsFunc(m.Players, func(p *User) bool { return p.IsBot })
+}
+
+// jogadores de verdade da partida
+func (m *Match) humans() []*User {
+	return slices.DeleteFunc(slices.Clone(m.Players), func(p *User) bool { return p.IsBot })
+}
+
+// UIDs dos bots da partida
+func (m *Match) botUIDs() []string {
+	var uids []string
+	for _, p := range m.Players {
+		if p.IsBot {
+			uids = append(uids, p.UID)
+		}
+	}
+	return uids
+}
+
+// recebe uma mensagem da partida (é o io.Writer do encoder do bot)
+// quem escreve é a goroutine da partida: a resposta sai em outra goroutine,
+// senão o bot travaria a partida esperando o inbox
+func (seat *aiSeat) Write(data []byte) (int, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return len(data), nil
+	}
+
+	switch msg.Request {
+	case gamestart:
+		if seat.match.Ruleset.Mulligan {
+			go seat.respond(seat.mulligan)
+		}
+	case newturn:
+		var payload struct {
+			Turn string `json:"turn"`
+		}
+		json.Unmarshal(msg.Data, &payload)
+		if payload.Turn == seat.user.UID {
+			go seat.respond(seat.play)
+		}
+	case cardused:
+		// com lucidez o turno continua depois da carta
+		var used CardUsed
+		json.Unmarshal(msg.Data, &used)
+		if seat.match.Ruleset.Lucidity != nil && used.Player == seat.user.UID && !used.Reaction {
+			go seat.respond(seat.play)
+		}
+	case reactionwindow:
+		go seat.respond(seat.react)
+	case "erro":
+		// a partida recusou a resposta (o estado mudou enquanto ele pensava):
+		// tenta de novo sem o nível, em vez de esperar o tempo do turno acabar
+		go seat.respond(seat.retry)
+	case rematchoffer:
+		// bot sempre topa revanche
+		go seat.respond(func(engine.State) (string, any) { return "rematch", map[string]bool{"accept": true} })
+	}
+	//fmt.Printf("DEBUG: %s recebeu %s\n", seat.user.Username, msg.Request)
+	return len(data), nil
+}
+
+// pensa um pouco, olha a partida como ela está agora e manda a resposta
+// (se tiver) pelo inbox
+func (seat *aiSeat) respond(decide func(engine.State) (string, any)) {
+	time.Sleep(botThinkTime)
+
+	m := seat.match
+	m.mu.Lock()
+	game := m.game.Clone()
+	m.mu.Unlock()
+
+	seat.mu.Lock()
+	action, payload := decide(game)
+	seat.mu.Unlock()
+	if action == "" {
+		return
+	}
+
+	data, _ := json.Marshal(payload)
+	select {
+	case m.inbox <- matchMsg{PlayerUID: seat.user.UID, Action: action, Data: data}:
+	case <-time.After(1 * time.Second):
+	}
+}
+
+// fica com a mão
+func (seat *aiSeat) mulligan(game engine.State) (string, any) {
+	if game.Phase != engine.PhaseMulligan || game.Mulliganed[seat.user.UID] {
+		return "", nil
+	}
+	return "mulligan", map[string][]string{"cards": {}}
+}
+
+// joga a carta que o nível escolher; sem nenhuma, acaba (ou passa) o turno
+func (seat *aiSeat) play(game engine.State) (string, any) {
+	uid := seat.user.UID
+	if !seat.myTurn(game) {
+		return "", nil
+	}
+
+	action, ok := choosePlay(seat.user.BotLevel, game, uid, seat.rng)
+	if !ok {
+		action = engine.Action{Type: engine.EndTurn, Player: uid}
+	}
+	return playMessage(checkPlay(game, uid, action))
+}
+
+// reage (ou passa) como o nível escolher; reação que a engine recusa vira passe
+func (seat *aiSeat) react(game engine.State) (string, any) {
+	uid := seat.user.UID
+	if len(game.Stack) == 0 || game.Stack[len(game.Stack)-1].Target != uid {
+		return "", nil
+	}
+
+	action := chooseReaction(seat.user.BotLevel, game, uid, seat.rng)
+	if _, _, err := engine.Apply(game, action); err != nil {
+		return "react", map[string]string{"card": ""}
+	}
+	return "react", map[string]string{"card": action.CardID}
+}
+
+// depois de uma resposta recusada: passa a janela de reação ou joga a
+// primeira jogada que vale (sem nenhuma, acaba o turno)
+func (seat *aiSeat) retry(game engine.State) (string, any) {
+	uid := seat.user.UID
+	if len(game.Stack) > 0 {
+		if game.Stack[len(game.Stack)-1].Target == uid {
+			return "react", map[string]string{"card": ""}
+		}
+		return "", nil
+	}
+	if !seat.myTurn(game) {
+		return "", nil
+	}
+	return playMessage(fallbackPlay(game, uid))
+}
+
+// é a vez do bot jogar uma carta?
+func (seat *aiSeat) myTurn(game engine.State) bool {
+	return !game.Finished && game.Phase == engine.PhasePlaying && game.Turn == seat.user.UID && len(game.Stack) == 0 && !game.MustSkip()
+}
+
+// confere a escolha do nível na engine antes de mandar: se ela não vale (o
+// nível errou), fica com a primeira jogada que vale
+func checkPlay(game engine.State, uid string, action engine.Action) engine.Action {
+	if _, _, err := engine.Apply(game, action); err != nil {
+		fmt.Printf("%s: jogada %s %s recusada (%v), jogando outra\n", uid, action.Type, action.CardID, err)
+		return fallbackPlay(game, uid)
+	}
+	return action
+}
+
+// a primeira jogada que vale ou, sem nenhuma, o fim do turno
+func fallbackPlay(game engine.State, uid string) engine.Action {
+	if plays := legalPlays(game, uid); len(plays) > 0 {
+		return plays[0]
+	}
+	return engine.Action{Type: engine.EndTurn, Player: uid}
+}
+
+// mensagem da jogada para o inbox da partida
+func playMessage(action engine.Action) (string, any) {
+	if action.Type == engine.EndTurn {
+		return "endturn", nil
+	}
+	return "usecard", map[string]any{"card": Card{Instance: action.CardID}, "target": action.Target}
+}
+
+// cartas que o jogador pode jogar agora, uma ação para cada alvo possível
+// (a engine decide o que vale: lucidez, tipo da carta, alvo)
+func legalPlays(game engine.State, uid string) []engine.Action {
+	var plays []engine.Action
+	targets := append([]string{""}, game.Opponents(uid)...)
+	for _, card := range game.Hand[uid] {
+		for _, target := range targets {
+			action := engine.Action{Type: engine.PlayCard, Player: uid, CardID: card.Instance, Target: target}
+			if _, _, err := engine.Apply(game, action); err == nil {
+				plays = append(plays, action)
+				if target == "" {
+					break // sem escolha de alvo (pílula ou oponente único)
+				}
+			}
+		}
+	}
+	return plays
+}
+
+// reações que o jogador pode usar na carta da pilha
+func legalReactions(game engine.State, uid string) []engine.Action {
+	var reactions []engine.Action
+	for _, card := range game.Hand[uid] {
+		action := engine.Action{Type: engine.React, Player: uid, CardID: card.Instance}
+		if _, _, err := engine.Apply(game, action); err == nil {
+			reactions = append(reactions, action)
+		}
+	}
+	return reactions
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+
+	"pbl-redes/engine"
+)
+
+// níveis dos bots
+// fácil: uma jogada qualquer das que a engine aceita
+// médio: a jogada que mais ganha sanidade (do lado dele) menos a dos
+// oponentes, logo depois de resolver
+// difícil: procura na engine: testa as jogadas (com lucidez, sequências de
+// até aiSearchDepth cartas), simula a partida até a próxima vez dele, com os
+// outros jogando e reagindo como o médio, e avalia sanidade e eliminações
+// nenhum nível olha a mão dos outros: na simulação do difícil eles jogam com
+// uma cópia da mão do bot (o bot joga com uma cópia do deck de quem ele
+// enfrenta, então a própria mão é um bom palpite do que eles podem ter); a
+// ordem das pilhas ele também não vê (veja o hide)
+const (
+	aiEasy   = "facil"
+	aiMedium = "medio"
+	aiHard   = "dificil"
+)
+
+var aiLevels = []string{aiEasy, aiMedium, aiHard}
+
+// nível de quem não escolhe (fila sem botLevel, treino sem level)
+const defaultAILevel = aiMedium
+
+const (
+	aiSearchDepth    = 3    // cartas seguidas que o difícil testa num turno com lucidez
+	aiSearchRollouts = 300  // simulações por jogada do difícil (divididas entre as opções)
+	aiOutValue       = 100  // jogador eliminado
+	aiWinValue       = 1000 // partida ganha
+)
+
+// confere o nível (vazio = o padrão)
+func parseAILevel(level string) (string, error) {
+	if level == "" {
+		return defaultAILevel, nil
+	}
+	if !slices.Contains(aiLevels, level) {
+		return "", fmt.Errorf("nível %s não existe (use %s, %s ou %s)", level, aiEasy, aiMedium, aiHard)
+	}
+	return level, nil
+}
+
+// escolhe a jogada do turno; EndTurn quando o melhor é parar (só com lucidez)
+// false = nenhuma jogada possível
+func choosePlay(level string, game engine.State, uid string, rng *rand.Rand) (engine.Action, bool) {
+	plays := legalPlays(game, uid)
+	if len(plays) == 0 {
+		return engine.Action{}, false
+	}
+
+	switch level {
+	case aiEasy:
+		return plays[rng.Intn(len(plays))], true
+	case aiMedium:
+		// com lucidez parar também é uma opção (o fim do turno aplica os estados)
+		if game.Rules.Lucidity != nil {
+			plays = append(plays, engine.Action{Type: engine.EndTurn, Player: uid})
+		}
+		return best(plays, rng, func(play engine.Action) int {
+			return sanityBalance(settle(apply(game, play)), uid) - sanityBalance(game, uid)
+		}), true
+	}
+
+	action, _ := searchPlay(hide(game, rng), uid, game.Hand[uid], aiSearchDepth, aiSearchRollouts, rng)
+	return action, true
+}
+
+// escolhe entre reagir (com qual reação) e passar
+func chooseReaction(level string, game engine.State, uid string, rng *rand.Rand) engine.Action {
+	options := append(legalReactions(game, uid), engine.Action{Type: engine.Pass, Player: uid})
+
+	switch level {
+	case aiEasy:
+		return options[rng.Intn(len(options))]
+	case aiMedium:
+		return best(options, rng, func(option engine.Action) int {
+			return sanityBalance(apply(game, option), uid)
+		})
+	}
+	game = hide(game, rng)
+	return best(options, rng, func(option engine.Action) int {
+		return evaluate(rollout(apply(game, option), uid, game.Hand[uid], rng), uid)
+	})
+}
+
+// o que o difícil pode saber antes de simular: as cartas das pilhas sim, a
+// ordem delas e o gerador da engine não (senão ele via as próximas compras,
+// as dele e as dos outros); as pilhas são embaralhadas e o gerador ganha
+// outra semente, as duas coisas com o rng do bot
+func hide(game engine.State, rng *rand.Rand) engine.State {
+	game = game.Clone()
+	for _, uid := range game.Players {
+		library := game.Library[uid]
+		rng.Shuffle(len(library), func(i, j int) { library[i], library[j] = library[j], library[i] })
+	}
+	game.Random = rng.Uint64()
+	return game
+}
+
+// melhor jogada do difícil e a nota dela
+// com lucidez cada carta pode vir seguida de outras (ou de EndTurn); sem
+// lucidez a carta acaba o turno
+// budget é quantas simulações (rollouts) a busca pode fazer, dividido por
+// igual entre as opções; quando a parte de uma opção não dá para ir mais
+// fundo, ela é avaliada com uma simulação só
+func searchPlay(game engine.State, uid string, hand []Card, depth, budget int, rng *rand.Rand) (engine.Action, int) {
+	options := uniquePlays(game, legalPlays(game, uid))
+	if game.Rules.Lucidity != nil {
+		if depth == 0 {
+			options = nil
+		}
+		options = append(options, engine.Action{Type: engine.EndTurn, Player: uid})
+	}
+
+	share := budget / len(options)
+	scores := make(map[int]int, len(options))
+	for i, option := range options {
+		next := answer(apply(game, option), uid, hand, rng)
+		if option.Type == engine.PlayCard && !next.Finished && next.Turn == uid && game.Rules.Lucidity != nil && share > 1 {
+			_, scores[i] = searchPlay(next, uid, hand, depth-1, share, rng)
+			continue
+		}
+		scores[i] = evaluate(rollout(next, uid, hand, rng), uid)
+	}
+
+	indexes := make([]int, len(options))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	i := best(indexes, rng, func(i int) int { return scores[i] })
+	return options[i], scores[i]
+}
+
+// a opção de maior nota (empate sorteado)
+func best[T any](options []T, rng *rand.Rand, score func(T) int) T {
+	var top []T
+	topScore := 0
+	for _, option := range options {
+		s := score(option)
+		switch {
+		case len(top) == 0 || s > topScore:
+			top, topScore = []T{option}, s
+		case s == topScore:
+			top = append(top, option)
+		}
+	}
+	return top[rng.Intn(len(top))]
+}
+
+// uma jogada por carta igual (mesmo CID) e alvo: cópias dão no mesmo
+func uniquePlays(game engine.State, plays []engine.Action) []engine.Action {
+	cids := make(map[string]string)
+	for _, hand := range game.Hand {
+		for _, card := range hand {
+			cids[card.Instance] = card.CID
+		}
+	}
+
+	var unique []engine.Action
+	seen := make(map[string]bool)
+	for _, play := range plays {
+		key := cids[play.CardID] + "/" + play.Target
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, play)
+		}
+	}
+	return unique
+}
+
+// aplica uma ação que já se sabe válida
+func apply(game engine.State, action engine.Action) engine.State {
+	next, _, err := engine.Apply(game, action)
+	if err != nil {
+		return game
+	}
+	return next
+}
+
+// resolve a carta que ficou na pilha, sem reação
+func settle(game engine.State) engine.State {
+	if len(game.Stack) == 0 || game.Finished {
+		return game
+	}
+	return apply(game, engine.Action{Type: engine.Pass, Player: game.Stack[len(game.Stack)-1].Target})
+}
+
+// quem está na mira da carta da pilha reage como o médio: uid com a mão
+// dele, os outros com hand no lugar da mão deles
+func answer(game engine.State, uid string, hand []Card, rng *rand.Rand) engine.State {
+	if len(game.Stack) == 0 || game.Finished {
+		return game
+	}
+	defender := game.Stack[len(game.Stack)-1].Target
+	if defender != uid {
+		game = game.Clone()
+		game.Hand[defender] = slices.Clone(hand)
+	}
+	return apply(game, chooseReaction(aiMedium, game, defender, rng))
+}
+
+// segue a partida até a próxima vez de uid: os outros jogam a carta que o
+// médio escolheria, com hand (a mão de uid quando ele começou a pensar) no
+// lugar da mão deles
+func rollout(game engine.State, uid string, hand []Card, rng *rand.Rand) engine.State {
+	for step := 0; step <= 2*len(game.Players) && !game.Finished; step++ {
+		if len(game.Stack) > 0 {
+			game = answer(game, uid, hand, rng)
+			continue
+		}
+		if game.Turn == uid || game.Eliminated[uid] {
+			break
+		}
+		game = guessTurn(game, uid, hand, rng)
+	}
+	return game
+}
+
+// o turno do jogador da vez, com hand no lugar da mão dele
+func guessTurn(game engine.State, uid string, hand []Card, rng *rand.Rand) engine.State {
+	other := game.Turn
+	skip := engine.Action{Type: engine.SkipTurn, Player: other, Reason: engine.SkipParalyzed}
+	if game.MustSkip() {
+		return apply(game, skip)
+	}
+
+	guess := game.Clone()
+	guess.Hand[other] = slices.Clone(hand)
+	plays := uniquePlays(guess, legalPlays(guess, other))
+	if len(plays) == 0 {
+		return apply(game, skip)
+	}
+
+	play := best(plays, rng, func(play engine.Action) int {
+		return sanityBalance(settle(apply(guess, play)), other)
+	})
+	next := answer(apply(guess, play), uid, hand, rng)
+	if !next.Finished && next.Turn == other {
+		// com lucidez o turno só acaba com EndTurn
+		next = apply(next, engine.Action{Type: engine.EndTurn, Player: other})
+	}
+	return next
+}
+
+// sanidade do lado de uid menos a dos oponentes
+func sanityBalance(game engine.State, uid string) int {
+	balance := 0
+	for _, other := range game.Players {
+		if game.Allies(uid, other) {
+			balance += game.Sanity[other]
+		} else {
+			balance -= game.Sanity[other]
+		}
+	}
+	return balance
+}
+
+// nota da partida para o lado de uid: fim de jogo, eliminações e sanidade
+// (os estados de sonho já aparecem na sanidade: a simulação passa pelos
+// turnos em que eles são aplicados)
+func evaluate(game engine.State, uid string) int {
+	if game.Finished {
+		// a sanidade desempata: perdendo de qualquer jeito, melhor perder de
+		// perto (a simulação pode estar errada sobre a mão dos outros)
+		switch {
+		case len(game.Result.Winners) == 0:
+			return sanityBalance(game, uid)
+		case game.IsWinner(uid):
+			return aiWinValue + sanityBalance(game, uid)
+		default:
+			return -aiWinValue + sanityBalance(game, uid)
+		}
+	}
+
+	score := 0
+	for _, other := range game.Players {
+		value := aiOutValue
+		if !game.Eliminated[other] {
+			value = -game.Sanity[other]
+		}
+		if game.Allies(uid, other) {
+			value = -value
+		}
+		score += value
+	}
+	return score
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"pbl-redes/engine"
+)
+
+// partida de dois em que o bot começa, com decks de NREM de custo 1
+func testBotGame(rules engine.Rules) engine.State {
+	decks := make(map[string][]Card, 2)
+	for _, uid := range []string{"bot", "humano"} {
+		for i := 0; i < 12; i++ {
+			decks[uid] = append(decks[uid], Card{CID: fmt.Sprintf("T_%s_%02d", uid, i), CardType: NREM, CardEffect: NEN, Points: 1, Cost: 1})
+		}
+	}
+	return engine.Start(engine.Setup{Rules: rules, Seed: 1, Players: []string{"bot", "humano"}, First: "bot", Decks: decks})
+}
+
+func TestCheckPlay(t *testing.T) {
+	lucid := engine.DefaultRules()
+	lucid.Lucidity = &engine.Lucidity{Starting: 3, Growth: 1, Max: 6}
+
+	tests := []struct {
+		name  string
+		rules engine.Rules
+		// muda a partida depois que o difícil escolheu, deixando a escolha
+		// dele inválida na partida de verdade
+		change func(game *engine.State, proposed engine.Action)
+		want   engine.ActionType // tipo da jogada que o bot acaba mandando
+	}{
+		{
+			name:  "carta que saiu da mão vira outra carta",
+			rules: engine.DefaultRules(),
+			change: func(game *engine.State, proposed engine.Action) {
+				hand := game.Hand["bot"]
+				for i, card := range hand {
+					if card.Instance == proposed.CardID {
+						game.Hand["bot"] = append(hand[:i:i], hand[i+1:]...)
+					}
+				}
+			},
+			want: engine.PlayCard,
+		},
+		{
+			name:  "sem lucidez para nenhuma carta acaba o turno",
+			rules: lucid,
+			change: func(game *engine.State, proposed engine.Action) {
+				game.Lucidity["bot"] = 0
+			},
+			want: engine.EndTurn,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := testBotGame(test.rules)
+			proposed, ok := choosePlay(aiHard, game, "bot", rand.New(rand.NewSource(1)))
+			if !ok || proposed.Type != engine.PlayCard {
+				t.Fatalf("o difícil não escolheu carta: %+v", proposed)
+			}
+
+			real := game.Clone()
+			test.change(&real, proposed)
+			if _, _, err := engine.Apply(real, proposed); err == nil {
+				t.Fatalf("a jogada do difícil continua valendo, o teste não prova nada")
+			}
+
+			got := checkPlay(real, "bot", proposed)
+			if got.Type != test.want {
+				t.Errorf("bot mandou %s, esperava %s", got.Type, test.want)
+			}
+			if _, _, err := engine.Apply(real, got); err != nil {
+				t.Errorf("a jogada de reserva também foi recusada: %v", err)
+			}
+		})
+	}
+}
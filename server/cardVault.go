@@ -1,195 +1,112 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"math"
+	"maps"
 	"math/rand"
-	"os"
-	"time"
-)
-
-const CARDS_PER_BOOSTER int = 5
-
-// inicializa as cartas do JSON no dicionário usando o cardDatabase
-// função MTO importante para tirar do arquivo cardsVault.json (base de dados das cartas) e trazer virtualizadas pro jogo
-func InitializeCardsFromJSON(filename string) (map[string]Card, error) {
-	file, error := os.ReadFile(filename)
-	if error != nil {
-		return nil, fmt.Errorf("erro ao ler arquivo: %v", error)
-	}
+	"slices"
 
-	// base de dados de cartas, definido no types
-	// cardDB contém um map de CID e cartas
-	var cardDB CardDatabase
-	error = json.Unmarshal(file, &cardDB)
-	if error != nil {
-		return nil, fmt.Errorf("erro ao deserializar JSON: %v", error)
-	}
+	"pbl-redes/cards"
+)
 
-	return cardDB.Cards, nil
-}
+const CARDS_PER_BOOSTER int = cards.CARDS_PER_BOOSTER
+const BOOSTERS_PER_SET int = 1000
 
 // criar cardVault
-func NewCardVault() *CardVault {
+// a seed alimenta o embaralhamento do estoque e o sorteio dos boosters
+func NewCardVault(seed int64) *CardVault {
 	return &CardVault{
+		Sets:            make(map[string]CardSet),
 		CardGlossary:    make(map[string]Card),
 		CardQuantity:    make(map[string]int),
 		Vault:           make(map[int]Booster),
 		BoosterQuantity: 0,
 		Total:           0,
-		Generator:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		Generator:       rand.New(rand.NewSource(seed)),
 	}
 }
 
+// devolve uma cópia dos metadados das coleções
+func (vault *CardVault) GetSets() map[string]CardSet {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	return maps.Clone(vault.Sets)
+}
+
 // função para verificar se está vazio
 func (vault *CardVault) IsEmpty() bool {
 	return len(vault.CardGlossary) == 0
 }
 
-// inicializa o vault com as cartas da base
-func (vault *CardVault) LoadCardsFromFile(filename string) error {
-	cards, error := InitializeCardsFromJSON(filename)
+// inicializa o vault com as cartas de todas as coleções do diretório
+func (vault *CardVault) LoadCardsFromDir(dir string) error {
+	sets, glossary, error := cards.InitializeCardSetsFromDir(dir)
 	if error != nil {
 		return error
 	}
 
-	vault.CardGlossary = cards // como já tem o database, cartas vem em dict normalmente ([CID]:card)
+	vault.Sets = sets
+	vault.CardGlossary = glossary // como já tem o database, cartas vem em dict normalmente ([CID]:card)
 
 	// inicializa quantidades zeradas
-	for cid := range cards {
+	for cid := range glossary {
 		vault.CardQuantity[cid] = 0
 	}
 
 	return nil
 }
 
-// calcula quantidade de cópias de cada carta
-// coloco a quantidade de boosters que quero
-// retorno: map com quantos
-func (vault *CardVault) calculateCardCopies(boostersCount int) map[string]int {
-	// conta cartas por tipo
-	remCards := []string{}
-	nremCards := []string{}
-	pillCards := []string{}
-
-	// acrescento cada CID nos slices de string contendo os CIDs
-	for cid, card := range vault.CardGlossary {
-		switch card.CardType {
-		case REM:
-			remCards = append(remCards, cid)
-		case NREM:
-			nremCards = append(nremCards, cid)
-		case Pill:
-			pillCards = append(pillCards, cid)
-		}
+// recarrega as coleções com o servidor rodando (disparado pelo admin)
+// a base nova só entra se passar inteira pela validação; partidas em andamento
+// não são afetadas porque as mãos guardam cópias próprias das cartas
+func (vault *CardVault) ReloadCardsFromDir(dir string) error {
+	sets, glossary, error := cards.InitializeCardSetsFromDir(dir)
+	if error != nil {
+		return error
 	}
 
-	totalCardsNeeded := boostersCount * CARDS_PER_BOOSTER
-
-	// faço a distribuição por raridade, considerando
-	// 50% das cartas são comuns
-	// 40% das cartas são incomuns
-	// 10% das cartas são raras
-	commonCards := int(float64(totalCardsNeeded) * 0.5)
-	uncommonCards := int(float64(totalCardsNeeded) * 0.4)
-	rareCards := int(float64(totalCardsNeeded) * 0.1)
-
-	copies := make(map[string]int) // map que contém quantidade de cada carta
-
-	// agora, calculo quantas cópias serão necessárias para cada carta
-	for cid, card := range vault.CardGlossary { // passo por cada carta no glossário
-		var neededCopies float64
-
-		switch card.CardRarity {
-		case Comum:
-			// divido as raridades proporcionalmente aos cardType
-			commonByType := float64(commonCards) / 3.0 // rem, nrem, pill
-			switch card.CardType {
-			case REM:
-				neededCopies = commonByType / float64(len(remCards))
-			case NREM:
-				neededCopies = commonByType / float64(len(nremCards))
-			case Pill:
-				neededCopies = commonByType / float64(len(pillCards))
-			}
-		case Incomum:
-			uncommonByType := float64(uncommonCards) / 3.0
-			switch card.CardType {
-			case REM:
-				neededCopies = uncommonByType / float64(len(remCards))
-			case NREM:
-				neededCopies = uncommonByType / float64(len(nremCards))
-			case Pill:
-				neededCopies = uncommonByType / float64(len(pillCards))
-			}
-		case Rara:
-			rareByType := float64(rareCards) / 3.0
-			switch card.CardType {
-			case REM:
-				neededCopies = rareByType / float64(len(remCards))
-			case NREM:
-				neededCopies = rareByType / float64(len(nremCards))
-			case Pill:
-				neededCopies = rareByType / float64(len(pillCards))
-			}
-		}
-
-		finalCopies := int(math.Round(neededCopies))
-
-		// garante pelo menos 1 cópia de cada carta
-		if neededCopies < 1 {
-			neededCopies = 1
-		}
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
 
-		copies[cid] = finalCopies
+	// guarda quanto ainda restava de cada coleção antes de trocar
+	remaining := make(map[string]int)
+	for _, booster := range vault.Vault {
+		remaining[booster.Set]++
 	}
 
-	// agora, verifica se o calculado realmente bate com a quantidade
-	totalCalculated := 0
-	for _, quantity := range copies {
-		totalCalculated += quantity
+	vault.Sets = sets
+	vault.CardGlossary = glossary
+	vault.CardQuantity = make(map[string]int)
+	for cid := range glossary {
+		vault.CardQuantity[cid] = 0
 	}
 
-	difference := totalCalculated - totalCardsNeeded
-
-	if difference > 0 {
-		// precisa remover cartas, então remove das que têm mais cópias
-		for i := 0; i < difference; i++ {
-			maxCopies := 1
-			maxCardID := ""
-
-			for cardID, quantity := range copies {
-				if quantity > maxCopies {
-					maxCopies = quantity
-					maxCardID = cardID
-				}
-			}
-
-			if maxCardID != "" {
-				copies[maxCardID]--
-			}
+	// o estoque que ainda não foi vendido é refeito com o glossário novo
+	// coleções novas entram com o estoque padrão
+	vault.Vault = make(map[int]Booster)
+	vault.BoosterQuantity = 0
+	vault.Total = 0
+	for _, code := range slices.Sorted(maps.Keys(sets)) {
+		count, existed := remaining[code]
+		if !existed {
+			count = BOOSTERS_PER_SET
+		}
+		if count == 0 {
+			continue
 		}
-	} else if difference < 0 {
-		// casoo precise adicionar, adiciona nas que têm menos cópias
-		for i := 0; i < -difference; i++ {
-			minCopies := math.MaxInt32
-			minCardID := ""
-
-			for cardID, quantity := range copies {
-				if quantity < minCopies {
-					minCopies = quantity
-					minCardID = cardID
-				}
-			}
-
-			if minCardID != "" {
-				copies[minCardID]++
-			}
+		if error := vault.createSetBoosters(code, count); error != nil {
+			return error
 		}
 	}
 
-	return copies
+	return nil
+}
+
+// calcula quantidade de cópias de cada carta de uma coleção
+// coloco a coleção e a quantidade de boosters que quero
+// retorno: map com quantos
+func (vault *CardVault) calculateCardCopies(setCode string, boostersCount int) map[string]int {
+	return cards.CalculateCardCopies(vault.CardGlossary, vault.Sets[setCode], boostersCount)
 }
 
 // crio um "pool" de cartas baseado nas cópias calculadas
@@ -197,7 +114,9 @@ func (vault *CardVault) calculateCardCopies(boostersCount int) map[string]int {
 func (vault *CardVault) createCardPool(copies map[string]int) []Card {
 	var pool []Card
 
-	for cid, quantity := range copies {
+	// ordem fixa para o embaralhamento depender só da seed
+	for _, cid := range slices.Sorted(maps.Keys(copies)) {
+		quantity := copies[cid]
 		card := vault.CardGlossary[cid]
 		for i := 0; i < quantity; i++ {
 			pool = append(pool, card)
@@ -209,14 +128,30 @@ func (vault *CardVault) createCardPool(copies map[string]int) []Card {
 	return pool
 }
 
-// cria os boosters
-func (vault *CardVault) createBoosters(boostersCount int) error {
+// cria os boosters de todas as coleções
+// (chamado na inicialização ou com vault.mu já travado)
+func (vault *CardVault) createBoosters(boostersPerSet int) error {
 	if vault.IsEmpty() {
 		return fmt.Errorf("CardVault não foi inicializado com cartas")
 	}
 
+	for _, code := range slices.Sorted(maps.Keys(vault.Sets)) {
+		if error := vault.createSetBoosters(code, boostersPerSet); error != nil {
+			return error
+		}
+	}
+
+	return nil
+}
+
+// cria os boosters de uma coleção
+func (vault *CardVault) createSetBoosters(setCode string, boostersCount int) error {
+	if _, exists := vault.Sets[setCode]; !exists {
+		return fmt.Errorf("coleção %s não existe", setCode)
+	}
+
 	// calculo quantas cópias de cada carta são necessárias
-	copies := vault.calculateCardCopies(boostersCount)
+	copies := vault.calculateCardCopies(setCode, boostersCount)
 
 	// crio o pool de cartas
 	cardPool := vault.createCardPool(copies)
@@ -228,8 +163,10 @@ func (vault *CardVault) createBoosters(boostersCount int) error {
 
 	// crio os boosters individualmente
 	for i := 0; i < boostersCount; i++ {
+		vault.nextBID++
 		booster := Booster{
-			BID:     i + 1,
+			BID:     vault.nextBID,
+			Set:     setCode,
 			Booster: make([]Card, 0, CARDS_PER_BOOSTER),
 		}
 
@@ -247,25 +184,38 @@ func (vault *CardVault) createBoosters(boostersCount int) error {
 			booster.Booster = append(booster.Booster, cardPool[j])
 		}
 
-		vault.Vault[i+1] = booster
+		vault.Vault[booster.BID] = booster
 	}
-	vault.BoosterQuantity = boostersCount
-	vault.Total = boostersCount * CARDS_PER_BOOSTER
+	vault.BoosterQuantity += boostersCount
+	vault.Total += boostersCount * CARDS_PER_BOOSTER
 
 	return nil
 }
 
 // remover um booster do estoque (para dar ao jogador)
-func (vault *CardVault) TakeBooster() (Booster, error) {
-	if vault.BoosterQuantity == 0 {
-		return Booster{}, fmt.Errorf("não há boosters disponíveis")
+// setCode vazio aceita booster de qualquer coleção
+func (vault *CardVault) TakeBooster(setCode string) (Booster, error) {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	if setCode != "" {
+		if _, exists := vault.Sets[setCode]; !exists {
+			return Booster{}, fmt.Errorf("coleção %s não existe", setCode)
+		}
 	}
 
-	// Pega um booster aleatório
+	// Pega um booster aleatório (da coleção pedida)
 	boosterIDs := make([]int, 0, len(vault.Vault))
-	for id := range vault.Vault {
-		boosterIDs = append(boosterIDs, id)
+	for id, booster := range vault.Vault {
+		if setCode == "" || booster.Set == setCode {
+			boosterIDs = append(boosterIDs, id)
+		}
+	}
+
+	if len(boosterIDs) == 0 {
+		return Booster{}, fmt.Errorf("não há boosters disponíveis")
 	}
+	slices.Sort(boosterIDs) // o sorteio só depende da seed, não da ordem do map
 
 	randomIndex := vault.Generator.Intn(len(boosterIDs))
 	boosterID := boosterIDs[randomIndex]
@@ -0,0 +1,65 @@
+// Package cards tem os tipos das cartas e das coleções, a leitura e a validação
+// dos arquivos de data/sets. É usado pelo servidor e pelo cardtool.
+package cards
+
+// quantidade de cartas em cada booster
+const CARDS_PER_BOOSTER int = 5
+
+type CardType string
+
+const (
+	REM  CardType = "rem"
+	NREM CardType = "nrem"
+	Pill CardType = "pill"
+
+	// reação: só pode ser jogada em resposta à carta do oponente, na janela
+	// de reação; precisa de "effects" (ver cancel e reflect)
+	Reaction CardType = "reacao"
+)
+
+type CardRarity string
+
+const (
+	Comum   CardRarity = "comum"
+	Incomum CardRarity = "incomum"
+	Rara    CardRarity = "rara"
+)
+
+type CardEffect string
+
+const (
+	AD   CardEffect = "adormecido"
+	CONS CardEffect = "consciente"
+	PAR  CardEffect = "paralisado"
+	AS   CardEffect = "assustado"
+	NEN  CardEffect = "nenhum"
+)
+
+type Card struct {
+	Name       string     `json:"name"`
+	CID        string     `json:"CID"`  // card ID
+	Desc       string     `json:"desc"` // descrição
+	CardType   CardType   `json:"cardtype"`
+	CardRarity CardRarity `json:"cardrarity"`
+	CardEffect CardEffect `json:"cardeffect"`
+	Points     int        `json:"points"`
+	Cost       int        `json:"cost,omitempty"`     // lucidez para jogar (só nos rulesets com lucidez)
+	Effects    []Effect   `json:"effects,omitempty"`  // se tiver, substitui points + cardeffect
+	Set        string     `json:"set,omitempty"`      // código da coleção (preenchido ao carregar)
+	Instance   string     `json:"instance,omitempty"` // cópia da carta numa partida (preenchido pela engine)
+}
+
+// metadados de uma coleção (expansão) de cartas
+type CardSet struct {
+	Code          string                 `json:"code"` // prefixo dos CIDs (ex: P1)
+	Name          string                 `json:"name"`
+	ReleaseDate   string                 `json:"releaseDate"` // AAAA-MM-DD
+	RarityWeights map[CardRarity]float64 `json:"rarityWeights"`
+}
+
+// struct pra base de dados local das cartas em json porem virtualizada
+// cada arquivo em data/sets é uma coleção
+type CardDatabase struct {
+	Set   CardSet         `json:"set"`
+	Cards map[string]Card `json:"cards"`
+}
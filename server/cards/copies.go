@@ -0,0 +1,123 @@
+package cards
+
+import (
+	"cmp"
+	"maps"
+	"math"
+	"slices"
+)
+
+// parte de cada tipo no estoque; reações são situacionais e saem na metade
+var typeShares = map[CardType]float64{REM: 1, NREM: 1, Pill: 1, Reaction: 0.5}
+
+// calcula quantidade de cópias de cada carta de uma coleção
+// coloco o glossário, a coleção e a quantidade de boosters que quero
+// retorno: map com quantos
+// (usado pelo servidor ao criar o estoque e pelo cardtool na prévia)
+func CalculateCardCopies(glossary map[string]Card, set CardSet, boostersCount int) map[string]int {
+	// só as cartas da coleção entram na conta, separadas por raridade e tipo
+	setCards := make(map[CardRarity]map[string]Card)
+	cardsByRarityType := make(map[CardRarity]map[CardType]int)
+	for cid, card := range glossary {
+		if card.Set != set.Code {
+			continue
+		}
+		if setCards[card.CardRarity] == nil {
+			setCards[card.CardRarity] = make(map[string]Card)
+			cardsByRarityType[card.CardRarity] = make(map[CardType]int)
+		}
+		setCards[card.CardRarity][cid] = card
+		cardsByRarityType[card.CardRarity][card.CardType]++
+	}
+
+	totalCardsNeeded := boostersCount * CARDS_PER_BOOSTER
+
+	// faço a distribuição por raridade usando os pesos da coleção
+	// (no P1: 50% comuns, 40% incomuns, 10% raras); raridade sem carta na
+	// coleção não leva nada, e a sobra do arredondamento vai para quem ficou
+	// mais perto da próxima cópia, então a prévia bate com os pesos
+	rarityWeights := make(map[CardRarity]float64)
+	for rarity := range setCards {
+		rarityWeights[rarity] = set.RarityWeights[rarity]
+	}
+	cardsByRarity := apportion(totalCardsNeeded, rarityWeights)
+
+	copies := make(map[string]int) // map que contém quantidade de cada carta
+
+	// dentro de cada raridade, cada tipo leva a sua parte (typeShares),
+	// dividida igualmente entre as cartas dele
+	for rarity, rarityCards := range setCards {
+		weights := make(map[string]float64, len(rarityCards))
+		for cid, card := range rarityCards {
+			weights[cid] = typeShares[card.CardType] / float64(cardsByRarityType[rarity][card.CardType])
+		}
+		maps.Copy(copies, apportion(cardsByRarity[rarity], weights))
+	}
+
+	// garante pelo menos 1 cópia de cada carta, tirando da que tem mais
+	// cópias na mesma raridade (assim a raridade continua com a parte dela);
+	// se ninguém da raridade tem cópia sobrando, tira da mais rica da coleção
+	for _, cid := range slices.Sorted(maps.Keys(copies)) {
+		if copies[cid] > 0 {
+			continue
+		}
+		donor, ok := richestCard(copies, func(other string) bool {
+			return glossary[other].CardRarity == glossary[cid].CardRarity
+		})
+		if !ok {
+			donor, ok = richestCard(copies, func(string) bool { return true })
+		}
+		if ok {
+			copies[donor]--
+			copies[cid]++
+		}
+	}
+
+	return copies
+}
+
+// carta com mais cópias (e pelo menos 2, para continuar com uma) entre as
+// que passam no filtro; empate pela ordem dos CIDs
+func richestCard(copies map[string]int, filter func(string) bool) (string, bool) {
+	richest := ""
+	for _, cid := range slices.Sorted(maps.Keys(copies)) {
+		if filter(cid) && copies[cid] > 1 && (richest == "" || copies[cid] > copies[richest]) {
+			richest = cid
+		}
+	}
+	return richest, richest != ""
+}
+
+// divide total entre as chaves proporcionalmente aos pesos: cada uma leva a
+// parte inteira e a sobra vai, uma por vez, para os maiores restos
+// (empate pela ordem das chaves, para a mesma coleção gerar sempre a mesma
+// distribuição, importante com seed fixa)
+func apportion[K cmp.Ordered](total int, weights map[K]float64) map[K]int {
+	keys := slices.Sorted(maps.Keys(weights))
+	shares := make(map[K]int, len(keys))
+
+	totalWeight := 0.0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	if totalWeight <= 0 {
+		return shares
+	}
+
+	remainders := make(map[K]float64, len(keys))
+	given := 0
+	for _, key := range keys {
+		exact := float64(total) * weights[key] / totalWeight
+		shares[key] = int(math.Floor(exact))
+		remainders[key] = exact - float64(shares[key])
+		given += shares[key]
+	}
+
+	slices.SortStableFunc(keys, func(a, b K) int {
+		return cmp.Compare(remainders[b], remainders[a])
+	})
+	for i := 0; i < total-given; i++ {
+		shares[keys[i%len(keys)]]++
+	}
+	return shares
+}
@@ -0,0 +1,86 @@
+package cards
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestApportion(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		weights map[string]float64
+		want    map[string]int
+	}{
+		{"divisão exata", 10, map[string]float64{"a": 0.5, "b": 0.4, "c": 0.1}, map[string]int{"a": 5, "b": 4, "c": 1}},
+		{"sobra vai para o maior resto", 10, map[string]float64{"a": 2, "b": 1}, map[string]int{"a": 7, "b": 3}},
+		{"empate pela ordem das chaves", 2, map[string]float64{"a": 1, "b": 1, "c": 1}, map[string]int{"a": 1, "b": 1, "c": 0}},
+		{"peso zero não leva nada", 5, map[string]float64{"a": 1, "b": 0}, map[string]int{"a": 5, "b": 0}},
+		{"sem peso nenhum", 5, map[string]float64{"a": 0}, map[string]int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := apportion(test.total, test.weights)
+			sum := 0
+			for key, share := range got {
+				sum += share
+				if share != test.want[key] {
+					t.Errorf("%s levou %d, esperava %d", key, share, test.want[key])
+				}
+			}
+			if len(test.want) > 0 && sum != test.total {
+				t.Errorf("distribuiu %d de %d", sum, test.total)
+			}
+		})
+	}
+}
+
+// coleção de teste: n cartas de cada tipo em cada raridade
+func testSet(n int) (CardSet, map[string]Card) {
+	set := CardSet{Code: "T", RarityWeights: map[CardRarity]float64{Comum: 0.5, Incomum: 0.4, Rara: 0.1}}
+	glossary := make(map[string]Card)
+	for _, rarity := range []CardRarity{Comum, Incomum, Rara} {
+		for _, cardType := range []CardType{REM, NREM, Pill} {
+			for i := 0; i < n; i++ {
+				cid := fmt.Sprintf("T_%s_%s_%d", cardType, rarity, i)
+				glossary[cid] = Card{CID: cid, CardType: cardType, CardRarity: rarity, Set: set.Code}
+			}
+		}
+	}
+	return set, glossary
+}
+
+func TestCalculateCardCopies(t *testing.T) {
+	set, glossary := testSet(2)
+
+	t.Run("segue os pesos da coleção", func(t *testing.T) {
+		copies := CalculateCardCopies(glossary, set, 100)
+		perRarity := make(map[CardRarity]int)
+		for cid, count := range copies {
+			perRarity[glossary[cid].CardRarity] += count
+		}
+		want := map[CardRarity]int{Comum: 250, Incomum: 200, Rara: 50}
+		for rarity, count := range want {
+			if perRarity[rarity] != count {
+				t.Errorf("%s com %d cópias, esperava %d", rarity, perRarity[rarity], count)
+			}
+		}
+	})
+
+	// 4 boosters = 20 cópias para 18 cartas: as raras (2 cópias) não têm
+	// sobra, então a cópia que falta sai de outra raridade
+	t.Run("toda carta tem pelo menos uma cópia", func(t *testing.T) {
+		copies := CalculateCardCopies(glossary, set, 4)
+		total := 0
+		for cid, count := range copies {
+			total += count
+			if count == 0 {
+				t.Errorf("%s ficou sem cópia", cid)
+			}
+		}
+		if total != 4*CARDS_PER_BOOSTER {
+			t.Errorf("%d cópias no total, esperava %d", total, 4*CARDS_PER_BOOSTER)
+		}
+	})
+}
@@ -0,0 +1,340 @@
+package cards
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// inicializa as cartas do JSON no dicionário usando o cardDatabase
+// função MTO importante para tirar do arquivo da coleção (base de dados das cartas) e trazer virtualizadas pro jogo
+func InitializeCardsFromJSON(filename string) (CardDatabase, error) {
+	cardDB, error := ReadCardsFromJSON(filename)
+	if error != nil {
+		return CardDatabase{}, error
+	}
+
+	// nenhuma carta entra no jogo sem passar pela validação
+	if error = ValidateCardSet(cardDB); error != nil {
+		return CardDatabase{}, fmt.Errorf("base de cartas inválida: %v", error)
+	}
+
+	// cada carta carrega o código da coleção de onde veio
+	for cid, card := range cardDB.Cards {
+		card.Set = cardDB.Set.Code
+		cardDB.Cards[cid] = card
+	}
+
+	return cardDB, nil
+}
+
+// só lê e deserializa o arquivo da coleção, sem validar
+// (o cardtool usa para conseguir editar um arquivo que ainda está inválido)
+func ReadCardsFromJSON(filename string) (CardDatabase, error) {
+	file, error := os.ReadFile(filename)
+	if error != nil {
+		return CardDatabase{}, fmt.Errorf("erro ao ler arquivo: %v", error)
+	}
+
+	// base de dados de cartas, definido no cards.go
+	// cardDB contém os metadados da coleção e um map de CID e cartas
+	cardDB, error := decodeCardDatabase(file)
+	if error != nil {
+		return CardDatabase{}, fmt.Errorf("erro ao deserializar JSON: %v", error)
+	}
+
+	return cardDB, nil
+}
+
+// grava a coleção no formato dos arquivos de data/sets
+// o campo set das cartas não vai pro arquivo (ele vem do bloco "set")
+func SaveCardsToJSON(filename string, cardDB CardDatabase) error {
+	out := CardDatabase{Set: cardDB.Set, Cards: make(map[string]Card, len(cardDB.Cards))}
+	for cid, card := range cardDB.Cards {
+		card.Set = ""
+		out.Cards[cid] = card
+	}
+
+	data, error := json.MarshalIndent(out, "", "  ")
+	if error != nil {
+		return error
+	}
+
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// lista os arquivos de coleção de um diretório, em ordem
+func CardSetFiles(dir string) ([]string, error) {
+	filenames, error := filepath.Glob(filepath.Join(dir, "*.json"))
+	if error != nil {
+		return nil, error
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("nenhuma coleção encontrada em %s", dir)
+	}
+	slices.Sort(filenames)
+	return filenames, nil
+}
+
+// lê todas as coleções (um arquivo .json por coleção) de um diretório
+// retorna os metadados por código e o glossário com as cartas de todas elas
+func InitializeCardSetsFromDir(dir string) (map[string]CardSet, map[string]Card, error) {
+	filenames, error := CardSetFiles(dir)
+	if error != nil {
+		return nil, nil, error
+	}
+
+	cardDBs := make(map[string]CardDatabase)
+	for _, filename := range filenames {
+		cardDB, error := InitializeCardsFromJSON(filename)
+		if error != nil {
+			return nil, nil, fmt.Errorf("%s: %v", filepath.Base(filename), error)
+		}
+		cardDBs[filepath.Base(filename)] = cardDB
+	}
+
+	return MergeCardSets(cardDBs)
+}
+
+// junta coleções já validadas (por nome de arquivo) num glossário só,
+// conferindo o que só dá pra conferir olhando todas juntas
+func MergeCardSets(cardDBs map[string]CardDatabase) (map[string]CardSet, map[string]Card, error) {
+	sets := make(map[string]CardSet)
+	glossary := make(map[string]Card)
+
+	for _, name := range slices.Sorted(maps.Keys(cardDBs)) {
+		cardDB := cardDBs[name]
+
+		if _, exists := sets[cardDB.Set.Code]; exists {
+			return nil, nil, fmt.Errorf("%s: coleção %s repetida", name, cardDB.Set.Code)
+		}
+		sets[cardDB.Set.Code] = cardDB.Set
+
+		// CIDs precisam ser únicos entre todas as coleções
+		for cid, card := range cardDB.Cards {
+			if _, exists := glossary[cid]; exists {
+				return nil, nil, fmt.Errorf("%s: CID %s já existe em outra coleção", name, cid)
+			}
+			glossary[cid] = card
+		}
+	}
+
+	return sets, glossary, nil
+}
+
+// lê o JSON token a token para conseguir detectar CIDs repetidos
+// (o json.Unmarshal num map simplesmente sobrescreve a chave repetida)
+func decodeCardDatabase(data []byte) (CardDatabase, error) {
+	var cardDB CardDatabase
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if error := expectDelim(decoder, '{'); error != nil {
+		return cardDB, error
+	}
+
+	seenSet := false
+	for decoder.More() {
+		token, error := decoder.Token()
+		if error != nil {
+			return cardDB, error
+		}
+
+		// só as chaves "set" e "cards" são conhecidas no nível de cima
+		key, _ := token.(string)
+		switch key {
+		case "set":
+			if seenSet {
+				return cardDB, errors.New("campo \"set\" repetido")
+			}
+			seenSet = true
+			if error := decoder.Decode(&cardDB.Set); error != nil {
+				return cardDB, fmt.Errorf("set: %v", error)
+			}
+			continue
+		case "cards":
+		default:
+			return cardDB, fmt.Errorf("campo desconhecido %q", token)
+		}
+		if cardDB.Cards != nil {
+			return cardDB, errors.New("campo \"cards\" repetido")
+		}
+
+		if error := expectDelim(decoder, '{'); error != nil {
+			return cardDB, error
+		}
+
+		cardDB.Cards = make(map[string]Card)
+		for decoder.More() {
+			token, error := decoder.Token()
+			if error != nil {
+				return cardDB, error
+			}
+			cid := token.(string)
+
+			var card Card
+			if error := decoder.Decode(&card); error != nil {
+				return cardDB, fmt.Errorf("carta %s: %v", cid, error)
+			}
+
+			if _, exists := cardDB.Cards[cid]; exists {
+				return cardDB, fmt.Errorf("CID %s repetido", cid)
+			}
+			cardDB.Cards[cid] = card
+		}
+
+		if error := expectDelim(decoder, '}'); error != nil {
+			return cardDB, error
+		}
+	}
+
+	if error := expectDelim(decoder, '}'); error != nil {
+		return cardDB, error
+	}
+
+	if !seenSet {
+		return cardDB, errors.New("campo \"set\" ausente")
+	}
+	if cardDB.Cards == nil {
+		return cardDB, errors.New("campo \"cards\" ausente")
+	}
+
+	return cardDB, nil
+}
+
+// confere se o próximo token é o delimitador esperado
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, error := decoder.Token()
+	if error != nil {
+		return error
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("esperava %q, encontrou %v", delim, token)
+	}
+	return nil
+}
+
+// valida os metadados da coleção e as cartas dela
+func ValidateCardSet(cardDB CardDatabase) error {
+	var problems []error
+	set := cardDB.Set
+
+	if set.Code == "" {
+		problems = append(problems, errors.New("set: code vazio"))
+	}
+	if set.Name == "" {
+		problems = append(problems, errors.New("set: name vazio"))
+	}
+	if _, error := time.Parse(time.DateOnly, set.ReleaseDate); error != nil {
+		problems = append(problems, fmt.Errorf("set: releaseDate %q não está no formato AAAA-MM-DD", set.ReleaseDate))
+	}
+
+	totalWeight := 0.0
+	for rarity, weight := range set.RarityWeights {
+		switch rarity {
+		case Comum, Incomum, Rara:
+		default:
+			problems = append(problems, fmt.Errorf("set: raridade desconhecida %q em rarityWeights", rarity))
+		}
+		if weight < 0 {
+			problems = append(problems, fmt.Errorf("set: peso negativo para %s", rarity))
+		}
+		totalWeight += weight
+	}
+	if totalWeight <= 0 {
+		problems = append(problems, errors.New("set: rarityWeights precisa ter algum peso positivo"))
+	}
+
+	// raridade que tem carta precisa de peso, senão o CalculateCardCopies
+	// não dá nenhuma cópia para ela
+	usedRarities := make(map[CardRarity]bool)
+
+	// os CIDs já vêm com o prefixo da coleção (ex: P1_rem_01)
+	for _, cid := range slices.Sorted(maps.Keys(cardDB.Cards)) {
+		card := cardDB.Cards[cid]
+		usedRarities[card.CardRarity] = true
+		if set.Code != "" && !strings.HasPrefix(cid, set.Code+"_") {
+			problems = append(problems, fmt.Errorf("carta %s: CID sem o prefixo %s_ da coleção", cid, set.Code))
+		}
+		if card.Set != "" && card.Set != set.Code {
+			problems = append(problems, fmt.Errorf("carta %s: set %q diferente da coleção %s", cid, card.Set, set.Code))
+		}
+	}
+	for _, rarity := range []CardRarity{Comum, Incomum, Rara} {
+		if usedRarities[rarity] && set.RarityWeights[rarity] <= 0 {
+			problems = append(problems, fmt.Errorf("set: raridade %s tem cartas mas não tem peso positivo em rarityWeights", rarity))
+		}
+	}
+
+	problems = append(problems, ValidateCards(cardDB.Cards))
+
+	return errors.Join(problems...)
+}
+
+// valida todas as cartas da base, juntando todos os problemas encontrados
+// para que quem edita o arquivo veja tudo de uma vez
+func ValidateCards(cards map[string]Card) error {
+	var problems []error
+
+	perType := map[CardType]int{REM: 0, NREM: 0, Pill: 0}
+
+	// percorre em ordem para a lista de erros sair sempre igual
+	for _, cid := range slices.Sorted(maps.Keys(cards)) {
+		card := cards[cid]
+		if card.CID != cid {
+			problems = append(problems, fmt.Errorf("carta %s: CID %q não bate com a chave", cid, card.CID))
+		}
+		if card.Name == "" {
+			problems = append(problems, fmt.Errorf("carta %s: nome vazio", cid))
+		}
+
+		switch card.CardType {
+		case REM, NREM, Pill, Reaction:
+			perType[card.CardType]++
+		default:
+			problems = append(problems, fmt.Errorf("carta %s: cardtype desconhecido %q", cid, card.CardType))
+		}
+
+		switch card.CardRarity {
+		case Comum, Incomum, Rara:
+		default:
+			problems = append(problems, fmt.Errorf("carta %s: cardrarity desconhecida %q", cid, card.CardRarity))
+		}
+
+		switch card.CardEffect {
+		case AD, CONS, PAR, AS, NEN:
+		default:
+			problems = append(problems, fmt.Errorf("carta %s: cardeffect desconhecido %q", cid, card.CardEffect))
+		}
+
+		if card.Points < 0 {
+			problems = append(problems, fmt.Errorf("carta %s: points negativo (%d)", cid, card.Points))
+		}
+
+		if card.Cost < 0 {
+			problems = append(problems, fmt.Errorf("carta %s: cost negativo (%d)", cid, card.Cost))
+		}
+
+		if error := validateCardEffects(card); error != nil {
+			problems = append(problems, fmt.Errorf("carta %s: %v", cid, error))
+		}
+	}
+
+	// o CalculateCardCopies divide pela quantidade de cartas de cada tipo
+	// (reação é opcional)
+	for _, cardType := range []CardType{REM, NREM, Pill} {
+		if perType[cardType] == 0 {
+			problems = append(problems, fmt.Errorf("nenhuma carta do tipo %s", cardType))
+		}
+	}
+
+	return errors.Join(problems...)
+}
@@ -0,0 +1,64 @@
+package cards
+
+import (
+	"strings"
+	"testing"
+)
+
+// coleção mínima válida: uma carta de cada tipo obrigatório
+func testCardDatabase() CardDatabase {
+	cardDB := CardDatabase{
+		Set: CardSet{Code: "T", Name: "Teste", ReleaseDate: "2025-09-01", RarityWeights: map[CardRarity]float64{Comum: 0.6, Rara: 0.4}},
+		Cards: map[string]Card{
+			"T_rem":  {CID: "T_rem", Name: "rem", CardType: REM, CardRarity: Comum, CardEffect: PAR, Points: 1},
+			"T_nrem": {CID: "T_nrem", Name: "nrem", CardType: NREM, CardRarity: Comum, CardEffect: NEN, Points: 1},
+			"T_pill": {CID: "T_pill", Name: "pill", CardType: Pill, CardRarity: Rara, CardEffect: AD},
+		},
+	}
+	return cardDB
+}
+
+func TestValidateCardSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*CardDatabase)
+		problem string // trecho do erro esperado (vazio = válida)
+	}{
+		{name: "válida"},
+		{
+			name:    "raridade usada sem peso",
+			change:  func(cardDB *CardDatabase) { delete(cardDB.Set.RarityWeights, Rara) },
+			problem: "raridade rara tem cartas",
+		},
+		{
+			name:    "raridade usada com peso zero",
+			change:  func(cardDB *CardDatabase) { cardDB.Set.RarityWeights[Rara] = 0 },
+			problem: "raridade rara tem cartas",
+		},
+		{
+			name:   "raridade sem carta pode ficar sem peso",
+			change: func(cardDB *CardDatabase) { cardDB.Set.RarityWeights[Incomum] = 0 },
+		},
+		{
+			name:    "sem peso nenhum",
+			change:  func(cardDB *CardDatabase) { cardDB.Set.RarityWeights = nil },
+			problem: "algum peso positivo",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cardDB := testCardDatabase()
+			if test.change != nil {
+				test.change(&cardDB)
+			}
+			error := ValidateCardSet(cardDB)
+			switch {
+			case test.problem == "" && error != nil:
+				t.Errorf("esperava coleção válida, veio: %v", error)
+			case test.problem != "" && (error == nil || !strings.Contains(error.Error(), test.problem)):
+				t.Errorf("esperava erro com %q, veio: %v", test.problem, error)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package cards
+
+import (
+	"errors"
+	"fmt"
+)
+
+// primitivas de efeito que uma carta pode declarar no JSON
+// (a engine interpreta; cartas sem "effects" usam points + cardeffect)
+type EffectOp string
+
+const (
+	Deal       EffectOp = "deal"       // tira amount de sanidade do alvo
+	Heal       EffectOp = "heal"       // dá amount de sanidade ao alvo
+	ApplyState EffectOp = "applyState" // coloca o alvo no estado state por turns rodadas
+	Draw       EffectOp = "draw"       // alvo compra amount cartas
+	Discard    EffectOp = "discard"    // alvo descarta amount cartas aleatórias da mão
+	If         EffectOp = "if"         // roda then se a condição valer, senão else
+
+	// só em cartas de reação, no primeiro nível
+	Cancel  EffectOp = "cancel"  // anula o applyState de state (vazio = qualquer) da carta respondida
+	Reflect EffectOp = "reflect" // devolve amount% do dano da carta respondida para quem jogou
+)
+
+type EffectTarget string
+
+const (
+	Self     EffectTarget = "self"     // quem jogou a carta
+	Opponent EffectTarget = "opponent" // o oponente
+)
+
+type Effect struct {
+	Op        EffectOp     `json:"op"`
+	Target    EffectTarget `json:"target,omitempty"` // vazio = padrão da primitiva
+	Amount    int          `json:"amount,omitempty"`
+	State     CardEffect   `json:"state,omitempty"` // em applyState
+	Turns     int          `json:"turns,omitempty"` // em applyState; 0 = duração do ruleset
+	Condition *Condition   `json:"condition,omitempty"`
+	Then      []Effect     `json:"then,omitempty"`
+	Else      []Effect     `json:"else,omitempty"`
+}
+
+// condição de um "if"; todas as partes preenchidas precisam valer
+type Condition struct {
+	Target      EffectTarget `json:"target,omitempty"`      // de quem olhar (vazio = opponent)
+	State       CardEffect   `json:"state,omitempty"`       // está neste estado
+	SanityBelow int          `json:"sanityBelow,omitempty"` // tem menos sanidade que isso
+	SanityAbove int          `json:"sanityAbove,omitempty"` // tem mais sanidade que isso
+}
+
+// alvo padrão de cada primitiva: o que machuca vai no oponente,
+// o que ajuda vai em quem jogou
+func (effect Effect) TargetOrDefault() EffectTarget {
+	if effect.Target != "" {
+		return effect.Target
+	}
+	switch effect.Op {
+	case Heal, Draw:
+		return Self
+	}
+	return Opponent
+}
+
+// alvo da condição (padrão: oponente)
+func (condition Condition) TargetOrDefault() EffectTarget {
+	if condition.Target != "" {
+		return condition.Target
+	}
+	return Opponent
+}
+
+// lista de efeitos que a carta faz ao ser jogada
+// cartas sem "effects" são traduzidas do formato antigo (points + cardeffect)
+func (card Card) EffectList() []Effect {
+	if len(card.Effects) > 0 {
+		return card.Effects
+	}
+
+	var effects []Effect
+
+	if card.Points > 0 {
+		switch card.CardType {
+		case Pill:
+			effects = append(effects, Effect{Op: Heal, Target: Self, Amount: card.Points})
+		case REM, NREM:
+			effects = append(effects, Effect{Op: Deal, Target: Opponent, Amount: card.Points})
+		}
+	}
+
+	switch card.CardEffect {
+	case CONS:
+		effects = append(effects, Effect{Op: ApplyState, Target: Self, State: CONS})
+	case AD, PAR, AS:
+		effects = append(effects, Effect{Op: ApplyState, Target: Opponent, State: card.CardEffect})
+	}
+
+	return effects
+}
+
+// limite de "if" dentro de "if", só para pegar JSON malformado
+const maxEffectDepth = 4
+
+// confere os efeitos de acordo com o tipo da carta: reação precisa de
+// effects, e cancel/reflect só valem em reação
+func validateCardEffects(card Card) error {
+	if card.CardType == Reaction {
+		if len(card.Effects) == 0 {
+			return errors.New("carta de reação precisa de effects")
+		}
+		return validateEffects(card.Effects, 0)
+	}
+
+	if usesReactionOps(card.Effects) {
+		return errors.New("cancel e reflect só valem em cartas de reação")
+	}
+	return validateEffects(card.Effects, 0)
+}
+
+func usesReactionOps(effects []Effect) bool {
+	for _, effect := range effects {
+		if effect.Op == Cancel || effect.Op == Reflect {
+			return true
+		}
+		if usesReactionOps(effect.Then) || usesReactionOps(effect.Else) {
+			return true
+		}
+	}
+	return false
+}
+
+// valida a lista de efeitos de uma carta
+func validateEffects(effects []Effect, depth int) error {
+	if depth > maxEffectDepth {
+		return fmt.Errorf("mais de %d níveis de \"if\"", maxEffectDepth)
+	}
+
+	var problems []error
+	for i, effect := range effects {
+		if error := validateEffect(effect, depth); error != nil {
+			problems = append(problems, fmt.Errorf("effects[%d] (%s): %v", i, effect.Op, error))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+func validateEffect(effect Effect, depth int) error {
+	var problems []error
+
+	switch effect.Target {
+	case "", Self, Opponent:
+	default:
+		problems = append(problems, fmt.Errorf("target desconhecido %q", effect.Target))
+	}
+
+	switch effect.Op {
+	case Deal, Heal, Draw, Discard:
+		if effect.Amount <= 0 {
+			problems = append(problems, errors.New("amount precisa ser positivo"))
+		}
+	case ApplyState:
+		switch effect.State {
+		case AD, CONS, PAR, AS:
+		default:
+			problems = append(problems, fmt.Errorf("state desconhecido %q", effect.State))
+		}
+		if effect.Turns < 0 {
+			problems = append(problems, errors.New("turns não pode ser negativo"))
+		}
+	case Cancel:
+		switch effect.State {
+		case "", AD, CONS, PAR, AS:
+		default:
+			problems = append(problems, fmt.Errorf("state desconhecido %q", effect.State))
+		}
+		if depth > 0 {
+			problems = append(problems, errors.New("cancel só no primeiro nível"))
+		}
+	case Reflect:
+		if effect.Amount <= 0 || effect.Amount > 100 {
+			problems = append(problems, errors.New("amount precisa ser uma porcentagem entre 1 e 100"))
+		}
+		if depth > 0 {
+			problems = append(problems, errors.New("reflect só no primeiro nível"))
+		}
+	case If:
+		if effect.Condition == nil {
+			problems = append(problems, errors.New("condition ausente"))
+		} else {
+			problems = append(problems, validateCondition(*effect.Condition))
+		}
+		if len(effect.Then) == 0 && len(effect.Else) == 0 {
+			problems = append(problems, errors.New("then e else vazios"))
+		}
+		problems = append(problems, validateEffects(effect.Then, depth+1))
+		problems = append(problems, validateEffects(effect.Else, depth+1))
+	default:
+		problems = append(problems, fmt.Errorf("op desconhecida %q", effect.Op))
+	}
+
+	return errors.Join(problems...)
+}
+
+func validateCondition(condition Condition) error {
+	var problems []error
+
+	switch condition.Target {
+	case "", Self, Opponent:
+	default:
+		problems = append(problems, fmt.Errorf("condition: target desconhecido %q", condition.Target))
+	}
+	switch condition.State {
+	case "", AD, CONS, PAR, AS:
+	default:
+		problems = append(problems, fmt.Errorf("condition: state desconhecido %q", condition.State))
+	}
+	if condition.State == "" && condition.SanityBelow == 0 && condition.SanityAbove == 0 {
+		problems = append(problems, errors.New("condition vazia"))
+	}
+
+	return errors.Join(problems...)
+}
@@ -0,0 +1,398 @@
+// cardtool: ferramenta de linha de comando para editar as coleções de cartas
+// (data/sets/*.json) usando os mesmos tipos e a mesma validação do servidor
+//
+// uso (de dentro de server/):
+//
+//	go run ./cmd/cardtool list [-set P1]
+//	go run ./cmd/cardtool add -set P1 -cid P1_rem_07 -name "..." -desc "..." -type rem -rarity comum -effect nenhum -points 2
+//	go run ./cmd/cardtool edit -set P1 -cid P1_rem_07 -points 3
+//	go run ./cmd/cardtool edit -set P1 -cid P1_rem_07 -cost 2
+//	go run ./cmd/cardtool edit -set P1 -cid P1_rem_07 -effects '[{"op":"deal","amount":3}]'
+//	go run ./cmd/cardtool remove -set P1 -cid P1_rem_07
+//	go run ./cmd/cardtool validate
+//	go run ./cmd/cardtool copies -set P1 -boosters 1000
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"pbl-redes/cards"
+)
+
+// valores aceitos em cada campo enumerado
+var (
+	cardTypes    = []cards.CardType{cards.REM, cards.NREM, cards.Pill, cards.Reaction}
+	cardRarities = []cards.CardRarity{cards.Comum, cards.Incomum, cards.Rara}
+	cardEffects  = []cards.CardEffect{cards.AD, cards.CONS, cards.PAR, cards.AS, cards.NEN}
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+
+	var error error
+	switch command {
+	case "list":
+		error = runList(args)
+	case "add":
+		error = runAdd(args)
+	case "edit":
+		error = runEdit(args)
+	case "remove":
+		error = runRemove(args)
+	case "validate":
+		error = runValidate(args)
+	case "copies":
+		error = runCopies(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if error != nil {
+		fmt.Fprintf(os.Stderr, "erro: %v\n", error)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `uso: cardtool <comando> [opções]
+
+comandos:
+  list      lista as cartas (todas ou de uma coleção)
+  add       adiciona uma carta a uma coleção
+  edit      muda campos de uma carta
+  remove    remove uma carta
+  validate  valida todas as coleções do jeito que o servidor valida
+  copies    mostra quantas cópias de cada carta o estoque teria
+
+use "cardtool <comando> -h" para ver as opções de cada comando`)
+}
+
+// lista as cartas
+func runList(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	dir := flags.String("dir", "data/sets", "diretório das coleções")
+	setCode := flags.String("set", "", "código da coleção (vazio = todas)")
+	flags.Parse(args)
+
+	cardDBs, error := readAll(*dir)
+	if error != nil {
+		return error
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cardDBs)) {
+		cardDB := cardDBs[name]
+		if *setCode != "" && cardDB.Set.Code != *setCode {
+			continue
+		}
+
+		fmt.Printf("== %s - %s (lançada em %s) [%s]\n", cardDB.Set.Code, cardDB.Set.Name, cardDB.Set.ReleaseDate, name)
+		for _, cid := range slices.Sorted(maps.Keys(cardDB.Cards)) {
+			card := cardDB.Cards[cid]
+			fmt.Printf("%-14s %-32s %-6s %-8s %-11s %d pts, custo %d\n", cid, card.Name, card.CardType, card.CardRarity, card.CardEffect, card.Points, card.Cost)
+		}
+	}
+
+	return nil
+}
+
+// adiciona uma carta
+func runAdd(args []string) error {
+	flags := flag.NewFlagSet("add", flag.ExitOnError)
+	dir := flags.String("dir", "data/sets", "diretório das coleções")
+	setCode := flags.String("set", "", "código da coleção")
+	cid := flags.String("cid", "", "ID da carta (com o prefixo da coleção)")
+	card := cardFlags(flags)
+	flags.Parse(args)
+
+	return editSet(*dir, *setCode, func(cardDB *cards.CardDatabase) error {
+		if *cid == "" {
+			return fmt.Errorf("-cid é obrigatório")
+		}
+		if _, exists := cardDB.Cards[*cid]; exists {
+			return fmt.Errorf("carta %s já existe, use edit", *cid)
+		}
+
+		newCard := cards.Card{CID: *cid}
+		if error := card.apply(flags, &newCard); error != nil {
+			return error
+		}
+		cardDB.Cards[*cid] = newCard
+
+		fmt.Printf("carta %s adicionada\n", *cid)
+		return nil
+	})
+}
+
+// muda só os campos passados
+func runEdit(args []string) error {
+	flags := flag.NewFlagSet("edit", flag.ExitOnError)
+	dir := flags.String("dir", "data/sets", "diretório das coleções")
+	setCode := flags.String("set", "", "código da coleção")
+	cid := flags.String("cid", "", "ID da carta")
+	card := cardFlags(flags)
+	flags.Parse(args)
+
+	return editSet(*dir, *setCode, func(cardDB *cards.CardDatabase) error {
+		existing, exists := cardDB.Cards[*cid]
+		if !exists {
+			return fmt.Errorf("carta %s não existe", *cid)
+		}
+
+		if error := card.apply(flags, &existing); error != nil {
+			return error
+		}
+		cardDB.Cards[*cid] = existing
+
+		fmt.Printf("carta %s editada\n", *cid)
+		return nil
+	})
+}
+
+// remove uma carta
+func runRemove(args []string) error {
+	flags := flag.NewFlagSet("remove", flag.ExitOnError)
+	dir := flags.String("dir", "data/sets", "diretório das coleções")
+	setCode := flags.String("set", "", "código da coleção")
+	cid := flags.String("cid", "", "ID da carta")
+	flags.Parse(args)
+
+	return editSet(*dir, *setCode, func(cardDB *cards.CardDatabase) error {
+		if _, exists := cardDB.Cards[*cid]; !exists {
+			return fmt.Errorf("carta %s não existe", *cid)
+		}
+		delete(cardDB.Cards, *cid)
+
+		fmt.Printf("carta %s removida\n", *cid)
+		return nil
+	})
+}
+
+// valida tudo igual ao servidor na inicialização
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	dir := flags.String("dir", "data/sets", "diretório das coleções")
+	flags.Parse(args)
+
+	sets, glossary, error := cards.InitializeCardSetsFromDir(*dir)
+	if error != nil {
+		return error
+	}
+
+	fmt.Printf("ok: %d coleções, %d cartas\n", len(sets), len(glossary))
+	return nil
+}
+
+// prévia da distribuição de cópias que o servidor geraria no estoque
+func runCopies(args []string) error {
+	flags := flag.NewFlagSet("copies", flag.ExitOnError)
+	dir := flags.String("dir", "data/sets", "diretório das coleções")
+	setCode := flags.String("set", "", "código da coleção")
+	boosters := flags.Int("boosters", 1000, "quantidade de boosters do estoque")
+	flags.Parse(args)
+
+	if *boosters <= 0 {
+		return fmt.Errorf("-boosters precisa ser positivo")
+	}
+
+	sets, glossary, error := cards.InitializeCardSetsFromDir(*dir)
+	if error != nil {
+		return error
+	}
+	set, exists := sets[*setCode]
+	if !exists {
+		return fmt.Errorf("coleção %q não existe", *setCode)
+	}
+
+	copies := cards.CalculateCardCopies(glossary, set, *boosters)
+
+	// agrupa por raridade para conferir com os pesos da coleção
+	total := 0
+	perRarity := make(map[cards.CardRarity]int)
+	for _, rarity := range cardRarities {
+		fmt.Printf("== %s\n", rarity)
+		for _, cid := range slices.Sorted(maps.Keys(copies)) {
+			card := glossary[cid]
+			if card.CardRarity != rarity {
+				continue
+			}
+			fmt.Printf("%-14s %-32s %-5s %5d\n", cid, card.Name, card.CardType, copies[cid])
+			perRarity[rarity] += copies[cid]
+			total += copies[cid]
+		}
+	}
+
+	fmt.Println(strings.Repeat("-", 60))
+	for _, rarity := range cardRarities {
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(perRarity[rarity]) / float64(total)
+		}
+		fmt.Printf("%-8s %6d cópias (%.1f%%)\n", rarity, perRarity[rarity], share)
+	}
+	fmt.Printf("total    %6d cópias para %d boosters de %d cartas\n", total, *boosters, cards.CARDS_PER_BOOSTER)
+
+	// com poucos boosters não dá cópia para todo mundo
+	var missing []string
+	for _, cid := range slices.Sorted(maps.Keys(copies)) {
+		if copies[cid] == 0 {
+			missing = append(missing, cid)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Printf("aviso: %d carta(s) sem cópia nenhuma, aumente -boosters: %s\n", len(missing), strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// campos de carta aceitos por add e edit
+type cardFields struct {
+	name, desc, cardType, rarity, effect, effects *string
+	points, cost                                  *int
+}
+
+func cardFlags(flags *flag.FlagSet) cardFields {
+	return cardFields{
+		name:     flags.String("name", "", "nome da carta"),
+		desc:     flags.String("desc", "", "descrição"),
+		cardType: flags.String("type", "", "tipo: "+joinValues(cardTypes)),
+		rarity:   flags.String("rarity", "", "raridade: "+joinValues(cardRarities)),
+		effect:   flags.String("effect", "", "efeito: "+joinValues(cardEffects)),
+		effects:  flags.String("effects", "", "lista de efeitos em JSON (\"[]\" volta para cardeffect/points)"),
+		points:   flags.Int("points", 0, "pontos"),
+		cost:     flags.Int("cost", 0, "custo em lucidez"),
+	}
+}
+
+// copia para a carta só os campos que foram passados na linha de comando,
+// conferindo os enums antes
+func (fields cardFields) apply(flags *flag.FlagSet, card *cards.Card) error {
+	var error error
+	flags.Visit(func(f *flag.Flag) {
+		if error != nil {
+			return
+		}
+		switch f.Name {
+		case "name":
+			card.Name = *fields.name
+		case "desc":
+			card.Desc = *fields.desc
+		case "type":
+			card.CardType, error = checkEnum("type", cards.CardType(*fields.cardType), cardTypes)
+		case "rarity":
+			card.CardRarity, error = checkEnum("rarity", cards.CardRarity(*fields.rarity), cardRarities)
+		case "effect":
+			card.CardEffect, error = checkEnum("effect", cards.CardEffect(*fields.effect), cardEffects)
+		case "effects":
+			card.Effects = nil
+			if error = json.Unmarshal([]byte(*fields.effects), &card.Effects); error != nil {
+				error = fmt.Errorf("-effects inválido: %v", error)
+			}
+		case "points":
+			card.Points = *fields.points
+		case "cost":
+			card.Cost = *fields.cost
+		}
+	})
+	return error
+}
+
+// confere se o valor é um dos aceitos
+func checkEnum[T ~string](field string, value T, accepted []T) (T, error) {
+	if !slices.Contains(accepted, value) {
+		return value, fmt.Errorf("-%s %q inválido, use um de: %s", field, value, joinValues(accepted))
+	}
+	return value, nil
+}
+
+func joinValues[T ~string](values []T) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = string(value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// lê todas as coleções sem validar (para poder corrigir arquivos inválidos)
+func readAll(dir string) (map[string]cards.CardDatabase, error) {
+	filenames, error := cards.CardSetFiles(dir)
+	if error != nil {
+		return nil, error
+	}
+
+	cardDBs := make(map[string]cards.CardDatabase)
+	for _, filename := range filenames {
+		cardDB, error := cards.ReadCardsFromJSON(filename)
+		if error != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(filename), error)
+		}
+		cardDBs[filepath.Base(filename)] = cardDB
+	}
+	return cardDBs, nil
+}
+
+// aplica a mudança numa coleção e só grava se o diretório inteiro
+// continuar válido do jeito que o servidor exige
+func editSet(dir, setCode string, change func(cardDB *cards.CardDatabase) error) error {
+	cardDBs, error := readAll(dir)
+	if error != nil {
+		return error
+	}
+
+	filename := ""
+	for name, cardDB := range cardDBs {
+		if cardDB.Set.Code == setCode {
+			filename = name
+		}
+	}
+	if filename == "" {
+		return fmt.Errorf("coleção %q não existe em %s", setCode, dir)
+	}
+
+	cardDB := cardDBs[filename]
+	if error := change(&cardDB); error != nil {
+		return error
+	}
+	cardDBs[filename] = cardDB
+
+	if error := validateAll(cardDBs); error != nil {
+		return fmt.Errorf("mudança não gravada, coleção ficaria inválida:\n%v", error)
+	}
+
+	return cards.SaveCardsToJSON(filepath.Join(dir, filename), cardDB)
+}
+
+// mesma validação do InitializeCardSetsFromDir, mas sobre o que está em memória
+func validateAll(cardDBs map[string]cards.CardDatabase) error {
+	validated := make(map[string]cards.CardDatabase)
+	for _, name := range slices.Sorted(maps.Keys(cardDBs)) {
+		cardDB := cardDBs[name]
+		if error := cards.ValidateCardSet(cardDB); error != nil {
+			return fmt.Errorf("%s: %v", name, error)
+		}
+
+		// igual ao servidor: as cartas levam o código da coleção
+		withSet := cards.CardDatabase{Set: cardDB.Set, Cards: make(map[string]cards.Card)}
+		for cid, card := range cardDB.Cards {
+			card.Set = cardDB.Set.Code
+			withSet.Cards[cid] = card
+		}
+		validated[name] = withSet
+	}
+
+	_, _, error := cards.MergeCardSets(validated)
+	return error
+}
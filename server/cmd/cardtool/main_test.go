@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pbl-redes/cards"
+)
+
+// cópia da coleção de verdade num diretório temporário
+func testSetsDir(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile("../../data/sets/P1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "P1.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestEditCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   func(args []string) error
+		args  []string
+		fails bool                                    // o comando dá erro e não grava nada
+		check func(*testing.T, map[string]cards.Card) // cartas depois do comando
+	}{
+		{
+			name: "edit muda só o campo passado",
+			run:  runEdit,
+			args: []string{"-cid", "P1_rem_01", "-points", "3"},
+			check: func(t *testing.T, set map[string]cards.Card) {
+				card := set["P1_rem_01"]
+				if card.Points != 3 || card.Name != "acordando a bruxa" {
+					t.Errorf("carta depois do edit: %+v", card)
+				}
+			},
+		},
+		{
+			name:  "edit com enum inválido",
+			run:   runEdit,
+			args:  []string{"-cid", "P1_rem_01", "-type", "sonho"},
+			fails: true,
+		},
+		{
+			name:  "edit que deixaria a coleção inválida",
+			run:   runEdit,
+			args:  []string{"-cid", "P1_rem_01", "-effects", `[{"op":"cancel"}]`},
+			fails: true,
+		},
+		{
+			name: "add de carta nova",
+			run:  runAdd,
+			args: []string{"-cid", "P1_nrem_99", "-name", "teste", "-desc", "teste", "-type", "nrem", "-rarity", "comum", "-effect", "nenhum", "-points", "1"},
+			check: func(t *testing.T, set map[string]cards.Card) {
+				if card, ok := set["P1_nrem_99"]; !ok || card.CardType != cards.NREM {
+					t.Errorf("carta adicionada: %+v (existe: %v)", card, ok)
+				}
+			},
+		},
+		{
+			name:  "add de carta que já existe",
+			run:   runAdd,
+			args:  []string{"-cid", "P1_rem_01", "-name", "outra"},
+			fails: true,
+		},
+		{
+			name: "remove",
+			run:  runRemove,
+			args: []string{"-cid", "P1_rem_01"},
+			check: func(t *testing.T, set map[string]cards.Card) {
+				if _, ok := set["P1_rem_01"]; ok {
+					t.Errorf("carta continua na coleção")
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := testSetsDir(t)
+			filename := filepath.Join(dir, "P1.json")
+			before, _ := os.ReadFile(filename)
+
+			err := test.run(append([]string{"-dir", dir, "-set", "P1"}, test.args...))
+			if test.fails {
+				after, _ := os.ReadFile(filename)
+				if err == nil || string(after) != string(before) {
+					t.Errorf("esperava erro sem gravar, veio %v (arquivo mudou: %v)", err, string(after) != string(before))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// o que foi gravado continua passando na validação do servidor
+			_, glossary, err := cards.InitializeCardSetsFromDir(dir)
+			if err != nil {
+				t.Fatalf("coleção gravada inválida: %v", err)
+			}
+			test.check(t, glossary)
+		})
+	}
+}
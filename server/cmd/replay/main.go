@@ -0,0 +1,188 @@
+// replay: refaz uma partida gravada (data/replays/*.json) na engine e mostra
+// o estado depois de cada ação, para investigar resultados contestados
+//
+// uso (de dentro de server/):
+//
+//	go run ./cmd/replay data/replays/20261019-153000-2.json
+//	go run ./cmd/replay -events -hands data/replays/20261019-153000-2.json
+//
+// se a engine recusar alguma ação ou o resultado não bater com o gravado,
+// o replay para com erro (a partida não é a mesma que o servidor jogou)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"pbl-redes/cards"
+	"pbl-redes/engine"
+	"pbl-redes/replay"
+)
+
+func main() {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	events := flags.Bool("events", false, "mostra os eventos de cada ação")
+	hands := flags.Bool("hands", false, "mostra a mão de cada jogador depois de cada ação")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "uso: replay [-events] [-hands] <arquivo.json>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if error := run(flags.Arg(0), *events, *hands); error != nil {
+		fmt.Fprintf(os.Stderr, "erro: %v\n", error)
+		os.Exit(1)
+	}
+}
+
+func run(filename string, showEvents, showHands bool) error {
+	r, error := replay.Load(filename)
+	if error != nil {
+		return error
+	}
+
+	names := make([]string, len(r.Players))
+	for i, player := range r.Players {
+		names[i] = fmt.Sprintf("%s (%s)", player.Username, player.UID)
+	}
+	fmt.Printf("replay %s: partida %d, ruleset %s, seed %d\n", r.ID, r.Match, r.Ruleset, r.Seed)
+	fmt.Printf("jogadores: %s\n", strings.Join(names, " x "))
+	if r.Teams != nil {
+		for i, player := range r.Players {
+			names[i] = fmt.Sprintf("%s (time %d)", player.Username, r.Teams[player.UID])
+		}
+		fmt.Printf("times: %s\n", strings.Join(names, ", "))
+	}
+	fmt.Printf("início: %s, fim: %s, %d ações\n", r.Started.Format("02/01/2006 15:04:05"), r.Ended.Format("15:04:05"), len(r.Actions))
+
+	s, error := r.Start()
+	if error != nil {
+		return error
+	}
+	if r.First != "" {
+		fmt.Printf("revanche: %s começa\n", r.Username(s.FirstPlayer))
+	} else {
+		fmt.Printf("cara ou coroa: %s começa\n", r.Username(s.FirstPlayer))
+	}
+	fmt.Println("mãos iniciais:")
+	for _, uid := range s.Players {
+		fmt.Printf("  %s: %s\n", r.Username(uid), cardList(s.Hand[uid]))
+	}
+	printState(r, s, showHands)
+
+	final, error := r.Run(func(i int, action engine.Action, s engine.State, events []engine.Event) {
+		fmt.Printf("\n#%d %s %s\n", i+1, r.Username(action.Player), describe(r, action, events))
+		if showEvents {
+			for _, event := range events {
+				fmt.Printf("    %s\n", describeEvent(r, event))
+			}
+		}
+		printState(r, s, showHands)
+	})
+	if error != nil {
+		return error
+	}
+
+	fmt.Printf("\nresultado: %s", final.Result.Reason)
+	if len(final.Result.Winners) == 0 {
+		fmt.Print(", empate")
+	}
+	for _, uid := range final.Result.Winners {
+		fmt.Printf(", vencedor %s", r.Username(uid))
+	}
+	fmt.Println(" (confere com o gravado)")
+	return nil
+}
+
+// uma linha por jogador com rodada, sanidade, estado e pilhas
+func printState(r replay.Replay, s engine.State, showHands bool) {
+	fmt.Printf("  rodada %d, vez de %s\n", s.Round, r.Username(s.Turn))
+	for _, uid := range s.Players {
+		line := fmt.Sprintf("  %-12s sanidade %3d  %-11s mão %d  pilha %d  descarte %d",
+			r.Username(uid), s.Sanity[uid], s.DreamStates[uid], len(s.Hand[uid]), len(s.Library[uid]), len(s.Discard[uid]))
+		if s.Rules.Lucidity != nil {
+			line += fmt.Sprintf("  lucidez %d/%d", s.Lucidity[uid], s.MaxLucidity[uid])
+		}
+		if s.Eliminated[uid] {
+			line += "  (eliminado)"
+		}
+		fmt.Println(line)
+		if showHands {
+			fmt.Printf("      %s\n", cardList(s.Hand[uid]))
+		}
+	}
+}
+
+// o que a ação fez, com o nome da carta tirado dos eventos
+func describe(r replay.Replay, action engine.Action, events []engine.Event) string {
+	switch action.Type {
+	case engine.PlayCard:
+		if action.Target != "" {
+			return "joga " + playedCard(events, engine.CardPlayed, action.CardID) + " em " + r.Username(action.Target)
+		}
+		return "joga " + playedCard(events, engine.CardPlayed, action.CardID)
+	case engine.React:
+		return "reage com " + playedCard(events, engine.ReactionPlayed, action.CardID)
+	case engine.Pass:
+		return "não reage"
+	case engine.SkipTurn:
+		return "perde o turno (" + action.Reason + ")"
+	case engine.GiveUp:
+		if action.Reason != "" {
+			return "sai da partida (" + action.Reason + ")"
+		}
+		return "desiste"
+	case engine.Mulligan:
+		return fmt.Sprintf("troca %d cartas no mulligan", len(action.CardIDs))
+	case engine.EndTurn:
+		return "acaba o turno"
+	}
+	return string(action.Type)
+}
+
+func playedCard(events []engine.Event, kind engine.EventType, id string) string {
+	for _, event := range events {
+		if event.Type == kind && event.Card != nil {
+			return fmt.Sprintf("%s [%s]", event.Card.Name, event.Card.Instance)
+		}
+	}
+	return id
+}
+
+func describeEvent(r replay.Replay, event engine.Event) string {
+	parts := []string{string(event.Type)}
+	if event.Player != "" {
+		parts = append(parts, "player="+r.Username(event.Player))
+	}
+	if event.Target != "" {
+		parts = append(parts, "target="+r.Username(event.Target))
+	}
+	if event.Card != nil {
+		parts = append(parts, "card="+event.Card.Name)
+	}
+	if event.State != "" {
+		parts = append(parts, "state="+string(event.State))
+	}
+	if event.Amount != 0 {
+		parts = append(parts, fmt.Sprintf("amount=%d", event.Amount))
+	}
+	if event.Reason != "" {
+		parts = append(parts, "reason="+event.Reason)
+	}
+	return strings.Join(parts, " ")
+}
+
+func cardList(hand []cards.Card) string {
+	names := make([]string, len(hand))
+	for i, card := range hand {
+		names[i] = fmt.Sprintf("%s [%s]", card.Name, card.Instance)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"slices"
+
+	"pbl-redes/cards"
+)
+
+// o que uma reação deixou armado contra a carta respondida
+type guard struct {
+	uid     string       // quem reagiu
+	cancel  []DreamState // estados anulados
+	anyway  bool         // cancel sem state: anula qualquer estado
+	reflect int          // porcentagem do dano devolvida
+}
+
+func (g *guard) cancels(uid string, state DreamState) bool {
+	return g != nil && g.uid == uid && (g.anyway || slices.Contains(g.cancel, state))
+}
+
+// interpreta a lista de efeitos de uma carta jogada por playerUID; foe é o
+// oponente que recebe os efeitos "opponent" (o alvo escolhido)
+// com guard, é a carta respondida por uma reação
+func (s *State) runEffects(playerUID, foe string, effects []cards.Effect, guard *guard) []Event {
+	var events []Event
+
+	for _, effect := range effects {
+		targetUID := s.resolveTarget(playerUID, foe, effect.TargetOrDefault())
+
+		switch effect.Op {
+		case cards.Deal:
+			if guard != nil && guard.uid == targetUID && guard.reflect > 0 {
+				reflected := effect.Amount * guard.reflect / 100
+				events = append(events, s.changeSanity(targetUID, reflected-effect.Amount))
+				events = append(events, Event{Type: DamageReflected, Round: s.Round, Player: targetUID, Target: playerUID, Amount: reflected})
+				events = append(events, s.changeSanity(playerUID, -reflected))
+				continue
+			}
+			events = append(events, s.changeSanity(targetUID, -effect.Amount))
+		case cards.Heal:
+			events = append(events, s.changeSanity(targetUID, effect.Amount))
+		case cards.ApplyState:
+			if guard.cancels(targetUID, DreamState(effect.State)) {
+				events = append(events, Event{Type: EffectCanceled, Round: s.Round, Player: playerUID, Target: targetUID, State: DreamState(effect.State)})
+				continue
+			}
+			if s.resists(targetUID, DreamState(effect.State)) {
+				events = append(events, Event{Type: StateResisted, Round: s.Round, Player: playerUID, Target: targetUID, State: DreamState(effect.State)})
+				continue
+			}
+			events = append(events, s.setState(targetUID, DreamState(effect.State), effect.Turns))
+		case cards.Draw:
+			events = append(events, s.draw(targetUID, effect.Amount))
+		case cards.Discard:
+			events = append(events, s.discardRandom(targetUID, effect.Amount))
+		case cards.If:
+			if s.check(playerUID, foe, *effect.Condition) {
+				events = append(events, s.runEffects(playerUID, foe, effect.Then, guard)...)
+			} else {
+				events = append(events, s.runEffects(playerUID, foe, effect.Else, guard)...)
+			}
+		}
+	}
+
+	return events
+}
+
+// separa os efeitos de uma reação: cancel e reflect armam a guarda contra a
+// carta respondida; o resto roda na hora, com quem reagiu como "self" e
+// quem jogou a carta como oponente
+func (s *State) react(playerUID, attacker string, effects []cards.Effect) (*guard, []Event) {
+	g := &guard{uid: playerUID}
+	var rest []cards.Effect
+
+	for _, effect := range effects {
+		switch effect.Op {
+		case cards.Cancel:
+			if effect.State == "" {
+				g.anyway = true
+			} else {
+				g.cancel = append(g.cancel, DreamState(effect.State))
+			}
+		case cards.Reflect:
+			g.reflect = min(100, g.reflect+effect.Amount)
+		default:
+			rest = append(rest, effect)
+		}
+	}
+
+	return g, s.runEffects(playerUID, attacker, rest, nil)
+}
+
+// UID do alvo visto por quem jogou
+func (s *State) resolveTarget(playerUID, foe string, target cards.EffectTarget) string {
+	if target == cards.Self {
+		return playerUID
+	}
+	return foe
+}
+
+// confere a condição de um "if"
+func (s *State) check(playerUID, foe string, condition cards.Condition) bool {
+	uid := s.resolveTarget(playerUID, foe, condition.TargetOrDefault())
+
+	if condition.State != "" && s.DreamStates[uid] != DreamState(condition.State) {
+		return false
+	}
+	if condition.SanityBelow != 0 && s.Sanity[uid] >= condition.SanityBelow {
+		return false
+	}
+	if condition.SanityAbove != 0 && s.Sanity[uid] <= condition.SanityAbove {
+		return false
+	}
+	return true
+}
+
+// muda a sanidade, sem deixar ficar negativa
+func (s *State) changeSanity(uid string, delta int) Event {
+	before := s.Sanity[uid]
+	s.Sanity[uid] += delta
+
+	// garante que sanidade não fique negativa
+	if s.Sanity[uid] < 0 {
+		s.Sanity[uid] = 0
+	}
+
+	return Event{Type: SanityChanged, Round: s.Round, Target: uid, Amount: s.Sanity[uid] - before}
+}
+
+// compra cartas do topo da pilha de compra (para quando a pilha acaba)
+func (s *State) draw(uid string, amount int) Event {
+	library := s.Library[uid]
+	amount = min(amount, len(library))
+
+	s.Hand[uid] = append(s.Hand[uid], library[:amount]...)
+	s.Library[uid] = library[amount:]
+
+	return Event{Type: CardsDrawn, Round: s.Round, Target: uid, Amount: amount}
+}
+
+// descarta cartas aleatórias da mão
+func (s *State) discardRandom(uid string, amount int) Event {
+	amount = min(amount, len(s.Hand[uid]))
+
+	for i := 0; i < amount; i++ {
+		hand := s.Hand[uid]
+		index := s.intn(len(hand))
+		s.Discard[uid] = append(s.Discard[uid], hand[index])
+		s.Hand[uid] = append(hand[:index:index], hand[index+1:]...)
+	}
+
+	return Event{Type: CardsDiscarded, Round: s.Round, Target: uid, Amount: amount}
+}
@@ -0,0 +1,613 @@
+// Package engine tem as regras do Alucinari sem rede, relógio ou log.
+// O jogo é um State; cada jogada é uma Action; Apply devolve o estado novo
+// e a lista de eventos que aconteceram, sem mexer no estado recebido.
+// Quem fala com os clientes (o Match no servidor) só traduz ações e eventos.
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"pbl-redes/cards"
+)
+
+// números das regras (o servidor carrega de data/rulesets.json)
+type Rules struct {
+	StartingSanity  int  `json:"startingSanity"`  // sanidade inicial de cada jogador
+	HandSize        int  `json:"handSize"`        // cartas na mão no começo da partida
+	DrawPerTurn     int  `json:"drawPerTurn"`     // cartas compradas no começo de cada turno (0 = sem compra)
+	HandDeckOut     bool `json:"handDeckOut"`     // com a pilha vazia só perde quem também está sem carta na mão
+	Mulligan        bool `json:"mulligan"`        // fase de mulligan antes da rodada 1
+	Reactions       bool `json:"reactions"`       // janela de reação para o alvo de toda carta REM/NREM
+	SleepyDrain     int  `json:"sleepyDrain"`     // sanidade perdida por rodada adormecido
+	ConsciousRegen  int  `json:"consciousRegen"`  // sanidade recuperada por rodada consciente
+	ScaredDrain     int  `json:"scaredDrain"`     // sanidade perdida por rodada assustado
+	ConsciousRounds int  `json:"consciousRounds"` // duração do estado consciente
+	ParalyzedRounds int  `json:"paralyzedRounds"` // duração do estado paralisado
+	ScaredRounds    int  `json:"scaredRounds"`    // duração do estado assustado
+
+	// o que ganha quem não começa a partida
+	Compensation Compensation `json:"compensation"`
+
+	// travas de estado: enquanto o jogador está no estado da chave, e por mais
+	// Rounds rodadas depois que ele sai, os estados da lista não pegam nele
+	StateLocks map[DreamState]StateLock `json:"stateLocks,omitempty"`
+
+	// lucidez para pagar o custo das cartas; sem ela as cartas são de graça,
+	// uma por turno, e jogar a carta acaba o turno
+	Lucidity *Lucidity `json:"lucidity,omitempty"`
+}
+
+// compensação de quem não começa (pode combinar as três)
+type Compensation struct {
+	Sanity    int  `json:"sanity,omitempty"`    // sanidade a mais
+	Cards     int  `json:"cards,omitempty"`     // cartas a mais na mão inicial
+	Conscious bool `json:"conscious,omitempty"` // começa consciente até o fim do próprio primeiro turno
+}
+
+// lucidez: enche no começo de cada turno do jogador, com um máximo que
+// começa em Starting e cresce Growth por turno dele até Max
+type Lucidity struct {
+	Starting int `json:"starting"`
+	Growth   int `json:"growth"`
+	Max      int `json:"max"`
+}
+
+// estados bloqueados por um estado de sonho
+type StateLock struct {
+	States []DreamState `json:"states"` // estados que não pegam
+	Rounds int          `json:"rounds"` // imunidade depois que o estado acaba
+}
+
+// regras clássicas do Alucinari
+func DefaultRules() Rules {
+	return Rules{
+		StartingSanity:  40,
+		HandSize:        10,
+		DrawPerTurn:     1,
+		SleepyDrain:     3,
+		ConsciousRegen:  1,
+		ScaredDrain:     4,
+		ConsciousRounds: 2,
+		ParalyzedRounds: 1,
+		ScaredRounds:    2,
+	}
+}
+
+// confere se os números fazem sentido
+func (r Rules) Validate() error {
+	var problems []error
+	if r.StartingSanity <= 0 {
+		problems = append(problems, errors.New("startingSanity precisa ser positivo"))
+	}
+	if r.HandSize <= 0 {
+		problems = append(problems, errors.New("handSize precisa ser positivo"))
+	}
+	if r.DrawPerTurn < 0 {
+		problems = append(problems, errors.New("drawPerTurn não pode ser negativo"))
+	}
+	if r.SleepyDrain < 0 || r.ConsciousRegen < 0 || r.ScaredDrain < 0 {
+		problems = append(problems, errors.New("sleepyDrain, consciousRegen e scaredDrain não podem ser negativos"))
+	}
+	if r.ConsciousRounds < 1 || r.ParalyzedRounds < 1 || r.ScaredRounds < 1 {
+		problems = append(problems, errors.New("consciousRounds, paralyzedRounds e scaredRounds precisam ser pelo menos 1"))
+	}
+	if r.Compensation.Sanity < 0 || r.Compensation.Cards < 0 {
+		problems = append(problems, errors.New("compensation: sanity e cards não podem ser negativos"))
+	}
+	if lucidity := r.Lucidity; lucidity != nil {
+		if lucidity.Starting < 0 || lucidity.Growth < 0 {
+			problems = append(problems, errors.New("lucidity: starting e growth não podem ser negativos"))
+		}
+		if lucidity.Max <= 0 || lucidity.Max < lucidity.Starting {
+			problems = append(problems, errors.New("lucidity: max precisa ser positivo e pelo menos starting"))
+		}
+	}
+	for _, state := range slices.Sorted(maps.Keys(r.StateLocks)) {
+		lock := r.StateLocks[state]
+		if !state.known() {
+			problems = append(problems, fmt.Errorf("stateLocks: estado desconhecido %q", state))
+		}
+		for _, locked := range lock.States {
+			if !locked.known() {
+				problems = append(problems, fmt.Errorf("stateLocks %s: estado desconhecido %q", state, locked))
+			}
+		}
+		if lock.Rounds < 0 {
+			problems = append(problems, fmt.Errorf("stateLocks %s: rounds não pode ser negativo", state))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+type DreamState string
+
+const (
+	Sleepy    DreamState = "adormecido"
+	Conscious DreamState = "consciente"
+	Paralyzed DreamState = "paralisado"
+	Scared    DreamState = "assustado"
+)
+
+func (d DreamState) known() bool {
+	switch d {
+	case Sleepy, Conscious, Paralyzed, Scared:
+		return true
+	}
+	return false
+}
+
+type Phase string
+
+const (
+	PhaseMulligan Phase = "mulligan" // jogadores escolhendo cartas para trocar
+	PhasePlaying  Phase = "playing"
+)
+
+// estado completo de uma partida
+type State struct {
+	Rules            Rules                   `json:"rules"`
+	Phase            Phase                   `json:"phase"`
+	Players          []string                `json:"players"`              // UIDs na ordem dos turnos
+	Teams            map[string]int          `json:"teams,omitempty"`      // time de cada jogador (vazio = todos contra todos)
+	Eliminated       map[string]bool         `json:"eliminated,omitempty"` // quem já saiu da partida (sanidade 0, sem cartas ou desistência)
+	Turn             string                  `json:"turn"`                 // UID de quem joga agora
+	FirstPlayer      string                  `json:"firstPlayer"`          // quem ganhou o cara ou coroa
+	Round            int                     `json:"round"`
+	Hand             map[string][]cards.Card `json:"hand"`
+	Library          map[string][]cards.Card `json:"library"` // resto do deck, de onde saem as compras
+	Discard          map[string][]cards.Card `json:"discard"` // cartas descartadas
+	Sanity           map[string]int          `json:"sanity"`
+	DreamStates      map[string]DreamState   `json:"dreamStates"`
+	RoundsInState    map[string]int          `json:"roundsInState"`    // para controlar duração dos estados
+	StateRounds      map[string]int          `json:"stateRounds"`      // duração do estado atual (0 = a do ruleset)
+	StateLockedUntil map[string]int          `json:"stateLockedUntil"` // até que rodada valem as LockedStates
+	LockedStates     map[string][]DreamState `json:"lockedStates"`     // estados que não pegam no jogador
+	Mulliganed       map[string]bool         `json:"mulliganed"`       // quem já resolveu o mulligan
+	Lucidity         map[string]int          `json:"lucidity"`         // lucidez para gastar neste turno
+	MaxLucidity      map[string]int          `json:"maxLucidity"`      // até onde a lucidez enche
+	Stack            []StackEntry            `json:"stack,omitempty"`  // carta esperando a janela de reação
+	Random           uint64                  `json:"random"`           // estado do gerador (ver random.go)
+	Finished         bool                    `json:"finished"`
+	Result           *Result                 `json:"result,omitempty"`
+}
+
+// carta jogada que ainda não resolveu
+type StackEntry struct {
+	Player string     `json:"player"`
+	Target string     `json:"target"` // quem recebe a carta (é quem pode reagir)
+	Card   cards.Card `json:"card"`
+}
+
+type EndReason string
+
+const (
+	SanityZero     EndReason = "sanityZero"     // alguém chegou a 0 de sanidade
+	CardsExhausted EndReason = "cardsExhausted" // acabaram as cartas de todos
+	DeckOut        EndReason = "deckOut"        // alguém precisou comprar com a pilha vazia (com handDeckOut, e a mão vazia)
+	Forfeit        EndReason = "forfeit"        // alguém desistiu
+	Disconnect     EndReason = "disconnect"     // alguém caiu da partida (GiveUp com esse Reason)
+	Timeout        EndReason = "timeout"        // alguém estourou o tempo vezes demais (GiveUp com esse Reason)
+)
+
+// resultado da partida
+type Result struct {
+	Winners []string  `json:"winners"` // vazio = empate
+	Reason  EndReason `json:"reason"`
+}
+
+type ActionType string
+
+const (
+	PlayCard ActionType = "playCard" // joga uma carta da mão
+	SkipTurn ActionType = "skipTurn" // perde o turno (paralisado ou timeout)
+	GiveUp   ActionType = "giveUp"   // desiste da partida
+	Mulligan ActionType = "mulligan" // devolve CardIDs para a pilha e compra de novo
+	React    ActionType = "react"    // responde a carta da pilha com a reação CardID
+	Pass     ActionType = "pass"     // deixa a carta da pilha resolver sem reagir
+	EndTurn  ActionType = "endTurn"  // acaba o turno (com lucidez; sem ela jogar a carta já acaba, e só passa quem não tem o que jogar)
+)
+
+type Action struct {
+	Type    ActionType `json:"type"`
+	Player  string     `json:"player"`
+	CardID  string     `json:"cardID,omitempty"`  // instância (ou CID) da carta em PlayCard e React
+	Target  string     `json:"target,omitempty"`  // oponente que recebe a carta em PlayCard (vazio = o único oponente)
+	CardIDs []string   `json:"cardIDs,omitempty"` // instâncias (ou CIDs) devolvidas em Mulligan (vazio = fica com a mão)
+	Reason  string     `json:"reason,omitempty"`  // motivo em SkipTurn e GiveUp
+}
+
+// motivos de SkipTurn
+const (
+	SkipParalyzed = "paralisado"
+	SkipTimeout   = "timeout"
+	SkipNoPlay    = "semJogada" // EndTurn sem lucidez, de quem não tinha carta para jogar
+)
+
+// motivos de ReactionClosed
+const (
+	ReactionUsed   = "reagiu"
+	ReactionPassed = "passou"  // também quando a janela expira
+	ReactionVoid   = "anulada" // alguém envolvido na carta saiu da partida
+)
+
+// motivo de CardsDrawn na compra do começo do turno (efeitos de carta não têm motivo)
+const DrawTurn = "turno"
+
+type EventType string
+
+const (
+	CardPlayed       EventType = "cardPlayed"       // Player jogou Card em Target
+	TurnSkipped      EventType = "turnSkipped"      // Player perdeu o turno por Reason
+	SanityChanged    EventType = "sanityChanged"    // sanidade de Target mudou Amount (Reason = estado de sonho, no fim da rodada)
+	StateChanged     EventType = "stateChanged"     // Target entrou no estado State
+	StateResisted    EventType = "stateResisted"    // Target estava imune ao estado State da carta de Player
+	CardsDrawn       EventType = "cardsDrawn"       // Target comprou Amount cartas
+	CardsDiscarded   EventType = "cardsDiscarded"   // Target descartou Amount cartas
+	MulliganDone     EventType = "mulliganDone"     // Player trocou Amount cartas
+	CardResolved     EventType = "cardResolved"     // Card de Player terminou de resolver (fecha os efeitos dela)
+	PlayerEliminated EventType = "playerEliminated" // Player saiu da partida por Reason e a partida continua sem ele
+	ReactionOpened   EventType = "reactionOpened"   // Player pode reagir à Card de Target
+	ReactionPlayed   EventType = "reactionPlayed"   // Player reagiu com Card
+	ReactionClosed   EventType = "reactionClosed"   // janela de Player fechou por Reason
+	EffectCanceled   EventType = "effectCanceled"   // a reação de Target anulou o estado State da carta de Player
+	DamageReflected  EventType = "damageReflected"  // Player devolveu Amount de dano para Target
+	RoundEnded       EventType = "roundEnded"       // estados de sonho aplicados no fim da rodada
+	TurnStarted      EventType = "turnStarted"      // começou o turno de Player
+	GameEnded        EventType = "gameEnded"        // partida acabou (ver State.Result)
+)
+
+// o que aconteceu durante um Apply
+type Event struct {
+	Type   EventType   `json:"type"`
+	Round  int         `json:"round"`
+	Player string      `json:"player,omitempty"`
+	Target string      `json:"target,omitempty"`
+	Card   *cards.Card `json:"card,omitempty"`
+	State  DreamState  `json:"state,omitempty"`
+	Amount int         `json:"amount,omitempty"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+var (
+	ErrFinished     = errors.New("partida já terminou")
+	ErrNotYourTurn  = errors.New("não é o turno do jogador")
+	ErrNotInMatch   = errors.New("jogador não está na partida")
+	ErrCardNotFound = errors.New("carta não está na mão")
+	ErrParalyzed    = errors.New("jogador está paralisado")
+	ErrMulligan     = errors.New("partida ainda está no mulligan")
+	ErrReacting     = errors.New("esperando a reação do oponente")
+	ErrNoReaction   = errors.New("nenhuma carta esperando reação")
+	ErrNotDefender  = errors.New("só quem recebeu a carta pode reagir")
+	ErrNotReaction  = errors.New("carta não é de reação")
+	ErrReactionOnly = errors.New("carta de reação só pode ser jogada em resposta")
+	ErrNoLucidity   = errors.New("lucidez insuficiente para a carta")
+	ErrNoEndTurn    = errors.New("o turno acaba ao jogar uma carta neste ruleset (só passa a vez quem não tem carta para jogar)")
+	ErrNotMulligan  = errors.New("mulligan já acabou")
+	ErrMulliganUsed = errors.New("jogador já fez mulligan")
+	ErrEliminated   = errors.New("jogador já foi eliminado")
+	ErrNoTarget     = errors.New("escolha o oponente que recebe a carta")
+	ErrBadTarget    = errors.New("o alvo precisa ser um oponente ainda na partida")
+	ErrUnknown      = errors.New("ação desconhecida")
+)
+
+// como montar uma partida
+type Setup struct {
+	Rules   Rules
+	Seed    int64
+	Players []string                // UIDs; a ordem dos turnos sai daqui, a partir de quem começa
+	Decks   map[string][]cards.Card // deck de cada jogador
+	First   string                  // quem começa sem cara ou coroa (revanche); vazio = cara ou coroa
+	Teams   map[string]int          // time de cada jogador (nil = todos contra todos)
+}
+
+// cria o estado inicial de uma partida de dois, todos contra todos
+func New(rules Rules, seed int64, players []string, decks map[string][]cards.Card) State {
+	return Start(Setup{Rules: rules, Seed: seed, Players: players, Decks: decks})
+}
+
+// cria o estado inicial
+// quem começa sai de um cara ou coroa com a seed (ou é o First); a ordem
+// dos turnos segue a de Players a partir dele, e os outros ganham a
+// compensação do ruleset. cada deck é embaralhado com a seed; as primeiras
+// handSize cartas vão para a mão e o resto fica na pilha de compra
+// com lucidez, quem começa já tem a lucidez do primeiro turno
+// com rules.Mulligan a partida começa na fase de mulligan
+// com times, quem está no mesmo time não se ataca e ganha (ou perde) junto
+func Start(setup Setup) State {
+	rules, players, decks := setup.Rules, setup.Players, setup.Decks
+	s := State{
+		Rules:            rules,
+		Phase:            PhasePlaying,
+		Round:            1,
+		Hand:             make(map[string][]cards.Card),
+		Library:          make(map[string][]cards.Card),
+		Discard:          make(map[string][]cards.Card),
+		Sanity:           make(map[string]int),
+		DreamStates:      make(map[string]DreamState),
+		RoundsInState:    make(map[string]int),
+		StateRounds:      make(map[string]int),
+		StateLockedUntil: make(map[string]int),
+		LockedStates:     make(map[string][]DreamState),
+		Mulliganed:       make(map[string]bool),
+		Lucidity:         make(map[string]int),
+		MaxLucidity:      make(map[string]int),
+		Eliminated:       make(map[string]bool),
+		Random:           uint64(setup.Seed),
+	}
+	if setup.Teams != nil {
+		s.Teams = maps.Clone(setup.Teams)
+	}
+
+	// cara ou coroa: quem ganha vai para a frente da ordem dos turnos
+	start := slices.Index(players, setup.First)
+	if start < 0 {
+		start = s.intn(len(players))
+	}
+	s.Players = append(append([]string(nil), players[start:]...), players[:start]...)
+	s.Turn = s.Players[0]
+	s.FirstPlayer = s.Turn
+
+	for _, uid := range s.Players {
+		deck := append([]cards.Card(nil), decks[uid]...)
+		for i := range deck {
+			deck[i].Instance = fmt.Sprintf("%s-%d", uid, i)
+		}
+		s.shuffle(deck)
+		handSize := min(rules.HandSize, len(deck))
+		s.Hand[uid] = deck[:handSize:handSize]
+		s.Library[uid] = deck[handSize:]
+		s.Discard[uid] = []cards.Card{}
+		s.Sanity[uid] = rules.StartingSanity
+		s.DreamStates[uid] = Sleepy
+		s.RoundsInState[uid] = 0
+		s.StateRounds[uid] = 0
+		s.StateLockedUntil[uid] = 0
+		s.LockedStates[uid] = []DreamState{}
+		s.Mulliganed[uid] = false
+		s.Lucidity[uid] = 0
+		s.MaxLucidity[uid] = 0
+	}
+	s.refillLucidity(s.Turn)
+
+	for _, uid := range s.Players[1:] {
+		s.compensate(uid)
+	}
+
+	// uma partida pode já nascer terminada (ninguém tem carta)
+	if !s.checkEnd() && rules.Mulligan {
+		s.Phase = PhaseMulligan
+	}
+
+	return s
+}
+
+// cópia profunda, para o Apply nunca mexer no estado de quem chamou
+func (s State) Clone() State {
+	c := s
+	c.Players = append([]string(nil), s.Players...)
+	if s.Teams != nil {
+		c.Teams = maps.Clone(s.Teams)
+	}
+	c.Eliminated = cloneMap(s.Eliminated)
+	c.Hand = clonePiles(s.Hand)
+	c.Library = clonePiles(s.Library)
+	c.Discard = clonePiles(s.Discard)
+	c.Sanity = cloneMap(s.Sanity)
+	c.DreamStates = cloneMap(s.DreamStates)
+	c.RoundsInState = cloneMap(s.RoundsInState)
+	c.StateRounds = cloneMap(s.StateRounds)
+	c.StateLockedUntil = cloneMap(s.StateLockedUntil)
+	c.Mulliganed = cloneMap(s.Mulliganed)
+	c.Lucidity = cloneMap(s.Lucidity)
+	c.MaxLucidity = cloneMap(s.MaxLucidity)
+	c.Stack = append([]StackEntry(nil), s.Stack...)
+	c.LockedStates = make(map[string][]DreamState, len(s.LockedStates))
+	for uid, states := range s.LockedStates {
+		c.LockedStates[uid] = append([]DreamState(nil), states...)
+	}
+	if s.Result != nil {
+		result := *s.Result
+		result.Winners = append([]string(nil), s.Result.Winners...)
+		c.Result = &result
+	}
+	return c
+}
+
+func clonePiles(piles map[string][]cards.Card) map[string][]cards.Card {
+	c := make(map[string][]cards.Card, len(piles))
+	for uid, pile := range piles {
+		c[uid] = append(make([]cards.Card, 0, len(pile)), pile...) // pilha vazia continua [] no JSON
+	}
+	return c
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// o jogador da vez perde o turno por estar paralisado?
+func (s State) MustSkip() bool {
+	return s.DreamStates[s.Turn] == Paralyzed
+}
+
+// primeiro oponente ainda na partida (numa partida de dois, o oponente)
+func (s State) Opponent(uid string) string {
+	if opponents := s.Opponents(uid); len(opponents) > 0 {
+		return opponents[0]
+	}
+	return ""
+}
+
+// oponentes ainda na partida, na ordem dos turnos
+func (s State) Opponents(uid string) []string {
+	var opponents []string
+	for _, other := range s.Players {
+		if !s.Eliminated[other] && !s.Allies(uid, other) {
+			opponents = append(opponents, other)
+		}
+	}
+	return opponents
+}
+
+// os dois estão do mesmo lado? (todo jogador é aliado de si mesmo)
+func (s State) Allies(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if s.Teams == nil {
+		return false
+	}
+	return s.Teams[a] == s.Teams[b]
+}
+
+// time do jogador; sem times, cada um é o próprio time
+func (s State) Team(uid string) int {
+	if s.Teams != nil {
+		return s.Teams[uid]
+	}
+	return slices.Index(s.Players, uid)
+}
+
+// aplica uma ação e devolve o estado novo e os eventos
+// se a ação for inválida, devolve o mesmo estado e o erro
+func Apply(s State, action Action) (State, []Event, error) {
+	if s.Finished {
+		return s, nil, ErrFinished
+	}
+	if _, ok := s.Sanity[action.Player]; !ok {
+		return s, nil, ErrNotInMatch
+	}
+	if s.Eliminated[action.Player] {
+		return s, nil, ErrEliminated
+	}
+
+	next := s.Clone()
+	var events []Event
+
+	// no mulligan só vale trocar cartas ou desistir
+	if s.Phase == PhaseMulligan && action.Type != Mulligan && action.Type != GiveUp {
+		return s, nil, ErrMulligan
+	}
+
+	// com carta na pilha só vale reagir, passar ou desistir
+	if len(s.Stack) > 0 && action.Type != React && action.Type != Pass && action.Type != GiveUp {
+		return s, nil, ErrReacting
+	}
+
+	switch action.Type {
+	case Mulligan:
+		if s.Phase != PhaseMulligan {
+			return s, nil, ErrNotMulligan
+		}
+		if s.Mulliganed[action.Player] {
+			return s, nil, ErrMulliganUsed
+		}
+
+		mulligan, ok := next.mulligan(action.Player, action.CardIDs)
+		if !ok {
+			return s, nil, ErrCardNotFound
+		}
+		events = mulligan
+
+	case PlayCard:
+		if action.Player != s.Turn {
+			return s, nil, ErrNotYourTurn
+		}
+		if s.DreamStates[action.Player] == Paralyzed {
+			return s, nil, ErrParalyzed
+		}
+
+		card, ok := next.removeFromHand(action.Player, action.CardID)
+		if !ok {
+			return s, nil, ErrCardNotFound
+		}
+		if card.CardType == cards.Reaction {
+			return s, nil, ErrReactionOnly
+		}
+		target, err := s.cardTarget(action.Player, card, action.Target)
+		if err != nil {
+			return s, nil, err
+		}
+		if !next.pay(action.Player, card) {
+			return s, nil, ErrNoLucidity
+		}
+
+		events = next.playCard(action.Player, card, target)
+		// com a janela de reação aberta, o turno só acaba depois do React/Pass
+		if len(next.Stack) == 0 {
+			events = append(events, next.afterCard()...)
+		}
+
+	case React, Pass:
+		if len(s.Stack) == 0 {
+			return s, nil, ErrNoReaction
+		}
+		defender := s.Stack[len(s.Stack)-1].Target
+		if action.Player != defender {
+			return s, nil, ErrNotDefender
+		}
+
+		var reaction *cards.Card
+		if action.Type == React {
+			card, ok := next.removeFromHand(action.Player, action.CardID)
+			if !ok {
+				return s, nil, ErrCardNotFound
+			}
+			if card.CardType != cards.Reaction {
+				return s, nil, ErrNotReaction
+			}
+			if !next.pay(action.Player, card) {
+				return s, nil, ErrNoLucidity
+			}
+			reaction = &card
+		}
+
+		events = next.resolveStack(defender, reaction)
+		events = append(events, next.afterCard()...)
+
+	case EndTurn:
+		if action.Player != s.Turn {
+			return s, nil, ErrNotYourTurn
+		}
+		// sem lucidez a carta acaba o turno: só passa quem não tem o que jogar
+		// (mão vazia ou só com reações)
+		if s.Rules.Lucidity == nil {
+			if s.hasPlay(action.Player) {
+				return s, nil, ErrNoEndTurn
+			}
+			events = append(events, Event{Type: TurnSkipped, Round: next.Round, Player: action.Player, Reason: SkipNoPlay})
+		}
+
+		events = append(events, next.endTurn()...)
+
+	case SkipTurn:
+		if action.Player != s.Turn {
+			return s, nil, ErrNotYourTurn
+		}
+
+		events = append(events, Event{Type: TurnSkipped, Round: next.Round, Player: action.Player, Reason: action.Reason})
+		events = append(events, next.endTurn()...)
+
+	case GiveUp:
+		// desistir vale a qualquer momento; o servidor também usa para
+		// quem caiu ou estourou o tempo
+		reason := Forfeit
+		if action.Reason == string(Disconnect) || action.Reason == string(Timeout) {
+			reason = EndReason(action.Reason)
+		}
+
+		events = next.giveUp(action.Player, reason)
+
+	default:
+		return s, nil, ErrUnknown
+	}
+
+	return next, events, nil
+}
@@ -0,0 +1,368 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"pbl-redes/cards"
+)
+
+// regras pequenas para os testes: nada de estado de sonho mexendo na sanidade
+func testRules() Rules {
+	return Rules{
+		StartingSanity:  20,
+		HandSize:        3,
+		DrawPerTurn:     1,
+		ConsciousRounds: 1,
+		ParalyzedRounds: 1,
+		ScaredRounds:    1,
+	}
+}
+
+// deck de n cartas NREM de 1 ponto
+func testDeck(n int) []cards.Card {
+	deck := make([]cards.Card, n)
+	for i := range deck {
+		deck[i] = cards.Card{CID: fmt.Sprintf("T_nrem_%02d", i), CardType: cards.NREM, CardEffect: cards.NEN, Points: 1}
+	}
+	return deck
+}
+
+// cartas avulsas para montar mãos nos testes (as ações usam o CID)
+var (
+	testParalyze  = cards.Card{CID: "T_par", CardType: cards.REM, CardEffect: cards.PAR, Points: 2}
+	testExpensive = cards.Card{CID: "T_cara", CardType: cards.NREM, CardEffect: cards.NEN, Points: 3, Cost: 2}
+	testCheap     = cards.Card{CID: "T_barata", CardType: cards.NREM, CardEffect: cards.NEN, Points: 1, Cost: 1}
+	testShield    = cards.Card{CID: "T_escudo", CardType: cards.Reaction, Effects: []cards.Effect{{Op: cards.Cancel}}}
+)
+
+// partida de dois em que "a" começa
+func testGame(rules Rules, deckA, deckB []cards.Card) State {
+	return Start(Setup{Rules: rules, Seed: 1, Players: []string{"a", "b"}, First: "a", Decks: map[string][]cards.Card{"a": deckA, "b": deckB}})
+}
+
+func mustApply(t *testing.T, s State, action Action) (State, []Event) {
+	t.Helper()
+	next, events, err := Apply(s, action)
+	if err != nil {
+		t.Fatalf("%s de %s: %v", action.Type, action.Player, err)
+	}
+	return next, events
+}
+
+// tem um evento desse tipo (e, se reason não for vazio, com esse Reason)?
+func hasEvent(events []Event, eventType EventType, reason string) bool {
+	for _, event := range events {
+		if event.Type == eventType && (reason == "" || event.Reason == reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// um passo do caso: a ação e o erro esperado (nil = precisa dar certo)
+type step struct {
+	action Action
+	err    error
+}
+
+func play(uid, cid string) Action { return Action{Type: PlayCard, Player: uid, CardID: cid} }
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules func(*Rules)                     // muda as regras de teste (nil = testRules)
+		deck  int                              // tamanho dos dois decks (0 = 6)
+		setup func(*State)                     // mexe na partida antes dos passos
+		steps []step                           // aplicados em ordem; os que falham não mudam o estado
+		check func(*testing.T, State, []Event) // estado final e eventos do último passo que deu certo
+	}{
+		{
+			name:  "carta tira sanidade e passa o turno",
+			steps: []step{{action: play("a", "T_nrem_00")}},
+			check: func(t *testing.T, s State, events []Event) {
+				if s.Sanity["b"] != 19 || s.Turn != "b" {
+					t.Errorf("sanidade de b %d e turno de %s, esperava 19 e b", s.Sanity["b"], s.Turn)
+				}
+				if len(s.Hand["a"]) != 2 || len(s.Hand["b"]) != 4 {
+					t.Errorf("mãos com %d e %d cartas, esperava 2 e 4 (b comprou)", len(s.Hand["a"]), len(s.Hand["b"]))
+				}
+				if !hasEvent(events, CardsDrawn, DrawTurn) {
+					t.Errorf("b não comprou no começo do turno: %+v", events)
+				}
+			},
+		},
+		{
+			name: "jogada inválida",
+			setup: func(s *State) {
+				s.Hand["a"] = append(s.Hand["a"], testShield)
+			},
+			steps: []step{
+				{action: play("b", "T_nrem_00"), err: ErrNotYourTurn},
+				{action: play("a", "T_nada"), err: ErrCardNotFound},
+				{action: play("a", "T_escudo"), err: ErrReactionOnly},
+				{action: Action{Type: Pass, Player: "b"}, err: ErrNoReaction},
+				{action: Action{Type: Mulligan, Player: "a"}, err: ErrNotMulligan},
+			},
+		},
+		{
+			name:  "pilha vazia na compra perde",
+			deck:  3,
+			steps: []step{{action: play("a", "T_nrem_00")}},
+			check: func(t *testing.T, s State, events []Event) {
+				if !s.Finished || s.Result.Reason != DeckOut || !s.IsWinner("a") {
+					t.Errorf("esperava vitória de a por deckOut com %d cartas na mão de b, veio %+v", len(s.Hand["b"]), s.Result)
+				}
+			},
+		},
+		{
+			name:  "com handDeckOut pilha vazia com carta na mão não perde",
+			rules: func(r *Rules) { r.HandDeckOut = true },
+			deck:  3,
+			steps: []step{{action: play("a", "T_nrem_00")}},
+			check: func(t *testing.T, s State, events []Event) {
+				if s.Finished || s.Eliminated["b"] {
+					t.Fatalf("b saiu da partida com %d cartas na mão (resultado %+v)", len(s.Hand["b"]), s.Result)
+				}
+				if s.Turn != "b" || len(s.Hand["b"]) != 3 {
+					t.Errorf("turno %s com %d cartas na mão de b, esperava turno de b com 3", s.Turn, len(s.Hand["b"]))
+				}
+			},
+		},
+		{
+			name:  "com handDeckOut perde sem carta na pilha nem na mão",
+			rules: func(r *Rules) { r.HandDeckOut = true },
+			deck:  3,
+			setup: func(s *State) {
+				s.Hand["b"] = []cards.Card{}
+			},
+			steps: []step{{action: play("a", "T_nrem_00")}},
+			check: func(t *testing.T, s State, events []Event) {
+				if !s.Finished || s.Result.Reason != DeckOut || !s.IsWinner("a") {
+					t.Errorf("esperava vitória de a por deckOut, veio %+v", s.Result)
+				}
+			},
+		},
+		{
+			name:  "mulligan",
+			rules: func(r *Rules) { r.Mulligan = true },
+			steps: []step{
+				{action: play("a", "T_nrem_00"), err: ErrMulligan},
+				{action: Action{Type: Mulligan, Player: "a", CardIDs: []string{"T_nrem_00", "T_nrem_01"}}},
+				{action: Action{Type: Mulligan, Player: "a"}, err: ErrMulliganUsed},
+				{action: Action{Type: Mulligan, Player: "b", CardIDs: []string{"T_nada"}}, err: ErrCardNotFound},
+				{action: Action{Type: Mulligan, Player: "b"}},
+				{action: Action{Type: Mulligan, Player: "b"}, err: ErrNotMulligan},
+			},
+			check: func(t *testing.T, s State, events []Event) {
+				if s.Phase != PhasePlaying || !hasEvent(events, TurnStarted, "") {
+					t.Errorf("fase %s depois dos dois mulligans, esperava %s com turnStarted", s.Phase, PhasePlaying)
+				}
+				if len(s.Hand["a"]) != 3 || len(s.Library["a"]) != 3 {
+					t.Errorf("a com %d na mão e %d na pilha, esperava 3 e 3", len(s.Hand["a"]), len(s.Library["a"]))
+				}
+			},
+		},
+		{
+			name:  "mulligan embaralha a pilha com as cartas devolvidas",
+			rules: func(r *Rules) { r.Mulligan = true },
+			deck:  12,
+			setup: func(s *State) {
+				s.Hand["a"] = append(s.Hand["a"], testCheap, testExpensive)
+			},
+			steps: []step{{action: Action{Type: Mulligan, Player: "a", CardIDs: []string{"T_barata", "T_cara"}}}},
+			check: func(t *testing.T, s State, events []Event) {
+				library := s.Library["a"]
+				if len(library) != 9 {
+					t.Fatalf("pilha de a com %d cartas, esperava 9", len(library))
+				}
+				// sem embaralhar, as duas devolvidas estariam no fundo, nessa ordem
+				if library[7].CID == "T_barata" && library[8].CID == "T_cara" {
+					t.Errorf("cartas devolvidas continuam no fundo da pilha: %v", library[7:])
+				}
+			},
+		},
+		{
+			name:  "janela de reação abre sem reação na mão e resolve ao passar",
+			rules: func(r *Rules) { r.Reactions = true },
+			setup: func(s *State) {
+				s.Hand["b"] = append(s.Hand["b"], testCheap)
+			},
+			steps: []step{
+				{action: play("a", "T_nrem_00")},
+				{action: play("b", "T_barata"), err: ErrReacting},
+				{action: Action{Type: Pass, Player: "a"}, err: ErrNotDefender},
+				{action: Action{Type: React, Player: "b", CardID: "T_barata"}, err: ErrNotReaction},
+				{action: Action{Type: Pass, Player: "b"}},
+			},
+			check: func(t *testing.T, s State, events []Event) {
+				if len(s.Stack) != 0 || s.Sanity["b"] != 19 || s.Turn != "b" {
+					t.Errorf("pilha %d, sanidade de b %d e turno de %s, esperava 0, 19 e b", len(s.Stack), s.Sanity["b"], s.Turn)
+				}
+				if !hasEvent(events, ReactionClosed, ReactionPassed) {
+					t.Errorf("esperava reactionClosed %s: %+v", ReactionPassed, events)
+				}
+			},
+		},
+		{
+			name:  "reação cancela o estado",
+			rules: func(r *Rules) { r.Reactions = true },
+			setup: func(s *State) {
+				s.Hand["a"] = append(s.Hand["a"], testParalyze)
+				s.Hand["b"] = append(s.Hand["b"], testShield)
+			},
+			steps: []step{
+				{action: play("a", "T_par")},
+				{action: Action{Type: React, Player: "b", CardID: "T_escudo"}},
+			},
+			check: func(t *testing.T, s State, events []Event) {
+				if s.DreamStates["b"] == Paralyzed || s.Sanity["b"] != 18 {
+					t.Errorf("b %s com %d de sanidade, esperava o dano sem o paralisado", s.DreamStates["b"], s.Sanity["b"])
+				}
+				if !hasEvent(events, EffectCanceled, "") || !hasEvent(events, ReactionClosed, ReactionUsed) {
+					t.Errorf("esperava effectCanceled e reactionClosed %s: %+v", ReactionUsed, events)
+				}
+			},
+		},
+		{
+			name: "trava segura o estado enquanto ele dura",
+			rules: func(r *Rules) {
+				r.ParalyzedRounds = 3
+				r.StateLocks = map[DreamState]StateLock{Paralyzed: {States: []DreamState{Paralyzed}, Rounds: 2}}
+			},
+			setup: func(s *State) {
+				s.Hand["a"] = append(s.Hand["a"], testParalyze)
+				s.DreamStates["b"] = Paralyzed
+				s.RoundsInState["b"] = 1
+			},
+			steps: []step{{action: play("a", "T_par")}},
+			check: func(t *testing.T, s State, events []Event) {
+				// a contagem continua de onde estava (2), em vez de recomeçar (1)
+				if !hasEvent(events, StateResisted, "") || s.RoundsInState["b"] != 2 {
+					t.Errorf("esperava stateResisted sem recomeçar o paralisado (%d rodadas nele): %+v", s.RoundsInState["b"], events)
+				}
+			},
+		},
+		{
+			name: "trava segura o estado depois que ele acaba",
+			rules: func(r *Rules) {
+				r.StateLocks = map[DreamState]StateLock{Paralyzed: {States: []DreamState{Paralyzed}, Rounds: 2}}
+			},
+			setup: func(s *State) {
+				s.Hand["a"] = append(s.Hand["a"], testParalyze)
+				s.StateLockedUntil["b"] = s.Round + 2
+				s.LockedStates["b"] = []DreamState{Paralyzed}
+			},
+			steps: []step{{action: play("a", "T_par")}},
+			check: func(t *testing.T, s State, events []Event) {
+				if s.DreamStates["b"] == Paralyzed || !hasEvent(events, StateResisted, "") {
+					t.Errorf("b ficou %s, esperava resistir ao paralisado: %+v", s.DreamStates["b"], events)
+				}
+			},
+		},
+		{
+			name:  "sem trava o estado pega",
+			rules: func(r *Rules) { r.ParalyzedRounds = 2 },
+			setup: func(s *State) {
+				s.Hand["a"] = append(s.Hand["a"], testParalyze)
+			},
+			steps: []step{{action: play("a", "T_par")}},
+			check: func(t *testing.T, s State, events []Event) {
+				if s.DreamStates["b"] != Paralyzed || !s.MustSkip() {
+					t.Errorf("b ficou %s, esperava paralisado e perdendo o turno", s.DreamStates["b"])
+				}
+			},
+		},
+		{
+			name:  "lucidez paga as cartas e o turno acaba com endTurn",
+			rules: func(r *Rules) { r.Lucidity = &Lucidity{Starting: 1, Growth: 1, Max: 3} },
+			setup: func(s *State) {
+				s.Hand["a"] = append(s.Hand["a"], testExpensive, testCheap)
+			},
+			steps: []step{
+				{action: play("a", "T_cara"), err: ErrNoLucidity},
+				{action: play("a", "T_barata")},
+				{action: play("a", "T_cara"), err: ErrNoLucidity},
+				{action: Action{Type: EndTurn, Player: "b"}, err: ErrNotYourTurn},
+				{action: Action{Type: EndTurn, Player: "a"}},
+			},
+			check: func(t *testing.T, s State, events []Event) {
+				if s.Sanity["b"] != 19 || s.Turn != "b" {
+					t.Errorf("sanidade de b %d e turno de %s, esperava 19 e b", s.Sanity["b"], s.Turn)
+				}
+				if s.Lucidity["b"] != 1 {
+					t.Errorf("lucidez de b %d no primeiro turno dele, esperava 1", s.Lucidity["b"])
+				}
+			},
+		},
+		{
+			name:  "sem lucidez endTurn só com carta para jogar é recusado",
+			steps: []step{{action: Action{Type: EndTurn, Player: "a"}, err: ErrNoEndTurn}},
+		},
+		{
+			name: "sem lucidez quem só tem reação passa a vez",
+			setup: func(s *State) {
+				s.Hand["a"] = []cards.Card{testShield}
+			},
+			steps: []step{{action: Action{Type: EndTurn, Player: "a"}}},
+			check: func(t *testing.T, s State, events []Event) {
+				if !hasEvent(events, TurnSkipped, SkipNoPlay) || s.Turn != "b" {
+					t.Errorf("turno de %s, esperava turnSkipped %s e turno de b: %+v", s.Turn, SkipNoPlay, events)
+				}
+			},
+		},
+		{
+			name:  "desistência",
+			steps: []step{{action: Action{Type: GiveUp, Player: "b"}}},
+			check: func(t *testing.T, s State, events []Event) {
+				if !s.Finished || s.Result.Reason != Forfeit || !s.IsWinner("a") {
+					t.Errorf("esperava vitória de a por forfeit, veio %+v", s.Result)
+				}
+				if _, _, err := Apply(s, play("a", "T_nrem_00")); err != ErrFinished {
+					t.Errorf("jogada depois do fim: esperava ErrFinished, veio %v", err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := testRules()
+			if test.rules != nil {
+				test.rules(&rules)
+			}
+			deck := test.deck
+			if deck == 0 {
+				deck = 6
+			}
+			s := testGame(rules, testDeck(deck), testDeck(deck))
+			if test.setup != nil {
+				test.setup(&s)
+			}
+
+			var events []Event
+			for i, step := range test.steps {
+				next, stepEvents, err := Apply(s, step.action)
+				if err != step.err {
+					t.Fatalf("passo %d (%s de %s): esperava erro %v, veio %v", i, step.action.Type, step.action.Player, step.err, err)
+				}
+				if err == nil {
+					s, events = next, stepEvents
+				}
+			}
+			if test.check != nil {
+				test.check(t, s, events)
+			}
+		})
+	}
+}
+
+func TestApplyDoesNotChangeState(t *testing.T) {
+	s := testGame(testRules(), testDeck(6), testDeck(6))
+	hand := len(s.Hand["a"])
+
+	mustApply(t, s, play("a", "T_nrem_00"))
+	if len(s.Hand["a"]) != hand || s.Sanity["b"] != 20 || s.Turn != "a" {
+		t.Errorf("Apply mexeu no estado recebido: mão %d, sanidade de b %d, turno de %s", len(s.Hand["a"]), s.Sanity["b"], s.Turn)
+	}
+}
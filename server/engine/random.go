@@ -0,0 +1,26 @@
+package engine
+
+import "pbl-redes/cards"
+
+// gerador pseudoaleatório guardado dentro do State (splitmix64), para o
+// Apply continuar puro: mesmo estado + mesma ação = mesmo resultado
+func (s *State) nextRandom() uint64 {
+	s.Random += 0x9E3779B97F4A7C15
+	z := s.Random
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// número entre 0 e n-1
+func (s *State) intn(n int) int {
+	return int(s.nextRandom() % uint64(n))
+}
+
+// embaralha as cartas no lugar (Fisher-Yates)
+func (s *State) shuffle(pile []cards.Card) {
+	for i := len(pile) - 1; i > 0; i-- {
+		j := s.intn(i + 1)
+		pile[i], pile[j] = pile[j], pile[i]
+	}
+}
@@ -0,0 +1,510 @@
+package engine
+
+import (
+	"slices"
+
+	"pbl-redes/cards"
+)
+
+// remove carta da mão pela instância (ou pelo CID, a primeira cópia)
+func (s *State) removeFromHand(playerUID, id string) (cards.Card, bool) {
+	hand := s.Hand[playerUID]
+
+	i := slices.IndexFunc(hand, func(c cards.Card) bool { return c.Instance == id })
+	if i < 0 {
+		i = slices.IndexFunc(hand, func(c cards.Card) bool { return c.CID == id })
+	}
+	if i < 0 {
+		return cards.Card{}, false
+	}
+
+	card := hand[i]
+	s.Hand[playerUID] = append(hand[:i], hand[i+1:]...)
+	return card, true
+}
+
+// compensação de quem não começa
+func (s *State) compensate(uid string) {
+	compensation := s.Rules.Compensation
+
+	s.Sanity[uid] += compensation.Sanity
+	if compensation.Cards > 0 {
+		s.draw(uid, compensation.Cards)
+	}
+	if compensation.Conscious {
+		// uma contagem por turno de cada um: dura até o fim do primeiro turno dele
+		s.setState(uid, Conscious, len(s.Players))
+	}
+}
+
+// devolve as cartas escolhidas para a pilha, embaralha e compra o mesmo
+// tanto do topo (sem embaralhar, quem troca sabe que as devolvidas estão no
+// fundo); quando todos resolveram, começa a rodada 1
+func (s *State) mulligan(playerUID string, cids []string) ([]Event, bool) {
+	var returned []cards.Card
+	for _, cid := range cids {
+		card, ok := s.removeFromHand(playerUID, cid)
+		if !ok {
+			return nil, false
+		}
+		returned = append(returned, card)
+	}
+
+	s.Library[playerUID] = append(s.Library[playerUID], returned...)
+	s.shuffle(s.Library[playerUID])
+	s.draw(playerUID, len(returned))
+	s.Mulliganed[playerUID] = true
+
+	events := []Event{{Type: MulliganDone, Round: s.Round, Player: playerUID, Amount: len(returned)}}
+
+	return append(events, s.endMulligan()...), true
+}
+
+// quando todos os que ficaram resolveram o mulligan, começa a rodada 1
+func (s *State) endMulligan() []Event {
+	for _, uid := range s.Players {
+		if !s.Mulliganed[uid] && !s.Eliminated[uid] {
+			return nil
+		}
+	}
+
+	s.Phase = PhasePlaying
+	return []Event{{Type: TurnStarted, Round: s.Round, Player: s.Turn}}
+}
+
+// quem recebe a carta: Pill é jogada em quem jogou, o resto no oponente
+// escolhido (com um oponente só, não precisa escolher)
+func (s State) cardTarget(playerUID string, card cards.Card, target string) (string, error) {
+	if card.CardType == cards.Pill {
+		return playerUID, nil
+	}
+
+	opponents := s.Opponents(playerUID)
+	if target == "" {
+		if len(opponents) != 1 {
+			return "", ErrNoTarget
+		}
+		return opponents[0], nil
+	}
+	if !slices.Contains(opponents, target) {
+		return "", ErrBadTarget
+	}
+	return target, nil
+}
+
+// joga a carta em targetUID: anuncia, manda para o descarte e roda a lista
+// de efeitos dela; com reações a carta fica na pilha e abre a janela de
+// reação para o alvo, tenha ele reação ou não (a janela é pública, e abrir só
+// para quem tem entregaria a mão dele)
+func (s *State) playCard(playerUID string, card cards.Card, targetUID string) []Event {
+	s.Discard[playerUID] = append(s.Discard[playerUID], card)
+
+	events := []Event{{Type: CardPlayed, Round: s.Round, Player: playerUID, Target: targetUID, Card: &card}}
+
+	// Pill não mira o oponente, então não abre janela
+	if s.Rules.Reactions && card.CardType != cards.Pill {
+		s.Stack = []StackEntry{{Player: playerUID, Target: targetUID, Card: card}}
+		return append(events, Event{Type: ReactionOpened, Round: s.Round, Player: targetUID, Target: playerUID, Card: &card})
+	}
+
+	foe := targetUID
+	if foe == playerUID {
+		// Pill: o "oponente" dos efeitos dela continua sendo o primeiro oponente
+		foe = s.Opponent(playerUID)
+	}
+	events = append(events, s.runEffects(playerUID, foe, card.EffectList(), nil)...)
+	return append(events, Event{Type: CardResolved, Round: s.Round, Player: playerUID, Card: &card})
+}
+
+// o jogador tem alguma carta que dê para jogar no próprio turno? (reação não)
+func (s *State) hasPlay(uid string) bool {
+	for _, card := range s.Hand[uid] {
+		if card.CardType != cards.Reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve a pilha: a reação (se teve) resolve primeiro, armando a guarda,
+// e depois a carta que estava esperando
+func (s *State) resolveStack(defender string, reaction *cards.Card) []Event {
+	entry := s.Stack[len(s.Stack)-1]
+	s.Stack = nil
+
+	var events []Event
+	var g *guard
+	reason := ReactionPassed
+
+	if reaction != nil {
+		s.Discard[defender] = append(s.Discard[defender], *reaction)
+		events = append(events, Event{Type: ReactionPlayed, Round: s.Round, Player: defender, Target: entry.Player, Card: reaction})
+
+		var reacted []Event
+		g, reacted = s.react(defender, entry.Player, reaction.EffectList())
+		events = append(events, reacted...)
+		reason = ReactionUsed
+	}
+
+	events = append(events, Event{Type: ReactionClosed, Round: s.Round, Player: defender, Reason: reason})
+	events = append(events, s.runEffects(entry.Player, entry.Target, entry.Card.EffectList(), g)...)
+	return append(events, Event{Type: CardResolved, Round: s.Round, Player: entry.Player, Card: &entry.Card})
+}
+
+// dá para pagar o custo da carta? sem lucidez no ruleset tudo é de graça
+func (s *State) canPay(uid string, card cards.Card) bool {
+	return s.Rules.Lucidity == nil || card.Cost <= s.Lucidity[uid]
+}
+
+// paga o custo da carta com a lucidez do jogador
+func (s *State) pay(uid string, card cards.Card) bool {
+	if !s.canPay(uid, card) {
+		return false
+	}
+	if s.Rules.Lucidity != nil {
+		s.Lucidity[uid] -= card.Cost
+	}
+	return true
+}
+
+// enche a lucidez no começo do turno; o máximo cresce a cada turno do jogador
+// (Round conta os turnos de todo mundo, então divide pelo número de jogadores)
+func (s *State) refillLucidity(uid string) {
+	lucidity := s.Rules.Lucidity
+	if lucidity == nil {
+		return
+	}
+	turns := (s.Round - 1) / len(s.Players)
+	s.MaxLucidity[uid] = min(lucidity.Starting+lucidity.Growth*turns, lucidity.Max)
+	s.Lucidity[uid] = s.MaxLucidity[uid]
+}
+
+// depois que a carta resolve: sem lucidez o turno acaba aqui; com lucidez o
+// jogador continua até mandar EndTurn, mas a partida pode ter acabado (ou
+// ele mesmo pode ter sido eliminado, e aí o turno passa)
+func (s *State) afterCard() []Event {
+	if s.Rules.Lucidity == nil {
+		return s.endTurn()
+	}
+	if s.checkEnd() {
+		return []Event{{Type: GameEnded, Round: s.Round, Reason: string(s.Result.Reason)}}
+	}
+	events := s.eliminate()
+	if s.Eliminated[s.Turn] {
+		events = append(events, s.passTurn()...)
+	}
+	return events
+}
+
+// coloca o jogador num estado de sonho, zerando a contagem
+// rounds = 0 usa a duração do ruleset
+func (s *State) setState(uid string, state DreamState, rounds int) Event {
+	// saindo de um estado com trava, começa a janela de imunidade
+	if lock, ok := s.Rules.StateLocks[s.DreamStates[uid]]; ok && s.DreamStates[uid] != state {
+		s.StateLockedUntil[uid] = s.Round + lock.Rounds
+		s.LockedStates[uid] = append([]DreamState(nil), lock.States...)
+	}
+
+	s.DreamStates[uid] = state
+	s.RoundsInState[uid] = 0
+	s.StateRounds[uid] = rounds
+	return Event{Type: StateChanged, Round: s.Round, Target: uid, State: state}
+}
+
+// o jogador está imune a entrar nesse estado agora?
+func (s *State) resists(uid string, state DreamState) bool {
+	// enquanto está no estado, vale a trava dele
+	if lock, ok := s.Rules.StateLocks[s.DreamStates[uid]]; ok && slices.Contains(lock.States, state) {
+		return true
+	}
+	// janela de imunidade depois que o estado acabou
+	return s.Round <= s.StateLockedUntil[uid] && slices.Contains(s.LockedStates[uid], state)
+}
+
+// duração do estado atual do jogador
+func (s *State) stateDuration(uid string, defaultRounds int) int {
+	if s.StateRounds[uid] > 0 {
+		return s.StateRounds[uid]
+	}
+	return defaultRounds
+}
+
+// fim do turno: aplica os estados, vê se acabou e passa a vez
+func (s *State) endTurn() []Event {
+	events := s.tickDreamStates()
+
+	if s.checkEnd() {
+		return append(events, Event{Type: GameEnded, Round: s.Round, Reason: string(s.Result.Reason)})
+	}
+
+	events = append(events, s.eliminate()...)
+	return append(events, s.passTurn()...)
+}
+
+// troca de turno para o próximo que ainda está na partida
+func (s *State) passTurn() []Event {
+	s.Turn = s.nextPlayer()
+	s.Round++
+	s.refillLucidity(s.Turn)
+	events := []Event{{Type: TurnStarted, Round: s.Round, Player: s.Turn}}
+
+	return append(events, s.drawForTurn()...)
+}
+
+// compra do começo do turno; quem precisa comprar com a pilha vazia perde
+// (sai da partida, e numa partida de mais de dois o turno passa)
+// com handDeckOut, a pilha vazia só tira a compra e perde quem também não
+// tem mais nada na mão
+func (s *State) drawForTurn() []Event {
+	if s.Rules.DrawPerTurn == 0 {
+		return nil
+	}
+
+	if len(s.Library[s.Turn]) == 0 {
+		if s.Rules.HandDeckOut && len(s.Hand[s.Turn]) > 0 {
+			return nil
+		}
+		return s.knockOut(s.Turn, DeckOut)
+	}
+
+	event := s.draw(s.Turn, s.Rules.DrawPerTurn)
+	event.Reason = DrawTurn
+	return []Event{event}
+}
+
+// aplica os efeitos dos estados de sonho de todos os jogadores
+func (s *State) tickDreamStates() []Event {
+	var events []Event
+
+	for _, playerUID := range s.Players {
+		if s.Eliminated[playerUID] {
+			continue
+		}
+		state := s.DreamStates[playerUID]
+
+		switch state {
+		case Sleepy:
+			events = append(events, s.dreamSanity(playerUID, -s.Rules.SleepyDrain)...)
+		case Conscious:
+			events = append(events, s.dreamSanity(playerUID, s.Rules.ConsciousRegen)...)
+			s.RoundsInState[playerUID]++
+			if s.RoundsInState[playerUID] >= s.stateDuration(playerUID, s.Rules.ConsciousRounds) {
+				events = append(events, s.setState(playerUID, Sleepy, 0))
+			}
+		case Paralyzed:
+			s.RoundsInState[playerUID]++
+			if s.RoundsInState[playerUID] >= s.stateDuration(playerUID, s.Rules.ParalyzedRounds) {
+				events = append(events, s.setState(playerUID, Sleepy, 0))
+			}
+		case Scared:
+			events = append(events, s.dreamSanity(playerUID, -s.Rules.ScaredDrain)...)
+			s.RoundsInState[playerUID]++
+			if s.RoundsInState[playerUID] >= s.stateDuration(playerUID, s.Rules.ScaredRounds) {
+				events = append(events, s.setState(playerUID, Sleepy, 0))
+			}
+		}
+	}
+
+	// a rodada fecha depois dos estados aplicados
+	return append(events, Event{Type: RoundEnded, Round: s.Round, Player: s.Turn})
+}
+
+// sanidade que o estado de sonho tira ou dá no fim da rodada
+// (o evento leva o estado no Reason; changeSanity não deixa ficar negativa)
+func (s *State) dreamSanity(uid string, delta int) []Event {
+	event := s.changeSanity(uid, delta)
+	if event.Amount == 0 {
+		return nil
+	}
+	event.Reason = string(s.DreamStates[uid])
+	return []Event{event}
+}
+
+// próximo jogador na ordem dos turnos (pulando quem já saiu)
+func (s *State) nextPlayer() string {
+	i := slices.Index(s.Players, s.Turn)
+	for step := 1; step <= len(s.Players); step++ {
+		uid := s.Players[(i+step)%len(s.Players)]
+		if !s.Eliminated[uid] {
+			return uid
+		}
+	}
+	return s.Turn
+}
+
+// quem ainda está na partida, na ordem dos turnos
+func (s *State) living() []string {
+	var living []string
+	for _, uid := range s.Players {
+		if !s.Eliminated[uid] {
+			living = append(living, uid)
+		}
+	}
+	return living
+}
+
+// verifica as condições de fim e, se for o caso, fecha a partida
+// a partida acaba quando sobra um time só (ou nenhum) com sanidade, ou
+// quando acabam as cartas de todos os que ainda estão nela
+func (s *State) checkEnd() bool {
+	living := s.living()
+
+	// quem ainda tem sanidade
+	standing := []string{}
+	for _, uid := range living {
+		if s.Sanity[uid] > 0 {
+			standing = append(standing, uid)
+		}
+	}
+
+	// verifica se acabaram as cartas de todos (mão e, se tem compra, pilha de compra)
+	exhausted := true
+	for _, uid := range living {
+		if len(s.Hand[uid]) > 0 || (s.Rules.DrawPerTurn > 0 && len(s.Library[uid]) > 0) {
+			exhausted = false
+		}
+	}
+
+	switch {
+	case len(standing) < len(living) && s.teamCount(standing) <= 1:
+		// alguém chegou a 0 e só sobrou um time: ganha ele (se ninguém sobrou, empate)
+		s.finish(s.teamOf(standing), SanityZero)
+	case exhausted:
+		// acabaram as cartas - maior sanidade vence (com o time dela)
+		s.finish(s.teamOf(s.highestSanity(living)), CardsExhausted)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// quantos times diferentes tem entre os jogadores
+func (s *State) teamCount(uids []string) int {
+	teams := make(map[int]bool)
+	for _, uid := range uids {
+		teams[s.Team(uid)] = true
+	}
+	return len(teams)
+}
+
+// o time inteiro dos jogadores, na ordem dos turnos (inclusive quem já saiu)
+// vazio se não tem ninguém ou se são de times diferentes (empate)
+func (s *State) teamOf(uids []string) []string {
+	winners := []string{}
+	if len(uids) == 0 || s.teamCount(uids) > 1 {
+		return winners
+	}
+	for _, uid := range s.Players {
+		if s.Allies(uid, uids[0]) {
+			winners = append(winners, uid)
+		}
+	}
+	return winners
+}
+
+// jogadores com a maior sanidade
+func (s *State) highestSanity(uids []string) []string {
+	best := -1
+	var leaders []string
+	for _, uid := range uids {
+		switch sanity := s.Sanity[uid]; {
+		case sanity > best:
+			best = sanity
+			leaders = []string{uid}
+		case sanity == best:
+			leaders = append(leaders, uid)
+		}
+	}
+	return leaders
+}
+
+// tira da partida quem chegou a 0 de sanidade (a partida continua; se ela
+// acabasse, o checkEnd já teria fechado)
+func (s *State) eliminate() []Event {
+	var events []Event
+	for _, uid := range s.living() {
+		if s.Sanity[uid] <= 0 {
+			s.Eliminated[uid] = true
+			events = append(events, Event{Type: PlayerEliminated, Round: s.Round, Player: uid, Reason: string(SanityZero)})
+		}
+	}
+	return events
+}
+
+// tira o jogador da partida por reason (sem cartas, desistência, queda...)
+// se só sobra um time, a partida acaba com a vitória dele; se não, ela
+// continua sem o jogador e, se era a vez dele, o turno passa
+func (s *State) knockOut(uid string, reason EndReason) []Event {
+	s.Eliminated[uid] = true
+
+	remaining := s.living()
+	if s.teamCount(remaining) <= 1 {
+		s.finish(s.teamOf(remaining), reason)
+		return []Event{{Type: GameEnded, Round: s.Round, Player: uid, Reason: string(reason)}}
+	}
+
+	events := []Event{{Type: PlayerEliminated, Round: s.Round, Player: uid, Reason: string(reason)}}
+	if s.Turn != uid {
+		return events
+	}
+	if s.Phase == PhaseMulligan {
+		// no mulligan ninguém jogou ainda: quem começa passa a ser o próximo
+		s.Turn = s.nextPlayer()
+		s.FirstPlayer = s.Turn
+		s.refillLucidity(s.Turn)
+		return events
+	}
+	return append(events, s.passTurn()...)
+}
+
+// desistência (ou queda, ou tempo estourado vezes demais)
+// a carta na pilha que envolve quem saiu não resolve mais: a janela de quem
+// ia reagir fecha e, se quem saiu era o alvo, o turno de quem jogou segue
+// como se a carta tivesse resolvido
+func (s *State) giveUp(uid string, reason EndReason) []Event {
+	var pending *StackEntry
+	if len(s.Stack) > 0 {
+		entry := s.Stack[len(s.Stack)-1]
+		if entry.Player == uid || entry.Target == uid {
+			pending = &entry
+			s.Stack = nil
+		}
+	}
+	round := s.Round
+
+	events := s.knockOut(uid, reason)
+	switch {
+	case s.Finished:
+		return events
+	case s.Phase == PhaseMulligan:
+		return append(events, s.endMulligan()...)
+	case pending == nil:
+		return events
+	}
+
+	closed := Event{Type: ReactionClosed, Round: round, Player: pending.Target, Reason: ReactionVoid}
+	events = append([]Event{closed}, events...)
+	if pending.Target == uid {
+		events = append(events, s.afterCard()...)
+	}
+	return events
+}
+
+func (s *State) finish(winners []string, reason EndReason) {
+	s.Finished = true
+	s.Result = &Result{Winners: winners, Reason: reason}
+}
+
+// o jogador venceu?
+func (s State) IsWinner(uid string) bool {
+	if s.Result == nil {
+		return false
+	}
+	for _, winner := range s.Result.Winners {
+		if winner == uid {
+			return true
+		}
+	}
+	return false
+}
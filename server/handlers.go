@@ -4,8 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net"
+	"path/filepath"
+	"slices"
 	"time"
+
+	"pbl-redes/replay"
 )
 
 func connectionHandler(connection net.Conn) {
@@ -32,6 +37,16 @@ func connectionHandler(connection net.Conn) {
 		if error := decoder.Decode(&request); error != nil {
 			// cliente desconectou - limpo os dados
 			if currentUser != nil {
+				// quem cai no meio da partida perde por desconexão
+				if match := mm.FindMatchByPlayerUID(currentUser.UID); match != nil {
+					select {
+					case match.inbox <- matchMsg{PlayerUID: currentUser.UID, Action: "disconnect"}:
+					case <-time.After(1 * time.Second):
+					}
+				}
+				mm.StopSpectating(currentUser.UID) // se estava assistindo
+				mm.LeaveQueue(currentUser.UID)     // se estava na fila
+				mm.CancelInvites(currentUser.UID)  // desafios e partida privada abertos
 				pm.Logout(currentUser)
 				fmt.Printf("Usuário %s deslogado automaticamente\n", currentUser.Username)
 			}
@@ -50,12 +65,42 @@ func connectionHandler(connection net.Conn) {
 			}
 		case buypack:
 			handleBuyBooster(request, encoder)
+		case getinv:
+			handleGetInventory(request, encoder)
 		case battle:
 			handleEnqueue(request, encoder)
 		case usecard:
 			handleUseCardAction(request, encoder)
 		case giveup:
 			handleGiveUpAction(request, encoder)
+		case mulligan:
+			handleMulliganAction(request, encoder)
+		case react:
+			handleReactAction(request, encoder)
+		case endturn:
+			handleEndTurnAction(request, encoder)
+		case getreplay:
+			handleGetReplay(request, encoder)
+		case spectate:
+			handleSpectate(request, encoder)
+		case leavespec:
+			handleLeaveSpectate(request, encoder)
+		case challenge:
+			handleChallenge(request, encoder)
+		case answerch:
+			handleAnswerChallenge(request, encoder)
+		case newlobby:
+			handleCreateLobby(request, encoder)
+		case joinlobby:
+			handleJoinLobby(request, encoder)
+		case endlobby:
+			handleCloseLobby(request, encoder)
+		case rematch:
+			handleRematchAction(request, encoder)
+		case leavequeue:
+			handleLeaveQueue(request, encoder)
+		case practice:
+			handlePractice(request, encoder)
 		default:
 			return
 		}
@@ -93,7 +138,7 @@ func handleRegister(request Message, encoder *json.Encoder, connection net.Conn)
 	_ = encoder.Encode(Message{Request: registered, Data: data})
 
 	// nova request contendo o novo UID para os boosters
-	for i := 0; i < 4; i++ {
+	for i := 0; i < starterBoosters; i++ {
 		boosterRequest := Message{
 			Request: buypack,
 			UID:     player.UID,
@@ -164,6 +209,7 @@ func handleLogin(request Message, encoder *json.Encoder, connection net.Conn) *U
 func handleBuyBooster(request Message, encoder *json.Encoder) {
 	var temp struct {
 		UID string `json:"UID"`
+		Set string `json:"set"` // opcional, vazio = qualquer coleção
 	}
 
 	if error := json.Unmarshal(request.Data, &temp); error != nil {
@@ -180,7 +226,7 @@ func handleBuyBooster(request Message, encoder *json.Encoder) {
 
 	var booster Booster
 
-	booster, error = vault.TakeBooster()
+	booster, error = vault.TakeBooster(temp.Set)
 
 	if error != nil {
 		sendError(encoder, error)
@@ -202,10 +248,38 @@ func handleBuyBooster(request Message, encoder *json.Encoder) {
 	_ = encoder.Encode(Message{Request: packbought, Data: data})
 }
 
+// lida com pedido de inventário, mandando as cartas e as coleções delas
+func handleGetInventory(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID string `json:"UID"`
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	deck, error := pm.GetDeck(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	type inventoryPayload struct {
+		Cards []*Card            `json:"cards"`
+		Sets  map[string]CardSet `json:"sets"`
+	}
+
+	data, _ := json.Marshal(inventoryPayload{Cards: deck, Sets: vault.GetSets()})
+	_ = encoder.Encode(Message{Request: inventory, Data: data})
+}
+
 // lida com pareamento
 func handleEnqueue(request Message, encoder *json.Encoder) {
 	var temp struct {
-		UID string `json:"UID"`
+		UID     string `json:"UID"`
+		Queue   string `json:"queue"`   // opcional, vazio = fila padrão
+		Ruleset string `json:"ruleset"` // opcional, vazio = ruleset padrão (ou o da fila)
 	}
 
 	if error := json.Unmarshal(request.Data, &temp); error != nil {
@@ -227,11 +301,87 @@ func handleEnqueue(request Message, encoder *json.Encoder) {
 			}
 		}*/ // info dump
 
-	if error := mm.Enqueue(p); error != nil {
+	queue, error := queues.Get(temp.Queue)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	// fila de um ruleset só: vale o dela
+	if queue.Ruleset != "" {
+		if temp.Ruleset != "" && temp.Ruleset != queue.Ruleset {
+			sendError(encoder, fmt.Errorf("a fila %s é só do ruleset %s", queue.Name, queue.Ruleset))
+			return
+		}
+		temp.Ruleset = queue.Ruleset
+	}
+
+	ruleset, error := rulesets.Get(temp.Ruleset)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	info, error := mm.Enqueue(p, queue, ruleset)
+	if error != nil {
 		sendError(encoder, error)
 		return
 	}
-	_ = encoder.Encode(Message{Request: enqueued, Data: nil})
+	data, _ := json.Marshal(info)
+	_ = encoder.Encode(Message{Request: enqueued, Data: data})
+}
+
+// treino contra bots do servidor (a resposta é o gameStart da partida)
+func handlePractice(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID     string `json:"UID"`
+		Ruleset string `json:"ruleset"` // opcional, vazio = ruleset padrão
+		Level   string `json:"level"`   // opcional, vazio = nível padrão
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	p, error := pm.GetByUID(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	ruleset, error := rulesets.Get(temp.Ruleset)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	level, error := parseAILevel(temp.Level)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	if error := mm.StartPractice(p, ruleset, level); error != nil {
+		sendError(encoder, error)
+	}
+}
+
+// sai da fila sem esperar a partida
+func handleLeaveQueue(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID string `json:"UID"`
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	info, error := mm.LeaveQueue(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	data, _ := json.Marshal(info)
+	_ = encoder.Encode(Message{Request: queueleft, Data: data})
 }
 
 // função notifica erro
@@ -348,6 +498,428 @@ func handleGiveUpAction(request Message, encoder *json.Encoder) {
 	}
 }
 
+// lida com a resposta à revanche, enviando pro inbox
+// a partida que acabou ainda está de pé enquanto a janela de revanche está aberta
+// (no meio da partida a resposta chega no inbox e é ignorada)
+func handleRematchAction(request Message, encoder *json.Encoder) {
+	player, err := pm.GetByUID(request.UID)
+	if err != nil {
+		sendError(encoder, err)
+		return
+	}
+
+	match := mm.FindMatchByPlayerUID(player.UID)
+	if match == nil {
+		sendError(encoder, errors.New("nenhuma revanche aberta"))
+		return
+	}
+
+	msg := matchMsg{
+		PlayerUID: request.UID,
+		Action:    "rematch",
+		Data:      request.Data,
+	}
+
+	select {
+	case match.inbox <- msg:
+	case <-time.After(1 * time.Second):
+		sendError(encoder, errors.New("timeout ao processar ação"))
+	}
+}
+
+// lida com o mulligan, enviando pro inbox
+func handleMulliganAction(request Message, encoder *json.Encoder) {
+	// verifica se o jogador existe e está ativo
+	player, err := pm.GetByUID(request.UID)
+	if err != nil {
+		sendError(encoder, err)
+		return
+	}
+
+	if !player.IsInBattle {
+		sendError(encoder, errors.New("jogador não está em partida"))
+		return
+	}
+
+	// encontra a partida do jogador
+	match := mm.FindMatchByPlayerUID(request.UID)
+	if match == nil {
+		sendError(encoder, errors.New("jogador não está em partida"))
+		return
+	}
+
+	// cria mensagem para o canal da partida
+	msg := matchMsg{
+		PlayerUID: request.UID,
+		Action:    "mulligan",
+		Data:      request.Data,
+	}
+
+	// envia para o canal da partida com timeout
+	select {
+	case match.inbox <- msg:
+	case <-time.After(1 * time.Second):
+		sendError(encoder, errors.New("timeout ao processar ação"))
+	}
+}
+
+// lida com a reação, enviando pro inbox
+func handleReactAction(request Message, encoder *json.Encoder) {
+	// verifica se o jogador existe e está ativo
+	player, err := pm.GetByUID(request.UID)
+	if err != nil {
+		sendError(encoder, err)
+		return
+	}
+
+	if !player.IsInBattle {
+		sendError(encoder, errors.New("jogador não está em partida"))
+		return
+	}
+
+	// encontra a partida do jogador
+	match := mm.FindMatchByPlayerUID(request.UID)
+	if match == nil {
+		sendError(encoder, errors.New("jogador não está em partida"))
+		return
+	}
+
+	// cria mensagem para o canal da partida
+	msg := matchMsg{
+		PlayerUID: request.UID,
+		Action:    "react",
+		Data:      request.Data,
+	}
+
+	// envia para o canal da partida com timeout
+	select {
+	case match.inbox <- msg:
+	case <-time.After(1 * time.Second):
+		sendError(encoder, errors.New("timeout ao processar ação"))
+	}
+}
+
+// lida com o fim de turno (rulesets com lucidez), enviando pro inbox
+func handleEndTurnAction(request Message, encoder *json.Encoder) {
+	// verifica se o jogador existe e está ativo
+	player, err := pm.GetByUID(request.UID)
+	if err != nil {
+		sendError(encoder, err)
+		return
+	}
+
+	if !player.IsInBattle {
+		sendError(encoder, errors.New("jogador não está em partida"))
+		return
+	}
+
+	// encontra a partida do jogador
+	match := mm.FindMatchByPlayerUID(request.UID)
+	if match == nil {
+		sendError(encoder, errors.New("jogador não está em partida"))
+		return
+	}
+
+	// cria mensagem para o canal da partida
+	msg := matchMsg{
+		PlayerUID: request.UID,
+		Action:    "endturn",
+		Data:      request.Data,
+	}
+
+	// envia para o canal da partida com timeout
+	select {
+	case match.inbox <- msg:
+	case <-time.After(1 * time.Second):
+		sendError(encoder, errors.New("timeout ao processar ação"))
+	}
+}
+
+// lida com os replays: sem id lista os últimos, com id manda o replay inteiro
+func handleGetReplay(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID    string `json:"UID"`
+		Replay string `json:"replay"` // opcional, vazio = lista
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	ids, error := pm.GetReplays(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	if temp.Replay == "" {
+		// mais recente primeiro
+		list := make([]ReplayInfo, 0, len(ids))
+		for _, id := range slices.Backward(ids) {
+			record, error := replay.Load(filepath.Join(replaysDir, id+".json"))
+			if error != nil {
+				fmt.Printf("Erro ao ler replay %s: %v\n", id, error)
+				continue
+			}
+			list = append(list, ReplayInfo{
+				ID:      record.ID,
+				Ruleset: record.Ruleset,
+				Players: record.Players,
+				Result:  record.Result,
+				Actions: len(record.Actions),
+				Started: record.Started,
+			})
+		}
+
+		data, _ := json.Marshal(list)
+		_ = encoder.Encode(Message{Request: replaylist, Data: data})
+		return
+	}
+
+	// só quem jogou a partida baixa o replay (e o id nunca vira caminho de outro arquivo)
+	if !slices.Contains(ids, temp.Replay) {
+		sendError(encoder, errors.New("replay não encontrado"))
+		return
+	}
+
+	record, error := replay.Load(filepath.Join(replaysDir, temp.Replay+".json"))
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	data, _ := json.Marshal(record)
+	_ = encoder.Encode(Message{Request: replayfile, Data: data})
+}
+
+// lida com quem quer assistir uma partida (pelo ID ou pelo nome de um jogador)
+func handleSpectate(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID      string `json:"UID"`
+		Match    int    `json:"match"`    // ID da partida (aparece no log)
+		Username string `json:"username"` // ou o nome de um dos jogadores
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	user, error := pm.GetByUID(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	match, error := mm.Spectate(user, temp.Match, temp.Username)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	type spectatingPayload struct {
+		Match   int      `json:"match"`
+		Players []string `json:"players"`
+		Delay   int      `json:"delay"` // segundos de atraso
+	}
+
+	players := make([]string, len(match.Players))
+	for i, p := range match.Players {
+		players[i] = p.Username
+	}
+	data, _ := json.Marshal(spectatingPayload{
+		Match:   match.ID,
+		Players: players,
+		Delay:   match.Ruleset.SpectatorDelay,
+	})
+	_ = encoder.Encode(Message{Request: spectating, Data: data})
+}
+
+// para de assistir
+func handleLeaveSpectate(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID string `json:"UID"`
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	if error := mm.StopSpectating(temp.UID); error != nil {
+		sendError(encoder, error)
+		return
+	}
+	_ = encoder.Encode(Message{Request: spectateleft})
+}
+
+// lida com o desafio direto: avisa o desafiado pela conexão dele
+func handleChallenge(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID      string `json:"UID"`
+		Username string `json:"username"` // quem é desafiado
+		Ruleset  string `json:"ruleset"`  // opcional, vazio = ruleset padrão
+		BestOf   int    `json:"bestOf"`   // opcional, 0 = partida avulsa
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	from, error := pm.GetByUID(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	to, error := pm.GetOnline(temp.Username)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	ruleset, error := rulesets.Get(temp.Ruleset)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	if error := validBestOf(temp.BestOf, ruleset); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	c, error := mm.Challenge(from, to, ruleset, temp.BestOf)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	payload := challengePayload(c)
+	data, _ := json.Marshal(payload)
+	_ = encoder.Encode(Message{Request: challengesent, Data: data})
+	notifyUser(to, challengerecv, payload)
+}
+
+// lida com a resposta do desafiado (aceitando, a partida começa e os dois recebem o gameStart)
+func handleAnswerChallenge(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID       string `json:"UID"`
+		Challenge int    `json:"challenge"`
+		Accept    bool   `json:"accept"`
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	user, error := pm.GetByUID(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	c, error := mm.AnswerChallenge(user, temp.Challenge, temp.Accept)
+	switch {
+	case c == nil:
+		sendError(encoder, error)
+	case error != nil:
+		// aceitou, mas alguém não estava mais livre: o desafio acaba
+		notifyChallengeClosed(c, error.Error())
+	case !temp.Accept:
+		notifyChallengeClosed(c, closedDeclined)
+	}
+}
+
+// abre uma partida privada e devolve o código
+func handleCreateLobby(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID     string `json:"UID"`
+		Ruleset string `json:"ruleset"` // opcional, vazio = ruleset padrão
+		BestOf  int    `json:"bestOf"`  // opcional, 0 = partida avulsa
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	host, error := pm.GetByUID(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	ruleset, error := rulesets.Get(temp.Ruleset)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+	if error := validBestOf(temp.BestOf, ruleset); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	lobby, error := mm.CreateLobby(host, ruleset, temp.BestOf)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	data, _ := json.Marshal(lobbyPayload(lobby, ""))
+	_ = encoder.Encode(Message{Request: lobbycreated, Data: data})
+}
+
+// entra numa partida privada pelo código (a partida começa quando ela enche;
+// num ruleset de dois, na hora)
+func handleJoinLobby(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID  string `json:"UID"`
+		Code string `json:"code"`
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	user, error := pm.GetByUID(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	if _, error := mm.JoinLobby(user, temp.Code); error != nil {
+		sendError(encoder, error)
+	}
+}
+
+// fecha a partida privada aberta (ou sai da que entrou e ainda espera gente)
+func handleCloseLobby(request Message, encoder *json.Encoder) {
+	var temp struct {
+		UID string `json:"UID"`
+	}
+
+	if error := json.Unmarshal(request.Data, &temp); error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	user, error := pm.GetByUID(temp.UID)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	info, error := mm.CloseLobby(user)
+	if error != nil {
+		sendError(encoder, error)
+		return
+	}
+
+	data, _ := json.Marshal(info)
+	_ = encoder.Encode(Message{Request: lobbyclosed, Data: data})
+}
+
 func logServerStats() {
 	// cria um ticker para logar as estatísticas a cada 10 segundos
 	ticker := time.NewTicker(2 * time.Second)
@@ -363,16 +935,27 @@ func logServerStats() {
 		// peega as informações do MatchManager
 		mm.mu.Lock()
 		activeMatches := len(mm.matches)
+		firstPlayer := make(map[string]FirstPlayerStats, len(mm.firstPlayer))
+		for name, stats := range mm.firstPlayer {
+			firstPlayer[name] = *stats
+		}
 		mm.mu.Unlock()
 
 		// pega as informações do CardVault
+		vault.mu.Lock()
 		boosterStock := len(vault.Vault)
+		vault.mu.Unlock()
 
 		fmt.Println("--- Estatísticas do Servidor ---")
 		fmt.Printf("Jogadores inscritos: %d\n", registeredPlayers)
 		fmt.Printf("Jogadores online: %d\n", onlinePlayers)
 		fmt.Printf("Estoque de boosters: %d\n", boosterStock)
 		fmt.Printf("Partidas ativas: %d\n", activeMatches)
+		for _, name := range slices.Sorted(maps.Keys(firstPlayer)) {
+			stats := firstPlayer[name]
+			fmt.Printf("Quem começa (%s): %d vitórias, %d derrotas, %d empates em %d partidas (%.0f%% de vitórias)\n",
+				name, stats.Wins, stats.Losses, stats.Ties, stats.Games, 100*float64(stats.Wins)/float64(stats.Games))
+		}
 		fmt.Println("--------------------------------")
 	}
 }
@@ -0,0 +1,321 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// desafios diretos e partidas privadas
+// os dois jeitos terminam no mesmo startMatch do pareamento, com o ruleset
+// escolhido por quem desafiou / abriu a partida
+// desafio é sempre de um contra um; a partida privada de um ruleset de mais
+// de dois espera até entrarem todos, e em duplas o host joga com o segundo
+// que entrar
+
+// tempo para o desafiado responder
+const challengeTimeout = 30 * time.Second
+
+// códigos das partidas privadas: sem 0/O e 1/I para não confundir ao ditar
+const (
+	lobbyCodeLength = 6
+	lobbyAlphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// motivos do challengeClosed, lobbyClosed, rematchClosed e seriesEnded
+const (
+	closedDeclined = "recusou"
+	closedGaveUp   = "desistiu"
+	closedExpired  = "expirou"
+	closedCanceled = "cancelado"
+	closedInMatch  = "em partida"
+	closedOffline  = "desconectou"
+)
+
+var (
+	ErrSelfChallenge     = errors.New("não dá para desafiar a si mesmo")
+	ErrChallengeNotFound = errors.New("desafio não encontrado")
+	ErrChallengeRepeated = errors.New("desafio já enviado para esse jogador")
+	ErrLobbyNotFound     = errors.New("partida privada não encontrada")
+	ErrOwnLobby          = errors.New("não dá para entrar na própria partida privada")
+	ErrOpponentBusy      = errors.New("oponente já está em jogo")
+	ErrChallengePlayers  = errors.New("desafio é só para rulesets de dois jogadores (use uma partida privada)")
+	ErrLobbyJoined       = errors.New("já está nessa partida privada")
+)
+
+// cria um desafio de from para to (bestOf > 0 = melhor de N); quem manda o
+// challengeReceived é o handler
+func (mm *MatchManager) Challenge(from, to *User, ruleset Ruleset, bestOf int) (*Challenge, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if from.UID == to.UID {
+		return nil, ErrSelfChallenge
+	}
+	if ruleset.PlayerCount() > 2 {
+		return nil, ErrChallengePlayers
+	}
+	if from.IsInBattle {
+		return nil, errors.New("player já está em jogo")
+	}
+	if to.IsInBattle {
+		return nil, ErrOpponentBusy
+	}
+	// o deck só cresce, então o que passa aqui continua valendo ao aceitar
+	for _, p := range []*User{from, to} {
+		if err := ruleset.checkDeck(p); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range mm.challenges {
+		if c.From.UID == from.UID && c.To.UID == to.UID {
+			return nil, ErrChallengeRepeated
+		}
+	}
+
+	mm.nextChallenge++
+	c := &Challenge{ID: mm.nextChallenge, From: from, To: to, Ruleset: ruleset, BestOf: bestOf}
+	c.timer = time.AfterFunc(challengeTimeout, func() { mm.expireChallenge(c.ID) })
+	mm.challenges[c.ID] = c
+
+	fmt.Printf("%s desafiou %s (ruleset %s)\n", from.Username, to.Username, ruleset.Name)
+	return c, nil
+}
+
+// responde o desafio id; aceitando, a partida começa na hora
+func (mm *MatchManager) AnswerChallenge(user *User, id int, accept bool) (*Challenge, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	c, ok := mm.challenges[id]
+	if !ok || c.To.UID != user.UID {
+		return nil, ErrChallengeNotFound
+	}
+	delete(mm.challenges, id)
+	c.timer.Stop()
+
+	if !accept {
+		return c, nil
+	}
+	if user.IsInBattle {
+		return c, errors.New("player já está em jogo")
+	}
+	if c.From.IsInBattle || c.From.Connection == nil {
+		return c, ErrOpponentBusy
+	}
+
+	players := []*User{c.From, c.To}
+	mm.startMatch(players, c.Ruleset, mm.newSeries(players, c.BestOf, false))
+	return c, nil
+}
+
+// o desafiado não respondeu a tempo
+func (mm *MatchManager) expireChallenge(id int) {
+	mm.mu.Lock()
+	c, ok := mm.challenges[id]
+	delete(mm.challenges, id)
+	mm.mu.Unlock()
+
+	if ok {
+		notifyChallengeClosed(c, closedExpired)
+	}
+}
+
+// abre uma partida privada (bestOf > 0 = melhor de N); quem já tinha uma
+// aberta troca pela nova
+func (mm *MatchManager) CreateLobby(host *User, ruleset Ruleset, bestOf int) (*Lobby, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if host.IsInBattle {
+		return nil, errors.New("player já está em jogo")
+	}
+	if err := ruleset.checkDeck(host); err != nil {
+		return nil, err
+	}
+	mm.leaveLobbies(host.UID, closedCanceled)
+
+	code := newLobbyCode()
+	for mm.lobbies[code] != nil {
+		code = newLobbyCode()
+	}
+	lobby := &Lobby{Code: code, Host: host, Ruleset: ruleset, BestOf: bestOf}
+	mm.lobbies[code] = lobby
+
+	fmt.Printf("%s abriu a partida privada %s (ruleset %s)\n", host.Username, code, ruleset.Name)
+	return lobby, nil
+}
+
+// entra na partida privada pelo código; com todos dentro, começa a partida
+// enquanto falta gente, quem está nela recebe o lobbyJoined
+func (mm *MatchManager) JoinLobby(user *User, code string) (*Lobby, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	lobby, ok := mm.lobbies[code]
+	if !ok {
+		return nil, ErrLobbyNotFound
+	}
+	if lobby.Host.UID == user.UID {
+		return nil, ErrOwnLobby
+	}
+	if user.IsInBattle {
+		return nil, errors.New("player já está em jogo")
+	}
+	if lobby.Host.IsInBattle || lobby.Host.Connection == nil {
+		delete(mm.lobbies, code)
+		return nil, ErrLobbyNotFound
+	}
+	if slices.Contains(lobby.Guests, user) {
+		return nil, ErrLobbyJoined
+	}
+	if err := lobby.Ruleset.checkDeck(user); err != nil {
+		return nil, err
+	}
+
+	// quem entra numa partida privada sai das outras (e fecha a própria)
+	mm.leaveLobbies(user.UID, closedCanceled)
+	// quem caiu ou entrou em outra partida enquanto esperava não conta mais
+	lobby.Guests = slices.DeleteFunc(lobby.Guests, func(g *User) bool { return g.Connection == nil || g.IsInBattle })
+	lobby.Guests = append(lobby.Guests, user)
+
+	players := append([]*User{lobby.Host}, lobby.Guests...)
+	if len(players) < lobby.Ruleset.PlayerCount() {
+		notifyLobby(lobby, lobbyjoined, "")
+		fmt.Printf("%s entrou na partida privada %s (%d de %d)\n", user.Username, code, len(players), lobby.Ruleset.PlayerCount())
+		return lobby, nil
+	}
+
+	delete(mm.lobbies, code)
+	mm.startMatch(players, lobby.Ruleset, mm.newSeries(players, lobby.BestOf, false))
+	return lobby, nil
+}
+
+// fecha a partida privada aberta por user (ou sai da que ele entrou e
+// ainda espera gente); devolve o lobbyClosed para quem pediu
+func (mm *MatchManager) CloseLobby(user *User) (LobbyInfo, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	for _, lobby := range mm.lobbies {
+		if lobby.Host == user || slices.Contains(lobby.Guests, user) {
+			mm.leaveLobbies(user.UID, closedCanceled)
+			return lobbyPayload(lobby, closedCanceled), nil
+		}
+	}
+	return LobbyInfo{}, ErrLobbyNotFound
+}
+
+// tira o jogador das partidas privadas (com mm.mu travado): a que ele abriu
+// fecha, avisando quem já tinha entrado; das outras ele só sai, e quem
+// ficou recebe o lobbyJoined com a lista nova
+func (mm *MatchManager) leaveLobbies(uid, reason string) {
+	for code, lobby := range mm.lobbies {
+		if lobby.Host.UID == uid {
+			delete(mm.lobbies, code)
+			for _, guest := range lobby.Guests {
+				go notifyUser(guest, lobbyclosed, lobbyPayload(lobby, reason))
+			}
+			continue
+		}
+		before := len(lobby.Guests)
+		lobby.Guests = slices.DeleteFunc(lobby.Guests, func(g *User) bool { return g.UID == uid })
+		if len(lobby.Guests) < before {
+			notifyLobby(lobby, lobbyjoined, "")
+		}
+	}
+}
+
+// avisa todos que estão na partida privada (com mm.mu travado)
+func notifyLobby(lobby *Lobby, request, reason string) {
+	payload := lobbyPayload(lobby, reason)
+	for _, user := range append([]*User{lobby.Host}, lobby.Guests...) {
+		go notifyUser(user, request, payload)
+	}
+}
+
+// cancela tudo que o jogador tinha aberto (ele caiu)
+func (mm *MatchManager) CancelInvites(uid string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.dropInvites(uid, closedOffline)
+}
+
+// desfaz os desafios e as partidas privadas do jogador (com mm.mu travado)
+// só quem estava do outro lado é avisado: o próprio jogador caiu ou está
+// entrando numa partida
+func (mm *MatchManager) dropInvites(uid, reason string) {
+	for id, c := range mm.challenges {
+		if c.From.UID != uid && c.To.UID != uid {
+			continue
+		}
+		delete(mm.challenges, id)
+		c.timer.Stop()
+
+		other := c.From
+		if other.UID == uid {
+			other = c.To
+		}
+		payload := challengePayload(c)
+		payload.Reason = reason
+		go notifyUser(other, challengeclose, payload)
+	}
+	mm.leaveLobbies(uid, reason)
+}
+
+// avisa os dois lados que o desafio acabou sem partida
+func notifyChallengeClosed(c *Challenge, reason string) {
+	payload := challengePayload(c)
+	payload.Reason = reason
+	notifyUser(c.From, challengeclose, payload)
+	notifyUser(c.To, challengeclose, payload)
+}
+
+// manda uma mensagem pela conexão do usuário, se ele ainda estiver conectado
+func notifyUser(user *User, request string, payload any) {
+	connection := user.Connection
+	if connection == nil {
+		return
+	}
+	data, _ := json.Marshal(payload)
+	_ = json.NewEncoder(connection).Encode(Message{Request: request, Data: data})
+}
+
+func challengePayload(c *Challenge) ChallengeInfo {
+	return ChallengeInfo{
+		ID:      c.ID,
+		From:    c.From.Username,
+		To:      c.To.Username,
+		Ruleset: c.Ruleset.Name,
+		BestOf:  c.BestOf,
+		Timeout: int(challengeTimeout / time.Second),
+	}
+}
+
+func lobbyPayload(lobby *Lobby, reason string) LobbyInfo {
+	info := LobbyInfo{Code: lobby.Code, Host: lobby.Host.Username, Ruleset: lobby.Ruleset.Name, BestOf: lobby.BestOf, Reason: reason}
+	if lobby.Ruleset.PlayerCount() > 2 {
+		info.Players = []string{lobby.Host.Username}
+		for _, guest := range lobby.Guests {
+			info.Players = append(info.Players, guest.Username)
+		}
+		info.Needed = lobby.Ruleset.PlayerCount() - len(info.Players)
+	}
+	return info
+}
+
+// código aleatório de verdade (não sai da seed mestre: quem sabe a seed
+// não pode adivinhar o código de uma partida privada)
+func newLobbyCode() string {
+	code := make([]byte, lobbyCodeLength)
+	crand.Read(code)
+	for i := range code {
+		code[i] = lobbyAlphabet[int(code[i])%len(lobbyAlphabet)]
+	}
+	return string(code)
+}
@@ -5,50 +5,54 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
+
+	"pbl-redes/engine"
+	"pbl-redes/replay"
 )
 
 // newMatchanager
-func NewMatchManager() *MatchManager {
+// a seed gera as seeds de cada partida
+func NewMatchManager(seed int64) *MatchManager {
 	return &MatchManager{
 		mu:       sync.Mutex{},
-		queue:    []*User{},
+		lines:    make(map[string]*waitLine),
+		waits:    make(map[string]time.Duration),
+		wake:     make(chan struct{}, 1),
 		nextID:   1,
 		matches:  make(map[int]*Match),
 		byPlayer: make(map[string]*Match),
+		watching: make(map[string]*Match),
+		seeds:    rand.New(rand.NewSource(seed)),
+
+		firstPlayer: make(map[string]*FirstPlayerStats),
+		challenges:  make(map[int]*Challenge),
+		lobbies:     make(map[string]*Lobby),
 	}
 }
 
-// coloca usuário na fila
-func (mm *MatchManager) Enqueue(p *User) error {
+// guarda o resultado de quem começou a partida
+func (mm *MatchManager) recordFirstPlayer(ruleset string, game engine.State) {
 	mm.mu.Lock()
 	defer mm.mu.Unlock()
 
-	// verifica se já está em jogo
-	if p.IsInBattle {
-		return errors.New("player já está em jogo")
-	}
-
-	// evita-se duplicata na fila
-	for _, q := range mm.queue {
-		if q.UID == p.UID {
-			return errors.New("player já está na fila")
-		}
+	stats, exists := mm.firstPlayer[ruleset]
+	if !exists {
+		stats = &FirstPlayerStats{}
+		mm.firstPlayer[ruleset] = stats
 	}
 
-	mm.queue = append(mm.queue, p)
-	return nil
-}
-
-// tira usuário da fila
-func (mm *MatchManager) dequeue() (*User, error) {
-	if len(mm.queue) == 0 {
-		return nil, errors.New("fila vazia")
+	stats.Games++
+	switch {
+	case len(game.Result.Winners) == 0:
+		stats.Ties++
+	case game.IsWinner(game.FirstPlayer):
+		stats.Wins++
+	default:
+		stats.Losses++
 	}
-	p := mm.queue[0]
-	mm.queue = mm.queue[1:]
-	return p, nil
 }
 
 // busca partida por UID
@@ -58,268 +62,390 @@ func (mm *MatchManager) FindMatchByPlayerUID(uid string) *Match {
 	return mm.byPlayer[uid]
 }
 
-// loop de pareamento
-func (mm *MatchManager) matchmakingLoop() {
-	for {
-		time.Sleep(50 * time.Millisecond)
-		mm.mu.Lock()
-		if len(mm.queue) >= 2 {
-			p1, _ := mm.dequeue()
-			p2, _ := mm.dequeue()
-
-			// valido as conexões
-			if p1.Connection == nil || p2.Connection == nil {
-				// se a conexão for inválida, coloco de novo na fila
-				if p1.Connection != nil {
-					mm.queue = append([]*User{p1}, mm.queue...)
-				}
-				if p2.Connection != nil {
-					mm.queue = append([]*User{p2}, mm.queue...)
-				}
-				mm.mu.Unlock()
-				continue
-			}
-
-			mm.nextID++
-			match := &Match{
-				ID:    mm.nextID,
-				P1:    p1,
-				P2:    p2,
-				State: Running,
-				Turn:  p1.UID, // p1 começa
-
-				Hand:             map[string][]*Card{},
-				Sanity:           map[string]int{p1.UID: 40, p2.UID: 40},
-				DreamStates:      map[string]DreamState{p1.UID: sleepy, p2.UID: sleepy},
-				RoundsInState:    map[string]int{p1.UID: 0, p2.UID: 0},
-				StateLockedUntil: map[string]int{p1.UID: 0, p2.UID: 0},
-				currentRound:     1,
-				inbox:            make(chan matchMsg, 16),
-			}
-			p1.IsInBattle, p2.IsInBattle = true, true
-			mm.matches[match.ID] = match
-			mm.byPlayer[p1.UID] = match
-			mm.byPlayer[p2.UID] = match
-
-			go match.run()
+// cria a partida e começa a goroutine dela (chamado com mm.mu travado)
+// series é a série que a partida continua (nil = partida avulsa, série nova)
+// em duplas, os times saem da ordem dos jogadores: 1º e 3º contra 2º e 4º
+func (mm *MatchManager) startMatch(players []*User, ruleset Ruleset, series *Series) *Match {
+	mm.nextID++
+	seed := mm.seeds.Int63()
+	match := &Match{
+		ID:      mm.nextID,
+		Players: players,
+		State:   Running,
+		Seed:    seed,
+		Ruleset: ruleset,
+		inbox:   make(chan matchMsg, 16),
+
+		spectators: make(map[string]*spectator),
+		feedWake:   make(chan struct{}, 1),
+	}
+	if ruleset.Teams {
+		match.Teams = make(map[string]int, len(players))
+		for i, p := range players {
+			match.Teams[p.UID] = i % 2
 		}
-		mm.mu.Unlock()
 	}
+	if series == nil {
+		series = mm.newSeries(players, 0, false)
+	}
+	match.series = series
+	if series.Games > 0 {
+		// o placar continua e quem começa é o seguinte de quem começou a anterior
+		match.first = series.nextFirst(players)
+	}
+	// quem estava assistindo outra partida para de assistir para jogar;
+	// e sai das filas e dos desafios/partidas privadas que tinha abertos
+	for _, p := range players {
+		p.IsInBattle = true
+		mm.stopWatching(p.UID)
+		mm.leaveQueues(p.UID)
+		mm.dropInvites(p.UID, closedInMatch)
+		mm.byPlayer[p.UID] = match
+	}
+	mm.matches[match.ID] = match
+
+	// seed no log para conseguir reproduzir uma partida reportada
+	fmt.Printf("Partida %d criada (%s, ruleset %s) com seed %d\n", match.ID, match.names(), ruleset.Name, seed)
+
+	go match.run()
+	go match.runFeed()
+	return match
 }
 
 // gerencia a batalha
+// as regras ficam no pacote engine; aqui só entram mensagens dos jogadores
+// (viram engine.Action) e saem mensagens para eles (a partir dos engine.Event)
 func (m *Match) run() {
+	next := false // próxima partida da série (revanche ou melhor de N)
 	defer func() {
-		// cleanup quando a partida termina
+		// cleanup quando a partida termina; a próxima partida da série começa
+		// no mesmo lock, sem brecha para alguém parear os dois com outro
 		mm.mu.Lock()
 		delete(mm.matches, m.ID)
-		delete(mm.byPlayer, m.P1.UID)
-		delete(mm.byPlayer, m.P2.UID)
+		for _, p := range m.Players {
+			delete(mm.byPlayer, p.UID)
+			p.IsInBattle = false
+		}
+		if next {
+			mm.startNextGame(m)
+		}
 		mm.mu.Unlock()
 
-		m.P1.IsInBattle = false
-		m.P2.IsInBattle = false
-		close(m.inbox)
-	}()
-
-	// cria codificadores para cada usuário
-	enc1 := json.NewEncoder(m.P1.Connection)
-	enc2 := json.NewEncoder(m.P2.Connection)
+		// fora do mm ninguém mais entra assistindo; o feed entrega o que falta e acaba
+		m.closeFeed()
 
-	// são escolhidas 10 cartas aleatórias do inventário de cada jogador
-	m.Hand[m.P1.UID] = drawCards(m.P1.Deck)
-	m.Hand[m.P2.UID] = drawCards(m.P2.Deck)
+		// o inbox não é fechado: um handler que achou a partida antes da
+		// limpeza ainda pode mandar (ex: a desconexão logo depois do fim)
+	}()
 
-	m.sendGameStart(enc1, enc2)
+	// cria codificadores para cada usuário (o bot recebe direto, sem conexão)
+	m.encoders = make(map[string]*json.Encoder, len(m.Players))
+	for _, p := range m.Players {
+		if p.IsBot {
+			m.encoders[p.UID] = json.NewEncoder(newAISeat(m, p))
+			continue
+		}
+		m.encoders[p.UID] = json.NewEncoder(p.Connection)
+	}
+
+	// a engine embaralha o inventário de cada jogador com a seed da partida
+	// e distribui handSize cartas; o resto vira a pilha de compra
+	uids := make([]string, len(m.Players))
+	decks := make(map[string][]Card, len(m.Players))
+	m.stats = make(map[string]*PlayerSummary, len(m.Players))
+	for i, p := range m.Players {
+		uids[i] = p.UID
+		decks[p.UID] = deckCards(p.Deck, m.Ruleset.Reactions)
+		m.stats[p.UID] = &PlayerSummary{Username: p.Username, CardsPlayed: []Card{}}
+	}
+	// sem first, cara ou coroa decide quem começa
+	game := engine.Start(engine.Setup{Rules: m.Ruleset.Rules, Seed: m.Seed, Players: uids, Decks: decks, First: m.first, Teams: m.Teams})
+	m.mu.Lock()
+	m.game = game
+	m.mu.Unlock()
+	m.timeouts = make(map[string]int)
+
+	// replay: com a seed e os decks a engine refaz a partida a partir das ações
+	started := time.Now()
+	m.record = replay.Replay{
+		ID:      fmt.Sprintf("%s-%d", started.Format("20060102-150405"), m.ID),
+		Match:   m.ID,
+		Ruleset: m.Ruleset.Name,
+		Rules:   m.Ruleset.Rules,
+		Seed:    m.Seed,
+		First:   m.first,
+		Players: make([]replay.Player, len(m.Players)),
+		Teams:   m.Teams,
+		Decks:   decks,
+		Hands:   m.game.Hand, // o Apply sempre trabalha numa cópia, então este mapa não muda mais
+		Actions: []engine.Action{},
+		Started: started,
+	}
+	for i, p := range m.Players {
+		m.record.Players[i] = replay.Player{UID: p.UID, Username: p.Username, Bot: p.IsBot}
+	}
+
+	m.sendGameStart()
+	if m.first != "" {
+		m.notifyAll(fmt.Sprintf("Partida %d da série: %s começa", m.series.Games+1, m.username(m.game.FirstPlayer)))
+	} else if len(m.Players) > 2 {
+		m.notifyAll(fmt.Sprintf("Sorteio: %s começa", m.username(m.game.FirstPlayer)))
+	} else {
+		m.notifyAll(fmt.Sprintf("Cara ou coroa: %s começa", m.username(m.game.FirstPlayer)))
+	}
 
 	// pequena pausa para garantir que os clientes processaram o game start
 	time.Sleep(1 * time.Second)
 
-	// loop do jogo
-	for m.State == Running {
-		fmt.Printf("=== TURNO %d - Jogador %s ===\n", m.currentRound, m.Turn)
+	// fase de mulligan, antes da rodada 1
+	if m.game.Phase == engine.PhaseMulligan {
+		m.runMulligan()
+	}
 
-		// verifica condições de fim ANTES do turno
-		if m.checkGameEnd() {
-			//fmt.Printf("DEBUG: Jogo deve terminar - sanidades: P1=%d P2=%d\n", m.Sanity[m.P1.UID], m.Sanity[m.P2.UID])
-			break
-		}
+	// loop do jogo
+	for !m.game.Finished {
+		fmt.Printf("=== TURNO %d - Jogador %s ===\n", m.game.Round, m.game.Turn)
 
-		// envia informação de turno para AMBOS os jogadores
-		m.notifyTurnStart(enc1, enc2, m.Turn)
+		// envia informação de turno para TODOS os jogadores
+		m.notifyTurnStart(m.game.Turn)
 
 		// pequena pausa para sincronização
 		time.Sleep(500 * time.Millisecond)
 
-		// processa o turno
-		actionTaken := m.processTurn(enc1, enc2)
-
-		if !actionTaken {
-			fmt.Printf("DEBUG: Nenhuma ação foi tomada no turno\n")
-		}
-
-		// atualiza estados e sanidade
-		m.updateGameState(enc1, enc2)
+		// processa o turno (a engine já aplica os estados e troca o turno)
+		m.processTurn()
 
-		// verifica condições de fim APÓS as atualizações
-		if m.checkGameEnd() {
+		if m.game.Finished {
 			fmt.Printf("DEBUG: Jogo terminando após atualizações\n")
 			break
 		}
 
-		// troca de turno
-		m.switchTurn()
-		m.currentRound++
-
 		// pequena pausa entre turnos
 		time.Sleep(1 * time.Second)
 	}
 
-	m.endGame(enc1, enc2)
+	m.endGame()
+	if m.series.BestOf > 0 {
+		next = m.runSeriesBreak()
+	} else {
+		next = m.runRematch()
+	}
 }
 
-// pega 10 cartas
-func drawCards(deck []*Card) []*Card {
-	if len(deck) == 0 {
-		return []*Card{}
+// copia o inventário do jogador para a engine; num ruleset sem reações as
+// cartas de reação ficam de fora (não teriam como ser jogadas e só
+// ocupariam a mão)
+func deckCards(deck []*Card, reactions bool) []Card {
+	cards := make([]Card, 0, len(deck))
+	for _, card := range deck {
+		if card.CardType == Reaction && !reactions {
+			continue
+		}
+		cards = append(cards, *card)
 	}
+	return cards
+}
 
-	hand := make([]*Card, len(deck))
-	copy(hand, deck)
-	random := rand.New(rand.NewSource(time.Now().UnixNano()))
-	random.Shuffle(len(hand), func(i, j int) { hand[i], hand[j] = hand[j], hand[i] })
-	if len(hand) > 10 {
-		hand = hand[:10]
+// manda response de início do game
+func (m *Match) sendGameStart() {
+	for _, p := range m.Players {
+		_ = m.encoders[p.UID].Encode(Message{Request: gamestart, Data: m.gameStartFor(p.UID)})
 	}
-	return hand
+
+	//fmt.Printf("DEBUG: Game start enviado para todos os jogadores\n")
 }
 
-// manda response de início do game
-func (m *Match) sendGameStart(enc1, enc2 *json.Encoder) {
+// gameStart de um jogador; com uid vazio é o de um espectador: as mãos
+// escondidas e, no lugar delas, os tamanhos das mãos e a rodada
+func (m *Match) gameStartFor(uid string) json.RawMessage {
 	type startPayload struct {
-		Info        string                `json:"info"`
-		Turn        string                `json:"turn"`
-		Hand        []*Card               `json:"hand"`
-		Sanity      map[string]int        `json:"sanity"`
-		DreamStates map[string]DreamState `json:"dreamStates"`
+		Info         string                       `json:"info"`
+		Ruleset      Ruleset                      `json:"ruleset"`
+		Turn         string                       `json:"turn"`
+		FirstPlayer  string                       `json:"firstPlayer"`     // ganhou o cara ou coroa
+		Order        []string                     `json:"order"`           // UIDs na ordem dos turnos
+		Players      map[string]string            `json:"players"`         // nome de cada UID
+		Teams        map[string]int               `json:"teams,omitempty"` // só em duplas
+		Bots         []string                     `json:"bots,omitempty"`  // UIDs dos bots do servidor
+		Hand         []Card                       `json:"hand"`
+		LibrarySizes map[string]int               `json:"librarySizes"`
+		Sanity       map[string]int               `json:"sanity"`
+		DreamStates  map[string]engine.DreamState `json:"dreamStates"`
+		Lucidity     map[string]int               `json:"lucidity,omitempty"` // só nos rulesets com lucidez
+		MaxLucidity  map[string]int               `json:"maxLucidity,omitempty"`
+		HandSizes    map[string]int               `json:"handSizes,omitempty"` // só para espectadores
+		Round        int                          `json:"round,omitempty"`
+		Series       *Series                      `json:"series"` // placar antes desta partida
+	}
+
+	payload := startPayload{
+		Ruleset:      m.Ruleset,
+		Turn:         m.game.Turn,
+		FirstPlayer:  m.game.FirstPlayer,
+		Order:        m.game.Players,
+		Players:      make(map[string]string, len(m.Players)),
+		Teams:        m.Teams,
+		Bots:         m.botUIDs(),
+		Hand:         m.game.Hand[uid],
+		LibrarySizes: pileSizes(m.game.Library),
+		Sanity:       m.game.Sanity,
+		DreamStates:  m.game.DreamStates,
+		Series:       m.series,
+	}
+
+	// info: os oponentes de quem joga, ou todo mundo para quem assiste
+	var names []string
+	for _, p := range m.Players {
+		payload.Players[p.UID] = p.Username
+		if uid == "" || !m.game.Allies(uid, p.UID) {
+			names = append(names, p.Username)
+		}
 	}
-
-	// Payload para P1
-	p1Payload := startPayload{
-		Info:        m.P2.Username,
-		Turn:        m.Turn,
-		Hand:        m.Hand[m.P1.UID],
-		Sanity:      m.Sanity,
-		DreamStates: m.DreamStates,
+	payload.Info = strings.Join(names, " x ")
+	if uid == "" {
+		payload.HandSizes = pileSizes(m.game.Hand)
+		payload.Round = m.game.Round
 	}
 
-	// Payload para P2
-	p2Payload := startPayload{
-		Info:        m.P1.Username,
-		Turn:        m.Turn,
-		Hand:        m.Hand[m.P2.UID],
-		Sanity:      m.Sanity,
-		DreamStates: m.DreamStates,
+	if m.game.Rules.Lucidity != nil {
+		payload.Lucidity, payload.MaxLucidity = m.game.Lucidity, m.game.MaxLucidity
 	}
 
-	msg1 := Message{Request: gamestart}
-	msg2 := Message{Request: gamestart}
+	data, _ := json.Marshal(payload)
+	return data
+}
 
-	data1, _ := json.Marshal(p1Payload)
-	data2, _ := json.Marshal(p2Payload)
-	msg1.Data = data1
-	msg2.Data = data2
+func (m *Match) endGame() {
+	//fmt.Printf("DEBUG: Finalizando jogo - sanidades: %v\n", m.game.Sanity)
 
-	_ = enc1.Encode(msg1)
-	_ = enc2.Encode(msg2)
+	m.State = Finished
+	if !m.hasBots() {
+		mm.recordFirstPlayer(m.Ruleset.Name, m.game)
+	}
 
-	//fmt.Printf("DEBUG: Game start enviado para ambos jogadores\n")
-}
+	changes := m.scoreGame()
 
-func (m *Match) checkGameEnd() bool {
-	// verifica se alguém chegou a 0 de sanidade
-	for _, sanity := range m.Sanity {
-		if sanity <= 0 {
-			return true
-		}
+	// grava o replay; se falhar a partida só fica sem replay
+	m.record.Result = m.game.Result
+	m.record.Ended = time.Now()
+	if filename, error := m.record.Save(replaysDir); error != nil {
+		fmt.Printf("Erro ao gravar replay da partida %d: %v\n", m.ID, error)
+		m.record.ID = ""
+	} else {
+		pm.AddReplay(m.record.ID, m.humans()...)
+		fmt.Printf("Replay da partida %d gravado em %s\n", m.ID, filename)
 	}
 
-	// Verificar se acabaram as cartas para ambos
-	if len(m.Hand[m.P1.UID]) == 0 && len(m.Hand[m.P2.UID]) == 0 {
-		return true
+	// todos recebem o mesmo resumo; o resultado já vem decidido pela engine
+	data, _ := json.Marshal(m.summary(changes))
+	for _, p := range m.Players {
+		_ = m.encoders[p.UID].Encode(Message{Request: resultFor(m.game, p.UID), Data: data})
 	}
+	m.toSpectators(Message{Request: matchended, Data: data})
 
-	return false
+	var results []string
+	for _, p := range m.Players {
+		results = append(results, fmt.Sprintf("%s %+d", p.Username, changes[p.UID]))
+	}
+	fmt.Printf("Partida %d terminou (%s): %s\n", m.ID, m.game.Result.Reason, strings.Join(results, ", "))
+	//fmt.Printf("DEBUG: Mensagens de fim enviadas para %d jogadores\n", len(m.Players))
 }
 
-func (m *Match) endGame(enc1, enc2 *json.Encoder) {
-	//fmt.Printf("DEBUG: Finalizando jogo - P1: %d sanidade, P2: %d sanidade\n",
-	//	m.Sanity[m.P1.UID], m.Sanity[m.P2.UID])
-
-	m.State = Finished
+// monta o resumo do fim da partida
+func (m *Match) summary(changes map[string]int) MatchSummary {
+	for _, player := range m.Players {
+		stats := m.stats[player.UID]
+		stats.Sanity = m.game.Sanity[player.UID]
+		stats.DreamState = m.game.DreamStates[player.UID]
+		stats.Rating = player.Rating
+		stats.RatingChange = changes[player.UID]
+		stats.Bot = player.IsBot
+	}
+
+	return MatchSummary{
+		Reason:  m.game.Result.Reason,
+		Winners: m.game.Result.Winners,
+		Rounds:  m.game.Round,
+		Ruleset: m.Ruleset.Name,
+		Replay:  m.record.ID,
+		Series:  m.series,
+		Players: m.stats,
+	}
+}
 
-	// determina o resultado
-	var response1, response2 string
-	p1Sanity := m.Sanity[m.P1.UID]
-	p2Sanity := m.Sanity[m.P2.UID]
-
-	if p1Sanity <= 0 && p2Sanity <= 0 {
-		response1 = newtie
-		response2 = newtie
-	} else if p1Sanity <= 0 {
-		response1 = newloss
-		response2 = newvictory
-	} else if p2Sanity <= 0 {
-		response1 = newvictory
-		response2 = newloss
-	} else {
-		// acabaram as cartas - maior sanidade vence
-		if p1Sanity > p2Sanity {
-			response1 = newvictory
-			response2 = newloss
-		} else if p2Sanity > p1Sanity {
-			response1 = newloss
-			response2 = newvictory
-		} else {
-			response1 = newtie
-			response2 = newtie
+// soma o evento nos números do resumo; used é a carta que está resolvendo
+func (m *Match) track(event engine.Event, used *CardUsed) {
+	switch event.Type {
+	case engine.CardPlayed, engine.ReactionPlayed:
+		stats := m.stats[event.Player]
+		stats.CardsPlayed = append(stats.CardsPlayed, *event.Card)
+	case engine.SanityChanged:
+		if event.Amount > 0 {
+			m.stats[event.Target].Healed += event.Amount
+			return
+		}
+		m.stats[event.Target].DamageTaken -= event.Amount
+		if used != nil && used.Player != event.Target {
+			m.stats[used.Player].DamageDealt -= event.Amount
 		}
+	case engine.DamageReflected:
+		// o dano devolvido conta para quem reagiu
+		m.stats[event.Player].DamageDealt += event.Amount
 	}
+}
 
-	type gameEndPayload struct {
-		Tag string `json:"Tag"`
+// traduz o resultado da engine para a mensagem de fim do jogador
+func resultFor(game engine.State, uid string) string {
+	switch {
+	case len(game.Result.Winners) == 0:
+		return newtie
+	case game.IsWinner(uid):
+		return newvictory
+	default:
+		return newloss
 	}
+}
 
-	payload := gameEndPayload{Tag: "none"}
-	data, _ := json.Marshal(payload)
-
-	msg1 := Message{Request: response1, Data: data}
-	msg2 := Message{Request: response2, Data: data}
+func (m *Match) getCurrentPlayer() *User {
+	return m.player(m.game.Turn)
+}
 
-	_ = enc1.Encode(msg1)
-	_ = enc2.Encode(msg2)
+// jogador da partida pelo UID
+func (m *Match) player(uid string) *User {
+	for _, p := range m.Players {
+		if p.UID == uid {
+			return p
+		}
+	}
+	return nil
+}
 
-	//fmt.Printf("DEBUG: Mensagens de fim enviadas: %s para P1, %s para P2\n", response1, response2)
+// nome de um jogador da partida
+func (m *Match) username(uid string) string {
+	if p := m.player(uid); p != nil {
+		return p.Username
+	}
+	return uid
 }
 
-func (m *Match) getCurrentPlayer() *User {
-	if m.Turn == m.P1.UID {
-		return m.P1
+// nomes de todos, para o log
+func (m *Match) names() string {
+	names := make([]string, len(m.Players))
+	for i, p := range m.Players {
+		names[i] = p.Username
 	}
-	return m.P2
+	return strings.Join(names, " x ")
 }
 
-func (m *Match) switchTurn() {
-	if m.Turn == m.P1.UID {
-		m.Turn = m.P2.UID
-	} else {
-		m.Turn = m.P1.UID
+// manda a mesma mensagem para todos os jogadores (espectadores à parte)
+func (m *Match) toPlayers(msg Message) {
+	for _, p := range m.Players {
+		_ = m.encoders[p.UID].Encode(msg)
 	}
-	//fmt.Printf("DEBUG: Turno trocado para jogador %s\n", m.Turn)
 }
 
 // notifica início do turno pros jogadores
-func (m *Match) notifyTurnStart(enc1, enc2 *json.Encoder, currentPlayerUID string) {
+func (m *Match) notifyTurnStart(currentPlayerUID string) {
 	type turnPayload struct {
 		Turn string `json:"turn"`
 	}
@@ -332,34 +458,48 @@ func (m *Match) notifyTurnStart(enc1, enc2 *json.Encoder, currentPlayerUID strin
 		Data:    data,
 	}
 
-	_ = enc1.Encode(msg)
-	_ = enc2.Encode(msg)
+	m.toPlayers(msg)
+	m.toSpectators(msg)
 
 	//fmt.Printf("DEBUG: Notificação de turno enviada - turno de: %s\n", currentPlayerUID)
 	time.Sleep(100 * time.Millisecond) // espera um pouco para garantir que a mensagem chegou ao cliente
 }
 
-// processa o turno e retorna se uma ação foi tomada
-func (m *Match) processTurn(enc1, enc2 *json.Encoder) bool {
+// processa o turno: espera a ação do jogador da vez e aplica na engine
+func (m *Match) processTurn() {
 	currentPlayer := m.getCurrentPlayer()
 
 	// verifica se o jogador está paralisado
-	if m.DreamStates[currentPlayer.UID] == paralyzed {
-		m.notifyBoth(enc1, enc2, fmt.Sprintf("%s está paralisado e perde o turno", currentPlayer.Username))
-		time.Sleep(2 * time.Second)
-		return false
+	if m.game.MustSkip() {
+		m.apply(engine.Action{Type: engine.SkipTurn, Player: currentPlayer.UID, Reason: engine.SkipParalyzed})
+		return
 	}
 
 	//fmt.Printf("DEBUG: Aguardando ação do jogador %s\n", currentPlayer.UID)
 
-	// timeout de 30 segundos
-	timeout := time.After(30 * time.Second)
+	// timeout do ruleset (30 segundos no clássico)
+	timeout := time.After(time.Duration(m.Ruleset.TurnTimeout) * time.Second)
 
 	for {
 		select {
 		case msg := <-m.inbox:
 			//fmt.Printf("DEBUG: Mensagem recebida no inbox: %s de %s\n", msg.Action, msg.PlayerUID)
 
+			switch msg.Action {
+			case "mulligan":
+				// o mulligan só vale antes da rodada 1
+				sendError(m.encoderFor(msg.PlayerUID), engine.ErrNotMulligan)
+				continue
+			case "giveup", "disconnect":
+				// desistir vale até fora da vez; com mais de dois a partida
+				// pode continuar, e o turno só recomeça se era a vez de quem saiu
+				//fmt.Printf("DEBUG: Processando giveup\n")
+				if m.leave(msg) && (m.game.Finished || m.game.Turn != currentPlayer.UID) {
+					return
+				}
+				continue
+			}
+
 			// ignora se não é o jogador da vez
 			if msg.PlayerUID != currentPlayer.UID {
 				//fmt.Printf("DEBUG: Mensagem ignorada - não é turno de %s (turno atual: %s)\n",
@@ -370,87 +510,201 @@ func (m *Match) processTurn(enc1, enc2 *json.Encoder) bool {
 			switch msg.Action {
 			case "usecard":
 				//fmt.Printf("DEBUG: Processando usecard\n")
-				if m.handleUseCard(enc1, enc2, msg) {
-					return true
+				if m.handleUseCard(msg) {
+					m.timeouts[msg.PlayerUID] = 0
+					// a carta ficou na pilha esperando a reação do alvo
+					if len(m.game.Stack) > 0 {
+						m.runReactionWindow()
+					}
+					// com lucidez o jogador continua jogando até mandar endTurn
+					// (a não ser que ele mesmo tenha saído da partida)
+					if m.game.Rules.Lucidity == nil || m.game.Finished || m.game.Turn != currentPlayer.UID {
+						return
+					}
 				}
-			case "giveup":
-				//fmt.Printf("DEBUG: Processando giveup\n")
-				m.handleGiveUp(enc1, enc2, msg)
-				return true
+			case "endturn":
+				if err := m.apply(engine.Action{Type: engine.EndTurn, Player: msg.PlayerUID}); err != nil {
+					sendError(m.encoderFor(msg.PlayerUID), err)
+					continue
+				}
+				m.timeouts[msg.PlayerUID] = 0
+				return
 			}
 
 		case <-timeout:
 			//fmt.Printf("DEBUG: Timeout - jogador %s perdeu o turno\n", currentPlayer.UID)
-			m.notifyBoth(enc1, enc2, fmt.Sprintf("%s perdeu o turno por timeout", currentPlayer.Username))
-			return false
+			m.timeOut(currentPlayer.UID)
+			return
 		}
 	}
 }
 
-// notifica ambos os jogadores
-func (m *Match) notifyBoth(enc1, enc2 *json.Encoder, message string) {
-	type notifyPayload struct {
-		Message string `json:"message"`
+// desistência ou queda de um jogador (em qualquer fase da partida)
+// devolve false se a engine recusou (quem já tinha sido eliminado)
+func (m *Match) leave(msg matchMsg) bool {
+	action := engine.Action{Type: engine.GiveUp, Player: msg.PlayerUID}
+	if msg.Action == "disconnect" {
+		action.Reason = string(engine.Disconnect)
 	}
+	return m.apply(action) == nil
+}
 
-	payload := notifyPayload{Message: message}
-	data, _ := json.Marshal(payload)
+// aplica uma ação na engine e manda para os jogadores o que aconteceu
+// cada carta vira um cardUsed com tudo o que ela causou; o resto dos eventos
+// vai como gameEvent, para o cliente mostrar como quiser
+func (m *Match) apply(action engine.Action) error {
+	game, events, err := engine.Apply(m.game, action)
+	if err != nil {
+		//fmt.Printf("DEBUG: Ação recusada pela engine: %v\n", err)
+		return err
+	}
+	m.mu.Lock()
+	m.game = game
+	m.mu.Unlock()
+	m.record.Actions = append(m.record.Actions, action)
+
+	var roundEnded *engine.Event
+	var used *CardUsed // carta resolvendo agora
+	cardResolved, eliminated := false, false
+
+	// fecha a carta que estava resolvendo
+	flush := func() {
+		if used != nil {
+			used.Round = m.game.Round
+			m.sendCardUsed(used)
+			used = nil
+		}
+	}
 
-	msg := Message{
-		Request: notify,
-		Data:    data,
+	for _, event := range events {
+		m.track(event, used)
+
+		switch event.Type {
+		case engine.CardPlayed, engine.ReactionPlayed:
+			flush()
+			used = newCardUsed(event)
+			cardResolved = true
+			continue
+		case engine.ReactionOpened:
+			// a carta fica na pilha e o cardUsed dela sai quando resolver
+			m.stacked, used = used, nil
+			m.sendReactionWindow(m.encoderFor(event.Player), event)
+		case engine.ReactionClosed:
+			flush() // a reação termina aqui
+			m.sendReactionClosed(m.encoderFor(event.Player), event.Reason)
+			used, m.stacked = m.stacked, nil
+			cardResolved = true
+		case engine.CardResolved:
+			flush()
+			continue
+		case engine.SanityChanged, engine.StateChanged, engine.StateResisted, engine.CardsDrawn,
+			engine.CardsDiscarded, engine.EffectCanceled, engine.DamageReflected:
+			// efeito da carta que está resolvendo
+			if used != nil {
+				used.add(event)
+				continue
+			}
+		default:
+			flush()
+		}
+
+		switch event.Type {
+		case engine.TurnSkipped:
+			if event.Reason == engine.SkipParalyzed {
+				m.sendEvent(event)
+				time.Sleep(2 * time.Second)
+				continue
+			}
+		case engine.RoundEnded:
+			roundEnded = &event
+		case engine.PlayerEliminated:
+			eliminated = true
+		}
+		m.sendEvent(event)
 	}
+	flush()
 
-	_ = enc1.Encode(msg)
-	_ = enc2.Encode(msg)
+	// envia informações atualizadas, já com a compra do próximo turno
+	switch {
+	case roundEnded != nil:
+		m.sendUpdateInfo(*roundEnded)
+	case m.game.Finished:
+		// o resumo do fim já leva tudo
+	case eliminated, cardResolved && m.game.Rules.Lucidity != nil:
+		// com lucidez o turno continua depois da carta: manda a mão e a lucidez
+		// novas; quem saiu da partida pode ter passado o turno adiante
+		m.sendUpdateInfo(engine.Event{Round: m.game.Round, Player: m.game.Turn})
+	}
+
+	return nil
 }
 
-// remove carta da mão
-func (m *Match) removeFromHand(playerUID string, card *Card) bool {
-	hand := m.Hand[playerUID]
+// começa o cardUsed de uma carta jogada (ou reação)
+func newCardUsed(event engine.Event) *CardUsed {
+	return &CardUsed{
+		Player:       event.Player,
+		Card:         *event.Card,
+		Target:       event.Target,
+		Reaction:     event.Type == engine.ReactionPlayed,
+		SanityDeltas: make(map[string]int),
+		StateChanges: []StateChange{},
+		Events:       []engine.Event{},
+	}
+}
 
-	for i, handCard := range hand {
-		if handCard.CID == card.CID {
-			m.Hand[playerUID] = append(hand[:i], hand[i+1:]...)
-			//fmt.Printf("DEBUG: Carta %s removida da mão de %s\n", card.Name, playerUID)
-			return true
-		}
+// junta um efeito na carta
+func (u *CardUsed) add(event engine.Event) {
+	switch event.Type {
+	case engine.SanityChanged:
+		u.SanityDeltas[event.Target] += event.Amount
+	case engine.StateChanged:
+		u.StateChanges = append(u.StateChanges, StateChange{Player: event.Target, State: event.State})
+	default:
+		u.Events = append(u.Events, event)
 	}
+}
 
-	//fmt.Printf("DEBUG: Carta %s não encontrada na mão de %s\n", card.Name, playerUID)
-	return false
+// manda a carta resolvida para todos
+func (m *Match) sendCardUsed(used *CardUsed) {
+	data, _ := json.Marshal(used)
+	msg := Message{Request: cardused, Data: data}
+
+	m.toPlayers(msg)
+	m.toSpectators(msg)
 }
 
-// aplica o efeito das cartas
-func (m *Match) applyCardEffect(playerUID string, card *Card, opponentUID string) {
-	// Determina o UID do alvo da carta
-	var targetUID string
-	if card.CardType == Pill {
-		targetUID = playerUID
-	} else {
-		targetUID = opponentUID
-	}
+// manda um evento da engine para todos
+func (m *Match) sendEvent(event engine.Event) {
+	data, _ := json.Marshal(event)
+	msg := Message{Request: gameevent, Data: data}
+
+	m.toPlayers(msg)
+	m.toSpectators(msg)
+}
 
-	switch card.CardType {
-	case Pill:
-		m.Sanity[targetUID] += card.Points
-	case NREM, REM:
-		m.Sanity[targetUID] -= card.Points
+// notifica todos os jogadores
+func (m *Match) notifyAll(message string) {
+	type notifyPayload struct {
+		Message string `json:"message"`
 	}
 
-	// garante que sanidade não fique negativa
-	if m.Sanity[targetUID] < 0 {
-		m.Sanity[targetUID] = 0
+	payload := notifyPayload{Message: message}
+	data, _ := json.Marshal(payload)
+
+	msg := Message{
+		Request: notify,
+		Data:    data,
 	}
 
-	//fmt.Printf("DEBUG: Efeito da carta aplicado - Jogador %s: %d -> %d\n",
-	//	targetUID, oldSanity, m.Sanity[targetUID])
+	m.toPlayers(msg)
+	m.toSpectators(msg)
 }
 
 // gerencia o uso das cartas
-func (m *Match) handleUseCard(enc1, enc2 *json.Encoder, in matchMsg) bool {
+func (m *Match) handleUseCard(in matchMsg) bool {
 	type cardReq struct {
-		Card Card `json:"card"`
+		Card   Card   `json:"card"`
+		Target string `json:"target"` // UID do oponente que recebe (só precisa com mais de um oponente)
 	}
 	var req cardReq
 	if err := json.Unmarshal(in.Data, &req); err != nil {
@@ -460,133 +714,232 @@ func (m *Match) handleUseCard(enc1, enc2 *json.Encoder, in matchMsg) bool {
 
 	//fmt.Printf("DEBUG: Processando carta %s do jogador %s\n", req.Card.Name, in.PlayerUID)
 
-	// remove a carta da mão
-	if !m.removeFromHand(in.PlayerUID, &req.Card) {
+	// a engine confere se a carta está na mão, cobra a lucidez e aplica os efeitos
+	// (a instância escolhe a cópia certa; cliente antigo manda só o CID)
+	cardID := req.Card.Instance
+	if cardID == "" {
+		cardID = req.Card.CID
+	}
+	action := engine.Action{Type: engine.PlayCard, Player: in.PlayerUID, CardID: cardID, Target: req.Target}
+	if err := m.apply(action); err != nil {
+		// sem lucidez para a carta ou sem alvo o jogador precisa saber o porquê
+		if errors.Is(err, engine.ErrNoLucidity) || errors.Is(err, engine.ErrNoTarget) || errors.Is(err, engine.ErrBadTarget) {
+			sendError(m.encoderFor(in.PlayerUID), err)
+		}
 		return false
 	}
+	return true
+}
 
-	// determina o UID do oponente
-	var opponentUID string
-	if m.P1.UID == in.PlayerUID {
-		opponentUID = m.P2.UID
-	} else {
-		opponentUID = m.P1.UID
-	}
-
-	// aplica os efeitos de sanidade da carta
-	m.applyCardEffect(in.PlayerUID, &req.Card, opponentUID)
+// janela de reação: só quem recebeu a carta pode responder (ou passar) até o
+// reactionTimeout do ruleset; se não responder, a carta resolve normalmente
+func (m *Match) runReactionWindow() {
+	defender := m.game.Stack[len(m.game.Stack)-1].Target
+	timeout := time.After(time.Duration(m.Ruleset.ReactionTimeout) * time.Second)
 
-	// aplica os efeitos de estado da carta
-	switch req.Card.CardEffect {
-	case CONS:
-		m.DreamStates[in.PlayerUID] = conscious
-		m.RoundsInState[in.PlayerUID] = 0
-	case AD:
-		m.DreamStates[opponentUID] = sleepy
-		m.RoundsInState[opponentUID] = 0
-	case PAR:
-		m.DreamStates[opponentUID] = paralyzed
-		m.RoundsInState[opponentUID] = 0
-	case AS:
-		m.DreamStates[opponentUID] = scared
-		m.RoundsInState[opponentUID] = 0
-	}
+	for {
+		select {
+		case msg := <-m.inbox:
+			switch msg.Action {
+			case "react":
+				var req struct {
+					Card string `json:"card"` // instância (ou CID) da reação; vazio = passa
+				}
+				if err := json.Unmarshal(msg.Data, &req); err != nil {
+					sendError(m.encoderFor(msg.PlayerUID), err)
+					continue
+				}
 
-	// notifica jogada
-	player, _ := pm.GetByUID(in.PlayerUID)
-	m.notifyBoth(enc1, enc2, fmt.Sprintf("%s jogou %s", player.Username, req.Card.Name))
+				action := engine.Action{Type: engine.Pass, Player: msg.PlayerUID}
+				if req.Card != "" {
+					action = engine.Action{Type: engine.React, Player: msg.PlayerUID, CardID: req.Card}
+				}
+				if err := m.apply(action); err != nil {
+					sendError(m.encoderFor(msg.PlayerUID), err)
+					continue
+				}
+				return
+			case "giveup", "disconnect":
+				// a janela só acaba se quem saiu era quem jogou ou quem defende
+				if m.leave(msg) && len(m.game.Stack) == 0 {
+					return
+				}
+			case "usecard":
+				sendError(m.encoderFor(msg.PlayerUID), engine.ErrReacting)
+			}
 
-	return true
+		case <-timeout:
+			m.apply(engine.Action{Type: engine.Pass, Player: defender})
+			return
+		}
+	}
 }
 
-// gerencia desistência
-func (m *Match) handleGiveUp(enc1, enc2 *json.Encoder, in matchMsg) {
-	m.State = Finished
+// avisa quem defende que a janela de reação abriu
+func (m *Match) sendReactionWindow(enc *json.Encoder, event engine.Event) {
+	type windowPayload struct {
+		Card    Card   `json:"card"`    // carta que vai resolver
+		From    string `json:"from"`    // quem jogou
+		Timeout int    `json:"timeout"` // segundos para reagir
+	}
 
-	var playerEnc, opponentEnc *json.Encoder
-	if in.PlayerUID == m.P1.UID {
-		playerEnc = enc1
-		opponentEnc = enc2
-	} else {
-		playerEnc = enc2
-		opponentEnc = enc1
+	payload := windowPayload{
+		Card:    *event.Card,
+		From:    m.username(event.Target),
+		Timeout: m.Ruleset.ReactionTimeout,
 	}
+	data, _ := json.Marshal(payload)
 
-	lossMsg := Message{Request: newloss, Data: nil}
-	victoryMsg := Message{Request: newvictory, Data: nil}
+	_ = enc.Encode(Message{Request: reactionwindow, Data: data})
+}
 
-	_ = playerEnc.Encode(lossMsg)
-	_ = opponentEnc.Encode(victoryMsg)
+// avisa quem defende que a janela de reação fechou
+func (m *Match) sendReactionClosed(enc *json.Encoder, reason string) {
+	data, _ := json.Marshal(map[string]string{"reason": reason})
+	_ = enc.Encode(Message{Request: reactionclosed, Data: data})
 }
 
-// atualiza estado do jogo (sanidade, estados de sonho)
-func (m *Match) updateGameState(enc1, enc2 *json.Encoder) {
-	//fmt.Printf("DEBUG: Atualizando estado do jogo - Round %d\n", m.currentRound)
+// espera a escolha de mulligan de todos (ou o timeout) e resolve todas
+// juntas; cada jogador recebe só o próprio resultado
+// com mais de dois, quem sai no mulligan fica de fora e os outros seguem
+func (m *Match) runMulligan() {
+	choices := make(map[string][]string)
+	timeout := time.After(time.Duration(m.Ruleset.MulliganTimeout) * time.Second)
 
-	// aplica efeitos dos estados de sonho
-	for playerUID, state := range m.DreamStates {
-		//oldSanity := m.Sanity[playerUID]
+wait:
+	for len(choices) < len(m.living()) {
+		select {
+		case msg := <-m.inbox:
+			switch msg.Action {
+			case "mulligan":
+				if _, chosen := choices[msg.PlayerUID]; chosen {
+					sendError(m.encoderFor(msg.PlayerUID), engine.ErrMulliganUsed)
+					continue
+				}
 
-		switch state {
-		case sleepy:
-			m.Sanity[playerUID] -= 3
-		case conscious:
-			m.Sanity[playerUID] += 1
-			m.RoundsInState[playerUID]++
-			if m.RoundsInState[playerUID] >= 2 {
-				m.DreamStates[playerUID] = sleepy
-				m.RoundsInState[playerUID] = 0
-			}
-		case paralyzed:
-			m.RoundsInState[playerUID]++
-			if m.RoundsInState[playerUID] >= 1 {
-				m.DreamStates[playerUID] = sleepy
-				m.RoundsInState[playerUID] = 0
-			}
-		case scared:
-			m.Sanity[playerUID] -= 4
-			m.RoundsInState[playerUID]++
-			if m.RoundsInState[playerUID] >= 2 {
-				m.DreamStates[playerUID] = sleepy
-				m.RoundsInState[playerUID] = 0
+				var req struct {
+					Cards []string `json:"cards"` // instâncias (ou CIDs) das cartas devolvidas
+				}
+				if err := json.Unmarshal(msg.Data, &req); err != nil {
+					sendError(m.encoderFor(msg.PlayerUID), err)
+					continue
+				}
+
+				// confere a escolha na engine sem aplicar; o mulligan de um
+				// jogador não mexe nas cartas dos outros
+				action := engine.Action{Type: engine.Mulligan, Player: msg.PlayerUID, CardIDs: req.Cards}
+				if _, _, err := engine.Apply(m.game, action); err != nil {
+					sendError(m.encoderFor(msg.PlayerUID), err)
+					continue
+				}
+				choices[msg.PlayerUID] = req.Cards
+			case "giveup", "disconnect":
+				if m.leave(msg) && m.game.Finished {
+					return
+				}
+				delete(choices, msg.PlayerUID)
 			}
+
+		case <-timeout:
+			// quem não escolheu fica com a mão
+			break wait
 		}
+	}
 
-		// garante sanidade não-negativa
-		if m.Sanity[playerUID] < 0 {
-			m.Sanity[playerUID] = 0
+	living := m.living()
+	for _, player := range living {
+		m.apply(engine.Action{Type: engine.Mulligan, Player: player.UID, CardIDs: choices[player.UID]})
+	}
+	for _, player := range living {
+		m.sendMulliganResult(m.encoderFor(player.UID), player.UID, len(choices[player.UID]))
+	}
+}
+
+// jogadores que ainda estão na partida
+func (m *Match) living() []*User {
+	var living []*User
+	for _, p := range m.Players {
+		if !m.game.Eliminated[p.UID] {
+			living = append(living, p)
 		}
+	}
+	return living
+}
+
+// manda para um jogador a mão depois do mulligan
+func (m *Match) sendMulliganResult(enc *json.Encoder, uid string, returned int) {
+	type mulliganPayload struct {
+		Hand        []Card `json:"hand"`
+		Returned    int    `json:"returned"`
+		LibrarySize int    `json:"librarySize"`
+	}
 
-		//fmt.Printf("DEBUG: Estado %s aplicado ao jogador %s: %d -> %d\n",
-		//	string(state), playerUID, oldSanity, m.Sanity[playerUID])
+	payload := mulliganPayload{
+		Hand:        m.game.Hand[uid],
+		Returned:    returned,
+		LibrarySize: len(m.game.Library[uid]),
 	}
+	data, _ := json.Marshal(payload)
+
+	_ = enc.Encode(Message{Request: mulliganresult, Data: data})
+}
 
-	// envia informações atualizadas
-	m.sendUpdateInfo(enc1, enc2)
+// codificador da conexão de um jogador da partida
+func (m *Match) encoderFor(uid string) *json.Encoder {
+	return m.encoders[uid]
 }
 
-// envia informações atualizadas para os clientes
-func (m *Match) sendUpdateInfo(enc1, enc2 *json.Encoder) {
+// manda o estado atualizado; cada jogador recebe a própria mão
+func (m *Match) sendUpdateInfo(event engine.Event) {
+	for _, p := range m.Players {
+		_ = m.encoders[p.UID].Encode(Message{Request: updateinfo, Data: m.updateInfoFor(p.UID, event)})
+	}
+	m.toSpectators(Message{Request: updateinfo, Data: m.updateInfoFor("", event)}) // sem mão
+
+	//fmt.Printf("DEBUG: Update enviado - sanidades: %v\n", m.game.Sanity)
+}
+
+// updateInfo de um jogador (uid vazio = espectador, sem mão)
+func (m *Match) updateInfoFor(uid string, event engine.Event) json.RawMessage {
 	type updatePayload struct {
-		Turn        string                `json:"turn"`
-		Sanity      map[string]int        `json:"sanity"`
-		DreamStates map[string]DreamState `json:"dreamStates"`
-		Round       int                   `json:"round"`
+		Turn         string                       `json:"turn"`
+		Sanity       map[string]int               `json:"sanity"`
+		DreamStates  map[string]engine.DreamState `json:"dreamStates"`
+		Round        int                          `json:"round"`
+		Hand         []Card                       `json:"hand"`
+		HandSizes    map[string]int               `json:"handSizes"`
+		LibrarySizes map[string]int               `json:"librarySizes"`
+		Discards     map[string][]Card            `json:"discards"`
+		Lucidity     map[string]int               `json:"lucidity,omitempty"`    // só nos rulesets com lucidez
+		MaxLucidity  map[string]int               `json:"maxLucidity,omitempty"` // até onde a lucidez enche
+		Eliminated   map[string]bool              `json:"eliminated,omitempty"`  // quem já saiu da partida (mais de dois)
 	}
 
 	payload := updatePayload{
-		Turn:        m.Turn,
-		Sanity:      m.Sanity,
-		DreamStates: m.DreamStates,
-		Round:       m.currentRound,
+		Turn:         event.Player,
+		Sanity:       m.game.Sanity,
+		DreamStates:  m.game.DreamStates,
+		Round:        event.Round,
+		Hand:         m.game.Hand[uid],
+		HandSizes:    pileSizes(m.game.Hand),
+		LibrarySizes: pileSizes(m.game.Library),
+		Discards:     m.game.Discard,
+		Eliminated:   m.game.Eliminated,
+	}
+	if m.game.Rules.Lucidity != nil {
+		payload.Lucidity = m.game.Lucidity
+		payload.MaxLucidity = m.game.MaxLucidity
 	}
 
 	data, _ := json.Marshal(payload)
-	msg := Message{Request: updateinfo, Data: data}
-
-	_ = enc1.Encode(msg)
-	_ = enc2.Encode(msg)
+	return data
+}
 
-	//fmt.Printf("DEBUG: Update enviado - P1 sanidade: %d, P2 sanidade: %d\n",
-	//	m.Sanity[m.P1.UID], m.Sanity[m.P2.UID])
+// quantas cartas cada jogador tem numa pilha
+func pileSizes(piles map[string][]Card) map[string]int {
+	sizes := make(map[string]int, len(piles))
+	for uid, pile := range piles {
+		sizes[uid] = len(pile)
+	}
+	return sizes
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"pbl-redes/engine"
+)
+
+func TestDeckCards(t *testing.T) {
+	config, err := LoadRulesets(rulesetsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deck := []*Card{
+		{CID: "T_nrem", CardType: NREM, CardEffect: NEN, Points: 1},
+		{CID: "T_reacao", CardType: Reaction},
+		{CID: "T_rem", CardType: REM, CardEffect: PAR, Points: 1},
+	}
+
+	for _, name := range []string{"classico", "rapido"} {
+		ruleset, err := config.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reactions := 0
+		for _, card := range deckCards(deck, ruleset.Reactions) {
+			if card.CardType == Reaction {
+				reactions++
+			}
+		}
+		// o clássico não tem janela de reação: a carta nunca poderia ser jogada
+		if want := map[bool]int{false: 0, true: 1}[ruleset.Reactions]; reactions != want {
+			t.Errorf("%s: deck com %d reações, esperava %d", name, reactions, want)
+		}
+	}
+}
+
+// no clássico as reações nem contam para o tamanho mínimo do deck
+func TestCheckDeckWithoutReactions(t *testing.T) {
+	pm = NewPlayerManager()
+
+	classico := Ruleset{Name: "classico", Rules: engine.DefaultRules()}
+	p := testUser(t, "reativo", classico.HandSize)
+	pm.AddToDeck(p.UID, []*Card{{CID: "T_reacao", CardType: Reaction}})
+
+	if err := classico.checkDeck(p); err == nil {
+		t.Errorf("deck de %d cartas com uma reação passou no clássico (mão de %d)", classico.HandSize+1, classico.HandSize)
+	}
+}
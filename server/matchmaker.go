@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// pareamento pelas filas com nome (data/queues.json)
+// quem entra escolhe a fila e o ruleset e só é pareado com quem escolheu os
+// dois iguais: cada par fila/ruleset é uma linha de espera, e a política da
+// fila decide quem da linha forma a próxima partida
+// o pareamento não roda num loop de tempo: acorda quando alguém entra na
+// fila, ou na hora em que a espera de alguém abre um par novo (política
+// rating) ou passa do botAfter da fila (a partida é completada com bots)
+// quem espera recebe um queueStatus a cada queueStatusInterval, com a
+// posição e uma estimativa tirada das últimas esperas da mesma linha
+
+const queueStatusInterval = 5 * time.Second
+
+var ErrNotQueued = errors.New("player não está na fila")
+
+// nome da linha de espera de uma fila com um ruleset
+func lineKey(queue, ruleset string) string {
+	return queue + "/" + ruleset
+}
+
+// coloca usuário na fila com o ruleset; devolve o lugar dele na fila
+func (mm *MatchManager) Enqueue(p *User, queue Queue, ruleset Ruleset) (QueueInfo, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	// verifica se já está em jogo
+	if p.IsInBattle {
+		return QueueInfo{}, errors.New("player já está em jogo")
+	}
+	if err := ruleset.checkDeck(p); err != nil {
+		return QueueInfo{}, err
+	}
+	if err := validBestOf(queue.BestOf, ruleset); err != nil {
+		return QueueInfo{}, err
+	}
+
+	// evita-se duplicata na fila (em qualquer uma delas)
+	if _, i := mm.findQueued(p.UID); i >= 0 {
+		return QueueInfo{}, errors.New("player já está na fila")
+	}
+
+	key := lineKey(queue.Name, ruleset.Name)
+	line, exists := mm.lines[key]
+	if !exists {
+		line = &waitLine{Queue: queue, Ruleset: ruleset, policy: queue.policy()}
+		mm.lines[key] = line
+	}
+	now := time.Now()
+	line.entries = append(line.entries, &queueEntry{user: p, since: now})
+
+	mm.wakeMatchmaker()
+	return mm.queueInfo(key, len(line.entries)-1, now), nil
+}
+
+// tira o jogador da fila em que ele está; devolve como ela estava para ele
+func (mm *MatchManager) LeaveQueue(uid string) (QueueInfo, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	key, i := mm.findQueued(uid)
+	if i < 0 {
+		return QueueInfo{}, ErrNotQueued
+	}
+	user := mm.lines[key].entries[i].user
+	info := mm.queueInfo(key, i, time.Now())
+	mm.leaveQueues(uid)
+
+	fmt.Printf("%s saiu da fila %s depois de %ds\n", user.Username, key, info.Waited)
+	return info, nil
+}
+
+// tira o usuário de todas as filas (com mm.mu travado); linha vazia some
+func (mm *MatchManager) leaveQueues(uid string) {
+	for key, line := range mm.lines {
+		line.entries = slices.DeleteFunc(line.entries, func(e *queueEntry) bool { return e.user.UID == uid })
+		if len(line.entries) == 0 {
+			delete(mm.lines, key)
+		}
+	}
+}
+
+// linha e posição do jogador (com mm.mu travado); -1 se não estiver em nenhuma
+func (mm *MatchManager) findQueued(uid string) (string, int) {
+	for key, line := range mm.lines {
+		if i := slices.IndexFunc(line.entries, func(e *queueEntry) bool { return e.user.UID == uid }); i >= 0 {
+			return key, i
+		}
+	}
+	return "", -1
+}
+
+// acorda o pareamento; se já tem um aviso esperando, ele basta
+func (mm *MatchManager) wakeMatchmaker() {
+	select {
+	case mm.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop de pareamento: dorme até alguém entrar na fila (ou até a hora em que
+// uma espera abre um par novo ou chama os bots) e então forma todas as
+// partidas que der
+func (mm *MatchManager) matchmakingLoop() {
+	var retry *time.Timer
+	for range mm.wake {
+		mm.mu.Lock()
+		next := mm.pairAll(time.Now())
+		mm.mu.Unlock()
+
+		if retry != nil {
+			retry.Stop()
+			retry = nil
+		}
+		if next > 0 {
+			retry = time.AfterFunc(next, mm.wakeMatchmaker)
+		}
+	}
+}
+
+// forma as partidas que as linhas permitem (com mm.mu travado)
+// devolve daqui a quanto tempo vale tentar de novo (0 = só quando alguém entrar)
+func (mm *MatchManager) pairAll(now time.Time) time.Duration {
+	var next time.Duration
+	for _, key := range slices.Sorted(maps.Keys(mm.lines)) {
+		line := mm.lines[key]
+		need := line.Ruleset.PlayerCount()
+
+		for len(line.entries) >= need {
+			group, retry := line.policy.pick(line.entries, need, now)
+			if group == nil {
+				next = sooner(next, retry)
+				break
+			}
+
+			picked := make([]*queueEntry, len(group))
+			for i, index := range group {
+				picked[i] = line.entries[index]
+			}
+
+			// quem cai sai da fila na hora, mas a conexão pode cair entre uma
+			// coisa e outra: quem caiu sai da linha, os outros ficam onde
+			// estavam e a política escolhe de novo
+			if slices.ContainsFunc(picked, offline) {
+				line.entries = slices.DeleteFunc(line.entries, offline)
+				continue
+			}
+			mm.startFromLine(key, line, picked, now)
+		}
+
+		// quem esperou mais que o botAfter joga com quem mais estiver na
+		// linha (sem passar da partida) e bots nos lugares que sobram
+		for line.Queue.BotAfter > 0 && len(line.entries) > 0 {
+			wait := time.Duration(line.Queue.BotAfter)*time.Second - now.Sub(line.entries[0].since)
+			if wait > 0 {
+				next = sooner(next, wait)
+				break
+			}
+
+			picked := slices.Clone(line.entries[:min(len(line.entries), need-1)])
+			if slices.ContainsFunc(picked, offline) {
+				line.entries = slices.DeleteFunc(line.entries, offline)
+				continue
+			}
+			mm.startFromLine(key, line, picked, now)
+		}
+
+		if len(line.entries) == 0 {
+			delete(mm.lines, key)
+		}
+	}
+	return next
+}
+
+// tira os escolhidos da linha e começa a partida deles (com mm.mu travado)
+// os lugares que faltam vão para bots, e aí a partida não vale rating
+func (mm *MatchManager) startFromLine(key string, line *waitLine, picked []*queueEntry, now time.Time) {
+	line.entries = slices.DeleteFunc(line.entries, func(e *queueEntry) bool { return slices.Contains(picked, e) })
+	mm.recordWait(key, picked, now)
+
+	players := make([]*User, len(picked))
+	for i, e := range picked {
+		players[i] = e.user
+	}
+	for len(players) < line.Ruleset.PlayerCount() {
+		players = append(players, mm.newBot(picked[0].user, line.Queue.BotLevel))
+	}
+
+	series := mm.newSeries(players, line.Queue.BestOf, line.Queue.Ranked && len(picked) == len(players))
+	mm.startMatch(players, line.Ruleset, series)
+}
+
+// quem caiu enquanto esperava
+func offline(e *queueEntry) bool {
+	return e.user.Connection == nil
+}
+
+// o menor dos dois prazos (0 = sem prazo)
+func sooner(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// como está a fila para quem está na posição i da linha (com mm.mu travado)
+func (mm *MatchManager) queueInfo(key string, i int, now time.Time) QueueInfo {
+	line := mm.lines[key]
+	waited := now.Sub(line.entries[i].since)
+
+	info := QueueInfo{
+		Queue:    line.Queue.Name,
+		Ruleset:  line.Ruleset.Name,
+		Position: i + 1,
+		Size:     len(line.entries),
+		Needed:   line.Ruleset.PlayerCount(),
+		Waited:   int(waited / time.Second),
+		Estimate: -1,
+	}
+	if average, ok := mm.waits[key]; ok {
+		// quem já passou da média fica com 0: deve sair a qualquer momento
+		info.Estimate = max(int((average-waited)/time.Second), 0)
+	}
+	return info
+}
+
+// guarda quanto a partida demorou para encher (com mm.mu travado): a espera
+// de quem estava há mais tempo, porque o último a entrar quase não espera
+// a média pesa mais as últimas esperas, que dizem mais do movimento de agora
+func (mm *MatchManager) recordWait(key string, picked []*queueEntry, now time.Time) {
+	var wait time.Duration
+	for _, e := range picked {
+		wait = max(wait, now.Sub(e.since))
+	}
+	if average, ok := mm.waits[key]; ok {
+		mm.waits[key] = (3*average + wait) / 4
+	} else {
+		mm.waits[key] = wait
+	}
+}
+
+// manda o queueStatus para todo mundo que está na fila
+func (mm *MatchManager) queueStatusLoop() {
+	ticker := time.NewTicker(queueStatusInterval)
+	defer ticker.Stop()
+
+	type status struct {
+		user *User
+		info QueueInfo
+	}
+
+	for range ticker.C {
+		var pending []status
+		now := time.Now()
+
+		mm.mu.Lock()
+		for key, line := range mm.lines {
+			for i, e := range line.entries {
+				pending = append(pending, status{user: e.user, info: mm.queueInfo(key, i, now)})
+			}
+		}
+		mm.mu.Unlock()
+
+		// manda fora do lock: uma conexão lenta não segura o pareamento
+		for _, s := range pending {
+			notifyUser(s.user, queuestatus, s.info)
+		}
+	}
+}
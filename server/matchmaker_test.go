@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// quem espera na linha: um por rating, cada um esperando waited segundos
+func testEntries(now time.Time, waited int, ratings ...int) []*queueEntry {
+	entries := make([]*queueEntry, len(ratings))
+	for i, rating := range ratings {
+		entries[i] = &queueEntry{user: &User{UID: string(rune('a' + i)), Rating: rating}, since: now.Add(-time.Duration(waited) * time.Second)}
+	}
+	return entries
+}
+
+func TestLoadQueues(t *testing.T) {
+	rulesets, err := LoadRulesets(rulesetsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadQueues(queuesFile, rulesets)
+	if err != nil {
+		t.Fatalf("filas do servidor inválidas: %v", err)
+	}
+	if casual, _ := config.Get("casual"); casual.Ranked {
+		t.Errorf("fila casual vale rating")
+	}
+	if _, ok := config.Queues["ranqueada"].policy().(ratingPolicy); !ok {
+		t.Errorf("fila ranqueada sem a política de rating")
+	}
+
+	tests := []struct {
+		name  string
+		queue string
+		err   string
+	}{
+		{"política que não existe", `{"policy": "sorteio"}`, "policy"},
+		{"janela negativa", `{"policy": "rating", "ratingWindow": -1}`, "negativos"},
+		{"botAfter negativo", `{"policy": "fifo", "botAfter": -5}`, "botAfter"},
+		{"nível de bot que não existe", `{"policy": "fifo", "botLevel": "impossivel"}`, "impossivel"},
+		{"ruleset que não existe", `{"policy": "fifo", "ruleset": "nenhum"}`, "nenhum"},
+		{"melhor de número par", `{"policy": "rating", "bestOf": 2}`, "bestOf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "queues.json")
+			data := `{"default": "teste", "queues": {"teste": ` + tt.queue + `}}`
+			if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadQueues(filename, rulesets)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("erro %v, esperava algo com %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFifoPolicy(t *testing.T) {
+	now := time.Now()
+
+	// por ordem de chegada, sem olhar o rating
+	group, next := fifoPolicy{}.pick(testEntries(now, 0, 1000, 2000, 1000), 2, now)
+	if !slices.Equal(group, []int{0, 1}) || next != 0 {
+		t.Errorf("fifo escolheu %v (próxima em %v), esperava [0 1]", group, next)
+	}
+
+	// sem gente suficiente não forma partida nem marca hora para tentar
+	group, next = fifoPolicy{}.pick(testEntries(now, 60, 1000, 1000, 1000), 4, now)
+	if group != nil || next != 0 {
+		t.Errorf("fifo com 3 de 4 escolheu %v (próxima em %v)", group, next)
+	}
+}
+
+func TestRatingPolicy(t *testing.T) {
+	now := time.Now()
+	policy := ratingPolicy{window: 100, growth: 10}
+
+	tests := []struct {
+		name    string
+		waited  int
+		ratings []int
+		need    int
+		group   []int
+		next    time.Duration
+	}{
+		{"dentro da janela", 0, []int{1000, 1080}, 2, []int{0, 1}, 0},
+		{"o de rating mais perto, não o que chegou antes", 0, []int{1000, 1500, 1010}, 2, []int{0, 2}, 0},
+		{"longe demais, espera a janela abrir", 0, []int{1000, 1300}, 2, nil, 20 * time.Second},
+		{"a janela abriu com a espera", 20, []int{1000, 1300}, 2, []int{0, 1}, 0},
+		{"quem está longe espera o par dos outros", 0, []int{2000, 1000, 1050}, 2, []int{1, 2}, 0},
+		{"mais de dois", 0, []int{1000, 1500, 1050, 1020}, 3, []int{0, 2, 3}, 0},
+		{"sem gente suficiente", 60, []int{1000}, 2, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group, next := policy.pick(testEntries(now, tt.waited, tt.ratings...), tt.need, now)
+			if !slices.Equal(group, tt.group) || next != tt.next {
+				t.Errorf("escolheu %v (próxima em %v), esperava %v (próxima em %v)", group, next, tt.group, tt.next)
+			}
+		})
+	}
+
+	// sem crescimento a janela nunca abre: não tem hora para tentar de novo
+	group, next := ratingPolicy{window: 100}.pick(testEntries(now, 600, 1000, 1300), 2, now)
+	if group != nil || next != 0 {
+		t.Errorf("sem growth escolheu %v (próxima em %v)", group, next)
+	}
+}
+
+func TestBotBackfill(t *testing.T) {
+	pm = NewPlayerManager()
+	mm = NewMatchManager(1)
+
+	rulesets, err := LoadRulesets(rulesetsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	classico, err := rulesets.Get("classico")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a conexão fica aberta e ninguém lê: a partida que começa trava no
+	// primeiro envio e não mexe mais no mm
+	a := testUser(t, "a", minDeckSize)
+	a.Connection, _ = net.Pipe()
+
+	queue := Queue{Name: "ranqueada", Policy: policyRating, Ranked: true, RatingWindow: 150, BotAfter: 90, BotLevel: aiHard}
+	key := lineKey(queue.Name, classico.Name)
+	now := time.Now()
+	mm.lines[key] = &waitLine{Queue: queue, Ruleset: classico, policy: queue.policy(), entries: []*queueEntry{{user: a, since: now.Add(-89 * time.Second)}}}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	// antes do botAfter só marca a hora de chamar o bot
+	if next := mm.pairAll(now); next != time.Second {
+		t.Errorf("próxima tentativa em %v, esperava 1s", next)
+	}
+	if len(mm.matches) != 0 {
+		t.Fatalf("partida começou antes do botAfter")
+	}
+
+	if next := mm.pairAll(now.Add(time.Second)); next != 0 {
+		t.Errorf("próxima tentativa em %v com a linha vazia", next)
+	}
+	m := mm.byPlayer[a.UID]
+	if m == nil {
+		t.Fatalf("sem partida depois do botAfter")
+	}
+	if _, exists := mm.lines[key]; exists {
+		t.Errorf("linha continua depois da partida")
+	}
+
+	bot := m.Players[1]
+	if m.Players[0] != a || !bot.IsBot || bot.BotLevel != aiHard {
+		t.Errorf("jogadores %v, esperava a contra um bot %s", m.names(), aiHard)
+	}
+	if len(bot.Deck) != len(a.Deck) {
+		t.Errorf("bot com %d cartas, esperava a cópia das %d do rival", len(bot.Deck), len(a.Deck))
+	}
+	// fila ranqueada, mas partida com bot não vale rating
+	if m.series.Ranked {
+		t.Errorf("partida com bot vale rating")
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strconv"
 	"time"
 )
 
+// quantos replays cada jogador consegue baixar
+const maxReplays = 10
+
 func NewPlayerManager() *PlayerManager {
 	return &PlayerManager{
 		byUID:       make(map[string]*User),
@@ -32,6 +36,7 @@ func (pm *PlayerManager) CreatePlayer(username, password string, connection net.
 		Deck:       make([]*Card, 0),
 		CreatedAt:  time.Now(),
 		LastLogin:  time.Now(),
+		Rating:     StartingRating,
 		Connection: connection,
 	}
 	pm.byUID[p.UID] = p
@@ -67,6 +72,20 @@ func (pm *PlayerManager) GetByUID(uid string) (*User, error) {
 	return p, nil
 }
 
+// busca um usuário online pelo nome (para desafios)
+func (pm *PlayerManager) GetOnline(username string) (*User, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	p, ok := pm.byUsername[username]
+	if !ok {
+		return nil, errors.New("usuário não encontrado")
+	}
+	if _, online := pm.activeByUID[p.UID]; !online || p.Connection == nil {
+		return nil, errors.New("usuário não está online")
+	}
+	return p, nil
+}
+
 // adiciona ao deck
 func (pm *PlayerManager) AddToDeck(uid string, cards []*Card) error {
 	pm.mu.Lock()
@@ -79,6 +98,19 @@ func (pm *PlayerManager) AddToDeck(uid string, cards []*Card) error {
 	return nil
 }
 
+// devolve uma cópia do deck do jogador
+func (pm *PlayerManager) GetDeck(uid string) ([]*Card, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	p, ok := pm.byUID[uid]
+	if !ok {
+		return nil, errors.New("usuário não encontrado")
+	}
+	deck := make([]*Card, len(p.Deck))
+	copy(deck, p.Deck)
+	return deck, nil
+}
+
 func (pm *PlayerManager) Logout(user *User) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -97,3 +129,46 @@ func (pm *PlayerManager) Logout(user *User) {
 	user.IsInBattle = false
 	user.Connection = nil
 }
+
+// registra vitórias, derrotas e empates de uma partida sem Elo (de mais de
+// dois ou que não vale rating); sem vencedores, todos empatam
+func (pm *PlayerManager) RecordGroupResult(players []*User, winners []string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for _, p := range players {
+		switch {
+		case len(winners) == 0:
+			p.TotalTies++
+		case slices.Contains(winners, p.UID):
+			p.TotalWins++
+		default:
+			p.TotalLosses++
+		}
+	}
+}
+
+// guarda o replay de uma partida na lista de cada jogador (só os maxReplays últimos)
+func (pm *PlayerManager) AddReplay(id string, players ...*User) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for _, p := range players {
+		p.Replays = append(p.Replays, id)
+		if len(p.Replays) > maxReplays {
+			p.Replays = p.Replays[len(p.Replays)-maxReplays:]
+		}
+	}
+}
+
+// IDs dos replays que o jogador pode baixar, o mais recente por último
+func (pm *PlayerManager) GetReplays(uid string) ([]string, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	p, ok := pm.byUID[uid]
+	if !ok {
+		return nil, errors.New("usuário não encontrado")
+	}
+	return append([]string(nil), p.Replays...), nil
+}
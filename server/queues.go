@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+// políticas de pareamento das filas
+const (
+	policyFIFO   = "fifo"
+	policyRating = "rating"
+)
+
+// carrega as filas do arquivo de configuração
+// uma fila presa a um ruleset precisa de um ruleset que exista
+func LoadQueues(filename string, rulesets RulesetConfig) (QueueConfig, error) {
+	var config QueueConfig
+
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return config, fmt.Errorf("erro ao ler arquivo: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("erro ao deserializar JSON: %v", err)
+	}
+
+	var problems []error
+	for _, name := range slices.Sorted(maps.Keys(config.Queues)) {
+		queue := config.Queues[name]
+		queue.Name = name
+
+		switch queue.Policy {
+		case policyFIFO:
+		case policyRating:
+			if queue.RatingWindow < 0 || queue.RatingGrowth < 0 {
+				problems = append(problems, fmt.Errorf("fila %s: ratingWindow e ratingGrowth não podem ser negativos", name))
+			}
+		default:
+			problems = append(problems, fmt.Errorf("fila %s: policy %q não existe (use %s ou %s)", name, queue.Policy, policyFIFO, policyRating))
+		}
+		if queue.BotAfter < 0 {
+			problems = append(problems, fmt.Errorf("fila %s: botAfter não pode ser negativo", name))
+		}
+		level, err := parseAILevel(queue.BotLevel)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("fila %s: %v", name, err))
+		}
+		queue.BotLevel = level
+		var ruleset Ruleset
+		if queue.Ruleset != "" {
+			if ruleset, err = rulesets.Get(queue.Ruleset); err != nil {
+				problems = append(problems, fmt.Errorf("fila %s: %v", name, err))
+			}
+		}
+		// sem ruleset fixo, o de mais de dois é recusado no Enqueue
+		if err := validBestOf(queue.BestOf, ruleset); err != nil {
+			problems = append(problems, fmt.Errorf("fila %s: %v", name, err))
+		}
+
+		config.Queues[name] = queue
+	}
+
+	if _, exists := config.Queues[config.Default]; !exists {
+		problems = append(problems, fmt.Errorf("fila padrão %q não existe", config.Default))
+	}
+
+	return config, errors.Join(problems...)
+}
+
+// busca uma fila pelo nome (vazio = padrão)
+func (config QueueConfig) Get(name string) (Queue, error) {
+	if name == "" {
+		name = config.Default
+	}
+	queue, exists := config.Queues[name]
+	if !exists {
+		return Queue{}, fmt.Errorf("fila %s não existe", name)
+	}
+	return queue, nil
+}
+
+// política de pareamento de uma fila: escolhe, entre quem espera (por ordem
+// de chegada), os need jogadores da próxima partida; se ainda não dá,
+// devolve daqui a quanto tempo pode dar (0 = só com alguém novo na fila)
+type pairingPolicy interface {
+	pick(entries []*queueEntry, need int, now time.Time) ([]int, time.Duration)
+}
+
+func (q Queue) policy() pairingPolicy {
+	if q.Policy == policyRating {
+		return ratingPolicy{window: q.RatingWindow, growth: q.RatingGrowth}
+	}
+	return fifoPolicy{}
+}
+
+// ordem de chegada: os primeiros da fila
+type fifoPolicy struct{}
+
+func (fifoPolicy) pick(entries []*queueEntry, need int, now time.Time) ([]int, time.Duration) {
+	if len(entries) < need {
+		return nil, 0
+	}
+	group := make([]int, need)
+	for i := range group {
+		group[i] = i
+	}
+	return group, 0
+}
+
+// rating parecido: cada um, começando por quem espera há mais tempo, tenta
+// formar a partida com os de rating mais perto do dele; a diferença aceita
+// abre com a espera, para ninguém ficar preso por ter rating alto ou baixo
+// demais
+type ratingPolicy struct {
+	window int // diferença aceita logo de cara
+	growth int // quanto a diferença aceita cresce por segundo de espera
+}
+
+func (p ratingPolicy) pick(entries []*queueEntry, need int, now time.Time) ([]int, time.Duration) {
+	if len(entries) < need {
+		return nil, 0
+	}
+
+	var next time.Duration
+	for anchor, entry := range entries {
+		// os outros, do rating mais perto para o mais longe (no empate, quem chegou antes)
+		others := make([]int, 0, len(entries)-1)
+		for i := range entries {
+			if i != anchor {
+				others = append(others, i)
+			}
+		}
+		slices.SortStableFunc(others, func(a, b int) int {
+			return cmp.Compare(ratingGap(entry, entries[a]), ratingGap(entry, entries[b]))
+		})
+
+		group := append([]int{anchor}, others[:need-1]...)
+		gap := ratingGap(entry, entries[group[need-1]])
+		waited := now.Sub(entry.since)
+		if gap <= p.window+p.growth*int(waited/time.Second) {
+			slices.Sort(group) // volta para a ordem de chegada (é dela que saem as duplas)
+			return group, 0
+		}
+
+		// quando a diferença aceita desse jogador chega no gap
+		if p.growth > 0 {
+			seconds := (gap - p.window + p.growth - 1) / p.growth
+			if wait := time.Duration(seconds)*time.Second - waited; next == 0 || wait < next {
+				next = wait
+			}
+		}
+	}
+	return nil, next
+}
+
+// diferença de rating entre dois da fila
+func ratingGap(a, b *queueEntry) int {
+	gap := a.user.Rating - b.user.Rating
+	if gap < 0 {
+		return -gap
+	}
+	return gap
+}
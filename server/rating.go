@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// rating Elo: só partidas de dois que valem rating mexem nele (veja o endGame)
+
+// rating de quem nunca jogou e fator K do Elo
+const (
+	StartingRating = 1000
+	ratingK        = 32
+)
+
+// registra o resultado de uma partida nos dois jogadores e atualiza o Elo
+// score é o resultado de p1: 1 vitória, 0.5 empate, 0 derrota
+// devolve quanto o rating de cada um mudou
+func (pm *PlayerManager) RecordResult(p1, p2 *User, score float64) (int, int) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	switch score {
+	case 1:
+		p1.TotalWins++
+		p2.TotalLosses++
+	case 0:
+		p1.TotalLosses++
+		p2.TotalWins++
+	default:
+		p1.TotalTies++
+		p2.TotalTies++
+	}
+
+	expected := 1 / (1 + math.Pow(10, float64(p2.Rating-p1.Rating)/400))
+	change := int(math.Round(ratingK * (score - expected)))
+	p1.Rating += change
+	p2.Rating -= change
+	return change, -change
+}
+
+// soma a partida no placar da série e registra vitórias, derrotas e Elo (o
+// recordRating decide se a partida vale); numa melhor de N o resultado só
+// conta uma vez, com o da série, quando ela acaba
+func (m *Match) scoreGame() map[string]int {
+	m.mu.Lock()
+	m.series.add(m.game)
+	m.mu.Unlock()
+
+	switch {
+	case m.series.BestOf == 0:
+		return m.recordRating(m.game.Result.Winners)
+	case m.series.Finished:
+		return m.recordSeries()
+	}
+	return make(map[string]int, len(m.Players))
+}
+
+// registra o resultado da partida (ou da série) de todo caminho que mexe em
+// rating: contra bot nada conta; o Elo só muda no um contra um que vale
+// rating, o resto só entra nas estatísticas
+// (vitória do primeiro = 1, do segundo = 0, empate = 0.5)
+func (m *Match) recordRating(winners []string) map[string]int {
+	changes := make(map[string]int, len(m.Players))
+	if m.hasBots() {
+		return changes
+	}
+	if len(m.Players) != 2 || !m.series.Ranked {
+		pm.RecordGroupResult(m.Players, winners)
+		return changes
+	}
+
+	p1, p2 := m.Players[0], m.Players[1]
+	score := 0.5
+	switch {
+	case slices.Contains(winners, p1.UID):
+		score = 1
+	case slices.Contains(winners, p2.UID):
+		score = 0
+	}
+	change1, change2 := pm.RecordResult(p1, p2, score)
+	return map[string]int{p1.UID: change1, p2.UID: change2}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pbl-redes/engine"
+)
+
+// revanche: depois do fim da partida os jogadores têm rematchTimeout segundos
+// para aceitar; aceitando todos, começa outra partida entre os mesmos, com o
+// mesmo ruleset, o mesmo placar da série e o seguinte de quem começou a
+// anterior começando; a revanche nunca vale rating (ver Series.next)
+
+// janela de revanche, ainda dentro da goroutine da partida (todos continuam
+// em jogo até ela fechar); devolve true se todos aceitaram
+// quem caiu não tem revanche: nem abre a janela; melhor de N também não
+func (m *Match) runRematch() bool {
+	if m.Ruleset.RematchTimeout <= 0 || m.game.Result.Reason == engine.Disconnect || m.series.BestOf > 0 {
+		return false
+	}
+
+	m.sendRematch(rematchoffer, RematchInfo{Timeout: m.Ruleset.RematchTimeout, Series: m.series})
+
+	accepted := make(map[string]bool)
+	timeout := time.After(time.Duration(m.Ruleset.RematchTimeout) * time.Second)
+	for len(accepted) < len(m.Players) {
+		select {
+		case msg := <-m.inbox:
+			switch msg.Action {
+			case "rematch":
+				var req struct {
+					Accept bool `json:"accept"`
+				}
+				if err := json.Unmarshal(msg.Data, &req); err != nil {
+					sendError(m.encoderFor(msg.PlayerUID), err)
+					continue
+				}
+				if !req.Accept {
+					m.sendRematch(rematchclosed, RematchInfo{Player: m.username(msg.PlayerUID), Reason: closedDeclined})
+					return false
+				}
+				if !accepted[msg.PlayerUID] {
+					accepted[msg.PlayerUID] = true
+					m.sendRematch(rematchaccept, RematchInfo{Player: m.username(msg.PlayerUID)})
+				}
+			case "giveup":
+				// sair depois do fim é o mesmo que recusar
+				m.sendRematch(rematchclosed, RematchInfo{Player: m.username(msg.PlayerUID), Reason: closedDeclined})
+				return false
+			case "disconnect":
+				m.sendRematch(rematchclosed, RematchInfo{Player: m.username(msg.PlayerUID), Reason: closedOffline})
+				return false
+			}
+
+		case <-timeout:
+			m.sendRematch(rematchclosed, RematchInfo{Reason: closedExpired})
+			return false
+		}
+	}
+
+	fmt.Printf("Revanche combinada na partida %d (%s)\n", m.ID, m.names())
+	return true
+}
+
+func (m *Match) sendRematch(request string, info RematchInfo) {
+	data, _ := json.Marshal(info)
+	m.toPlayers(Message{Request: request, Data: data})
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestRematchSeries(t *testing.T) {
+	pm = NewPlayerManager()
+	mm = NewMatchManager(1)
+	a, b := testUser(t, "a", minDeckSize), testUser(t, "b", minDeckSize)
+	players := []*User{a, b}
+
+	// partida da fila ranqueada: vale Elo
+	ranked := mm.newSeries(players, 0, true)
+	testFinishedMatch(players, ranked, a.UID, a.UID).scoreGame()
+	rating := a.Rating
+	if rating == StartingRating {
+		t.Fatalf("a partida ranqueada não mexeu no Elo")
+	}
+
+	rematch := ranked.next()
+	if rematch.Ranked || rematch.ID != ranked.ID || rematch.Wins[a.UID] != 1 || rematch.Games != 1 {
+		t.Fatalf("revanche com ranked %v, série %d e placar %v em %d partidas; esperava sem rating e o placar da série %d", rematch.Ranked, rematch.ID, rematch.Wins, rematch.Games, ranked.ID)
+	}
+
+	// ganhar a revanche conta nas estatísticas, mas não no Elo
+	changes := testFinishedMatch(players, rematch, b.UID, a.UID).scoreGame()
+	if a.Rating != rating || changes[a.UID] != 0 {
+		t.Errorf("revanche mexeu no Elo: %d para %d (%+d)", rating, a.Rating, changes[a.UID])
+	}
+	if a.TotalWins != 2 {
+		t.Errorf("a com %d vitórias, esperava 2", a.TotalWins)
+	}
+	if !ranked.Ranked || ranked.Wins[a.UID] != 1 {
+		t.Errorf("a revanche mudou a série da partida anterior: %+v", ranked)
+	}
+
+	// a melhor de N continua a mesma série, com o rating dela
+	bestOf := mm.newSeries(players, 3, true)
+	if bestOf.next() != bestOf {
+		t.Errorf("a próxima partida da melhor de N saiu de outra série")
+	}
+}
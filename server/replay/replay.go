@@ -0,0 +1,145 @@
+// pacote replay: gravação de uma partida para rodar de novo na engine
+//
+// a engine é determinística, então basta guardar as regras, a seed, os decks
+// de cada jogador e a lista de ações aceitas para refazer a partida inteira
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"pbl-redes/cards"
+	"pbl-redes/engine"
+)
+
+// replay de uma partida (arquivo data/replays/<id>.json)
+type Replay struct {
+	ID      string                  `json:"id"`
+	Match   int                     `json:"match"` // ID da partida no log do servidor
+	Ruleset string                  `json:"ruleset"`
+	Rules   engine.Rules            `json:"rules"`
+	Seed    int64                   `json:"seed"`
+	First   string                  `json:"first,omitempty"` // quem começou sem cara ou coroa (revanche)
+	Players []Player                `json:"players"`         // na ordem passada para engine.Start
+	Teams   map[string]int          `json:"teams,omitempty"` // time de cada jogador (só nas partidas em dupla)
+	Decks   map[string][]cards.Card `json:"decks"`           // decks antes de embaralhar
+	Hands   map[string][]cards.Card `json:"hands"`           // mãos iniciais (antes do mulligan)
+	Actions []engine.Action         `json:"actions"`         // só as ações que a engine aceitou, na ordem
+	Result  *engine.Result          `json:"result,omitempty"`
+	Started time.Time               `json:"started"`
+	Ended   time.Time               `json:"ended"`
+}
+
+type Player struct {
+	UID      string `json:"uid"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot,omitempty"` // jogador do servidor
+}
+
+var (
+	ErrHands    = errors.New("mãos iniciais diferentes das gravadas")
+	ErrRejected = errors.New("engine recusou uma ação gravada")
+	ErrResult   = errors.New("resultado diferente do gravado")
+)
+
+// lê um replay do disco
+func Load(filename string) (Replay, error) {
+	var r Replay
+
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return r, fmt.Errorf("erro ao ler arquivo: %v", err)
+	}
+	if err := json.Unmarshal(file, &r); err != nil {
+		return r, fmt.Errorf("erro ao deserializar JSON: %v", err)
+	}
+	return r, nil
+}
+
+// grava o replay em dir/<id>.json e devolve o caminho
+func (r Replay) Save(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("erro ao criar diretório: %v", err)
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar replay: %v", err)
+	}
+
+	filename := filepath.Join(dir, r.ID+".json")
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		return "", fmt.Errorf("erro ao gravar arquivo: %v", err)
+	}
+	return filename, nil
+}
+
+// nome de um jogador pelo UID (o próprio UID se não estiver no replay)
+func (r Replay) Username(uid string) string {
+	for _, player := range r.Players {
+		if player.UID == uid {
+			return player.Username
+		}
+	}
+	return uid
+}
+
+// recria o estado inicial e confere se as mãos batem com as gravadas
+func (r Replay) Start() (engine.State, error) {
+	uids := make([]string, len(r.Players))
+	for i, player := range r.Players {
+		uids[i] = player.UID
+	}
+
+	s := engine.Start(engine.Setup{Rules: r.Rules, Seed: r.Seed, Players: uids, Decks: r.Decks, First: r.First, Teams: r.Teams})
+	for _, uid := range uids {
+		if !sameCards(s.Hand[uid], r.Hands[uid]) {
+			return s, fmt.Errorf("%w (%s)", ErrHands, r.Username(uid))
+		}
+	}
+	return s, nil
+}
+
+// roda a partida inteira chamando step depois de cada ação
+// para na primeira ação recusada e, no fim, confere o resultado gravado
+func (r Replay) Run(step func(i int, action engine.Action, s engine.State, events []engine.Event)) (engine.State, error) {
+	s, err := r.Start()
+	if err != nil {
+		return s, err
+	}
+
+	for i, action := range r.Actions {
+		next, events, err := engine.Apply(s, action)
+		if err != nil {
+			return s, fmt.Errorf("%w: ação %d (%s de %s): %v", ErrRejected, i, action.Type, r.Username(action.Player), err)
+		}
+		s = next
+		if step != nil {
+			step(i, action, s, events)
+		}
+	}
+
+	if !sameResult(s.Result, r.Result) {
+		return s, ErrResult
+	}
+	return s, nil
+}
+
+// mesmas cartas na mesma ordem (pela instância)
+func sameCards(a, b []cards.Card) bool {
+	return slices.EqualFunc(a, b, func(x, y cards.Card) bool {
+		return x.CID == y.CID && x.Instance == y.Instance
+	})
+}
+
+func sameResult(a, b *engine.Result) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Reason == b.Reason && slices.Equal(a.Winners, b.Winners)
+}
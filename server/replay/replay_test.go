@@ -0,0 +1,97 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"pbl-redes/cards"
+	"pbl-redes/engine"
+)
+
+// joga uma partida inteira (cada um joga a primeira carta da mão) e
+// devolve o replay dela, do jeito que o servidor grava
+func testReplay(t *testing.T) Replay {
+	t.Helper()
+	rules := engine.DefaultRules()
+	decks := make(map[string][]cards.Card)
+	for _, uid := range []string{"a", "b"} {
+		for i := 0; i < 20; i++ {
+			effect := cards.NEN
+			if i%4 == 0 {
+				effect = cards.AS
+			}
+			decks[uid] = append(decks[uid], cards.Card{CID: fmt.Sprintf("T_%s_%02d", uid, i), CardType: cards.NREM, CardEffect: effect, Points: 3})
+		}
+	}
+
+	r := Replay{
+		ID:      "teste",
+		Rules:   rules,
+		Seed:    42,
+		Players: []Player{{UID: "a", Username: "ana"}, {UID: "b", Username: "bia"}},
+		Decks:   decks,
+		Actions: []engine.Action{},
+	}
+	s := engine.Start(engine.Setup{Rules: rules, Seed: r.Seed, Players: []string{"a", "b"}, Decks: decks})
+	r.Hands = s.Hand
+
+	for !s.Finished {
+		action := engine.Action{Type: engine.EndTurn, Player: s.Turn}
+		if hand := s.Hand[s.Turn]; len(hand) > 0 {
+			action = engine.Action{Type: engine.PlayCard, Player: s.Turn, CardID: hand[0].Instance}
+		}
+		next, _, err := engine.Apply(s, action)
+		if err != nil {
+			t.Fatalf("ação %d: %v", len(r.Actions), err)
+		}
+		s = next
+		r.Actions = append(r.Actions, action)
+	}
+	r.Result = s.Result
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	original := testReplay(t)
+
+	filename, err := original.Save(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := 0
+	s, err := loaded.Run(func(i int, action engine.Action, s engine.State, events []engine.Event) { steps++ })
+	if err != nil {
+		t.Fatalf("replay gravado não roda: %v", err)
+	}
+	if steps != len(original.Actions) || !sameResult(s.Result, original.Result) {
+		t.Errorf("%d de %d ações e resultado %+v, esperava %+v", steps, len(original.Actions), s.Result, original.Result)
+	}
+}
+
+func TestRunDetectsChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Replay)
+		err    error
+	}{
+		{"outra seed", func(r *Replay) { r.Seed++ }, ErrHands},
+		{"ação de quem não joga", func(r *Replay) { r.Actions[0].Player = map[string]string{"a": "b", "b": "a"}[r.Actions[0].Player] }, ErrRejected},
+		{"outro resultado", func(r *Replay) { r.Result = &engine.Result{Reason: engine.Forfeit, Winners: []string{"a"}} }, ErrResult},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := testReplay(t)
+			test.change(&r)
+			if _, err := r.Run(nil); !errors.Is(err, test.err) {
+				t.Errorf("esperava %v, veio %v", test.err, err)
+			}
+		})
+	}
+}
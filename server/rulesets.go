@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+)
+
+// maior partida (todos contra todos ou duas duplas)
+const maxPlayers = 4
+
+// boosters que todo jogador ganha no registro: o menor deck que alguém
+// deveria ter (se o estoque acabar no registro ele fica menor, por isso a
+// partida confere o deck de verdade em checkDeck)
+const (
+	starterBoosters = 4
+	minDeckSize     = starterBoosters * CARDS_PER_BOOSTER
+)
+
+// carrega os rulesets do arquivo de configuração
+func LoadRulesets(filename string) (RulesetConfig, error) {
+	var config RulesetConfig
+
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return config, fmt.Errorf("erro ao ler arquivo: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("erro ao deserializar JSON: %v", err)
+	}
+
+	var problems []error
+	for _, name := range slices.Sorted(maps.Keys(config.Rulesets)) {
+		ruleset := config.Rulesets[name]
+		ruleset.Name = name
+
+		if err := ruleset.Rules.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("ruleset %s: %v", name, err))
+		}
+		// a mão inicial (com as cartas da compensação) precisa deixar carta na
+		// pilha do menor deck, senão o jogo começa sem compra
+		if opening := ruleset.HandSize + ruleset.Compensation.Cards; opening >= minDeckSize {
+			problems = append(problems, fmt.Errorf("ruleset %s: handSize mais compensation.cards (%d) precisa ser menor que o menor deck (%d cartas)", name, opening, minDeckSize))
+		}
+		if ruleset.TurnTimeout <= 0 {
+			problems = append(problems, fmt.Errorf("ruleset %s: turnTimeout precisa ser positivo", name))
+		}
+		if ruleset.Mulligan && ruleset.MulliganTimeout <= 0 {
+			problems = append(problems, fmt.Errorf("ruleset %s: mulliganTimeout precisa ser positivo com mulligan", name))
+		}
+		if ruleset.Reactions && ruleset.ReactionTimeout <= 0 {
+			problems = append(problems, fmt.Errorf("ruleset %s: reactionTimeout precisa ser positivo com reactions", name))
+		}
+		if ruleset.MaxTimeouts < 0 {
+			problems = append(problems, fmt.Errorf("ruleset %s: maxTimeouts não pode ser negativo", name))
+		}
+		if ruleset.SpectatorDelay < 0 {
+			problems = append(problems, fmt.Errorf("ruleset %s: spectatorDelay não pode ser negativo", name))
+		}
+		if ruleset.RematchTimeout < 0 {
+			problems = append(problems, fmt.Errorf("ruleset %s: rematchTimeout não pode ser negativo", name))
+		}
+		if ruleset.Players != 0 && (ruleset.Players < 2 || ruleset.Players > maxPlayers) {
+			problems = append(problems, fmt.Errorf("ruleset %s: players precisa ser de 2 a %d", name, maxPlayers))
+		}
+		if ruleset.Teams && ruleset.Players != 4 {
+			problems = append(problems, fmt.Errorf("ruleset %s: teams só vale com 4 jogadores", name))
+		}
+
+		config.Rulesets[name] = ruleset
+	}
+
+	if _, exists := config.Rulesets[config.Default]; !exists {
+		problems = append(problems, fmt.Errorf("ruleset padrão %q não existe", config.Default))
+	}
+
+	return config, errors.Join(problems...)
+}
+
+// o deck do jogador precisa deixar pelo menos uma carta na pilha depois da
+// mão inicial (com a compensação), senão a partida começa sem compra
+// (só contam as cartas que entram na partida, ver deckCards)
+func (r Ruleset) checkDeck(p *User) error {
+	deck, err := pm.GetDeck(p.UID)
+	if err != nil {
+		return err
+	}
+	need := r.HandSize + r.Compensation.Cards + 1
+	if size := len(deckCards(deck, r.Reactions)); size < need {
+		return fmt.Errorf("%s tem %d cartas no deck e o ruleset %s precisa de pelo menos %d", p.Username, size, r.Name, need)
+	}
+	return nil
+}
+
+// jogadores por partida do ruleset
+func (r Ruleset) PlayerCount() int {
+	if r.Players == 0 {
+		return 2
+	}
+	return r.Players
+}
+
+// busca um ruleset pelo nome (vazio = padrão)
+func (config RulesetConfig) Get(name string) (Ruleset, error) {
+	if name == "" {
+		name = config.Default
+	}
+	ruleset, exists := config.Rulesets[name]
+	if !exists {
+		return Ruleset{}, fmt.Errorf("ruleset %s não existe", name)
+	}
+	return ruleset, nil
+}
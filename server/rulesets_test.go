@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// jogador registrado no pm com deckSize cartas (os testes do pacote usam os
+// globais pm e mm, então cada teste começa com eles novos)
+func testUser(t *testing.T, username string, deckSize int) *User {
+	t.Helper()
+	p, err := pm.CreatePlayer(username, "senha", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deck := make([]*Card, deckSize)
+	for i := range deck {
+		deck[i] = &Card{CID: fmt.Sprintf("T_%s_%02d", username, i), CardType: NREM, CardEffect: NEN, Points: 1}
+	}
+	pm.AddToDeck(p.UID, deck)
+	return p
+}
+
+func TestLoadRulesets(t *testing.T) {
+	config, err := LoadRulesets(rulesetsFile)
+	if err != nil {
+		t.Fatalf("rulesets do servidor inválidos: %v", err)
+	}
+
+	// o clássico continua com a regra original: pilha vazia na compra perde
+	classico, err := config.Get("classico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if classico.HandDeckOut {
+		t.Errorf("clássico com handDeckOut, esperava o deckOut original")
+	}
+}
+
+func TestCheckDeck(t *testing.T) {
+	pm = NewPlayerManager()
+	mm = NewMatchManager(1)
+
+	ruleset := Ruleset{Name: "teste"}
+	ruleset.HandSize = 10
+	ruleset.Compensation.Cards = 1
+
+	tests := []struct {
+		name     string
+		deckSize int
+		ok       bool
+	}{
+		{"deck do registro", minDeckSize, true},
+		{"sobra uma carta na pilha", 12, true},
+		{"pilha começaria vazia", 11, false},
+		{"estoque acabou no registro", 5, false},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := testUser(t, fmt.Sprintf("jogador%d", i), test.deckSize)
+
+			if err := ruleset.checkDeck(p); (err == nil) != test.ok {
+				t.Errorf("deck de %d cartas: checkDeck deu %v", test.deckSize, err)
+			}
+			if test.ok {
+				return
+			}
+			// nem o treino começa com o deck pequeno
+			if err := mm.StartPractice(p, ruleset, aiEasy); err == nil || !strings.Contains(err.Error(), "precisa de pelo menos") {
+				t.Errorf("treino com deck de %d cartas: esperava erro do deck, veio %v", test.deckSize, err)
+			}
+			if p.IsInBattle {
+				t.Errorf("jogador entrou em partida com deck de %d cartas", test.deckSize)
+			}
+		})
+	}
+}
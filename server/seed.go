@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"time"
+)
+
+// seed mestre: tudo que é sorteado no servidor (estoque de boosters, boosters
+// vendidos, mãos das partidas) sai dela, então a mesma SEED reproduz a execução
+// SEED=<número> fixa a seed; sem SEED uma é sorteada e aparece no log
+func loadMasterSeed() int64 {
+	if value := os.Getenv("SEED"); value != "" {
+		seed, error := strconv.ParseInt(value, 10, 64)
+		if error == nil {
+			return seed
+		}
+		fmt.Printf("SEED inválida (%s), sorteando uma\n", value)
+	}
+	return time.Now().UnixNano()
+}
+
+// deriva da seed mestre uma seed separada para cada uso
+// (assim, por exemplo, comprar mais boosters não muda as mãos das partidas)
+func deriveSeed(master int64, label string) int64 {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d/%s", master, label)
+	return int64(hash.Sum64())
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"pbl-redes/engine"
+)
+
+// séries: partidas seguidas entre os mesmos jogadores com um placar só
+// a série aberta (bestOf 0) é a de toda partida comum e só continua com
+// revanche; a melhor de N vem de um desafio, de uma partida privada ou de uma
+// fila com bestOf (só de dois)
+// e a próxima partida começa sozinha até alguém fazer a maioria. nos dois
+// casos quem começa vai rodando
+
+// maior série aceita (para um desafio não prender os dois a noite inteira)
+const maxBestOf = 9
+
+// pausa entre as partidas de uma melhor de N, para dar tempo de ler o resumo
+const seriesBreak = 5 * time.Second
+
+var ErrBestOf = fmt.Errorf("bestOf precisa ser ímpar, de 3 a %d (ou 0 para partida avulsa)", maxBestOf)
+
+var ErrBestOfPlayers = errors.New("melhor de N só vale em rulesets de dois jogadores")
+
+// confere o tamanho pedido num desafio ou partida privada
+func validBestOf(bestOf int, ruleset Ruleset) error {
+	if bestOf == 0 {
+		return nil
+	}
+	if ruleset.PlayerCount() > 2 {
+		return ErrBestOfPlayers
+	}
+	if bestOf >= 3 && bestOf <= maxBestOf && bestOf%2 == 1 {
+		return nil
+	}
+	return ErrBestOf
+}
+
+// série nova entre os jogadores (com mm.mu travado, por causa do ID)
+// ranked: vale rating (só as filas ranqueadas; desafio, partida privada e
+// treino não valem, senão dava para combinar resultado e inflar o Elo)
+func (mm *MatchManager) newSeries(players []*User, bestOf int, ranked bool) *Series {
+	mm.nextSeries++
+	wins := make(map[string]int, len(players))
+	for _, p := range players {
+		wins[p.UID] = 0
+	}
+	return &Series{ID: mm.nextSeries, BestOf: bestOf, Wins: wins, Ranked: ranked}
+}
+
+// soma o resultado da partida no placar e, numa melhor de N, vê se acabou:
+// acaba com alguém na maioria, com quem caiu da partida (perde a série) ou
+// depois de N partidas (os empates não contam para a maioria), ficando com
+// quem tiver mais vitórias
+func (s *Series) add(game engine.State) {
+	s.Games++
+	s.lastFirst = game.FirstPlayer
+	if len(game.Result.Winners) == 0 {
+		s.Ties++
+	}
+	for _, uid := range game.Result.Winners {
+		s.Wins[uid]++
+	}
+
+	if s.BestOf == 0 {
+		return
+	}
+	switch {
+	case game.Result.Reason == engine.Disconnect && len(game.Result.Winners) > 0:
+		s.finish(game.Result.Winners[0])
+	case s.Games >= s.BestOf:
+		s.finish(s.leader())
+	default:
+		for uid, wins := range s.Wins {
+			if wins > s.BestOf/2 {
+				s.finish(uid)
+			}
+		}
+	}
+}
+
+// quem tem mais vitórias (vazio se empatados)
+func (s *Series) leader() string {
+	leader, best, tied := "", -1, false
+	for uid, wins := range s.Wins {
+		switch {
+		case wins > best:
+			leader, best, tied = uid, wins, false
+		case wins == best:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return leader
+}
+
+func (s *Series) finish(winner string) {
+	s.Finished = true
+	s.Winner = winner
+}
+
+// quem começa a próxima partida: o seguinte, na ordem dos jogadores, de
+// quem começou a última (com dois, o outro)
+func (s *Series) nextFirst(players []*User) string {
+	i := slices.IndexFunc(players, func(p *User) bool { return p.UID == s.lastFirst })
+	return players[(i+1)%len(players)].UID
+}
+
+// registra o resultado da série inteira (uma vez só, no fim); o Elo só muda
+// se a série vale rating
+func (m *Match) recordSeries() map[string]int {
+	var winners []string
+	if m.series.Winner != "" {
+		winners = []string{m.series.Winner}
+	}
+	changes := m.recordRating(winners)
+	m.mu.Lock()
+	m.series.RatingChanges = changes
+	m.mu.Unlock()
+
+	p1, p2 := m.Players[0], m.Players[1]
+	fmt.Printf("Série %d terminou (%d partidas): %s %+d, %s %+d\n", m.series.ID, m.series.Games, p1.Username, changes[p1.UID], p2.Username, changes[p2.UID])
+	return changes
+}
+
+// pausa entre as partidas de uma melhor de N que ainda não acabou
+// devolve true se a próxima partida deve começar; quem desiste ou cai na
+// pausa perde a série inteira
+func (m *Match) runSeriesBreak() bool {
+	if m.series.Finished {
+		return false
+	}
+
+	timeout := time.After(seriesBreak)
+	for {
+		select {
+		case msg := <-m.inbox:
+			switch msg.Action {
+			case "giveup":
+				m.abandonSeries(msg.PlayerUID, closedGaveUp)
+				m.sendSeriesEnded(msg.PlayerUID, closedGaveUp)
+				return false
+			case "disconnect":
+				m.abandonSeries(msg.PlayerUID, closedOffline)
+				m.sendSeriesEnded(msg.PlayerUID, closedOffline)
+				return false
+			}
+
+		case <-timeout:
+			return true
+		}
+	}
+}
+
+// a série acaba com a vitória de quem ficou
+func (m *Match) abandonSeries(uid, reason string) {
+	winner := m.Players[0].UID
+	if winner == uid {
+		winner = m.Players[1].UID
+	}
+
+	m.mu.Lock()
+	m.series.finish(winner)
+	m.mu.Unlock()
+	m.recordSeries()
+
+	fmt.Printf("Série %d abandonada por %s (%s)\n", m.series.ID, m.username(uid), reason)
+}
+
+func (m *Match) sendSeriesEnded(uid, reason string) {
+	data, _ := json.Marshal(SeriesEnded{Series: m.series, Player: m.username(uid), Reason: reason})
+	m.toPlayers(Message{Request: seriesended, Data: data})
+}
+
+// série da próxima partida: a melhor de N continua a mesma; a revanche
+// continua o placar numa cópia que não vale rating (senão dois jogadores
+// podiam pedir revanche atrás de revanche para combinar resultado e mexer no
+// Elo, justamente o que desafio e partida privada já não deixam)
+func (s *Series) next() *Series {
+	if s.BestOf > 0 {
+		return s
+	}
+	rematch := *s
+	rematch.Wins = maps.Clone(s.Wins)
+	rematch.Ranked = false
+	rematch.RatingChanges = nil
+	return &rematch
+}
+
+// começa a próxima partida da série (revanche combinada ou melhor de N),
+// com mm.mu travado e prev já fora das partidas
+// se alguém caiu nesse meio tempo, a revanche não acontece e a melhor de N
+// acaba com a vitória de quem ficou
+func (mm *MatchManager) startNextGame(prev *Match) {
+	for _, p := range prev.Players {
+		if p.Connection != nil || p.IsBot {
+			continue
+		}
+		if prev.series.BestOf > 0 {
+			prev.abandonSeries(p.UID, closedOffline)
+		}
+		for _, other := range prev.Players {
+			switch {
+			case other == p:
+			case prev.series.BestOf > 0:
+				go notifyUser(other, seriesended, SeriesEnded{Series: prev.series, Player: p.Username, Reason: closedOffline})
+			default:
+				go notifyUser(other, rematchclosed, RematchInfo{Player: p.Username, Reason: closedOffline})
+			}
+		}
+		return
+	}
+
+	mm.startMatch(prev.Players, prev.Ruleset, prev.series.next())
+}
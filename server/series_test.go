@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"pbl-redes/engine"
+)
+
+// partida terminada entre os jogadores com os vencedores dados (nenhum = empate)
+func testFinishedMatch(players []*User, series *Series, first string, winners ...string) *Match {
+	return &Match{
+		Players: players,
+		series:  series,
+		game: engine.State{
+			Players:     []string{players[0].UID, players[1].UID},
+			FirstPlayer: first,
+			Finished:    true,
+			Result:      &engine.Result{Reason: engine.SanityZero, Winners: winners},
+		},
+	}
+}
+
+func TestScoreGame(t *testing.T) {
+	tests := []struct {
+		name    string
+		bestOf  int
+		ranked  bool
+		games   []string // vencedor de cada partida, em ordem ("" = empate)
+		changes []int    // Elo de a mudando em cada partida
+		rating  int      // rating final de a
+		wins    int      // vitórias de a nas estatísticas
+	}{
+		{
+			name:    "melhor de 3 ranqueada muda o Elo uma vez, no fim da série",
+			bestOf:  3,
+			ranked:  true,
+			games:   []string{"a", "b", "a"},
+			changes: []int{0, 0, 16},
+			rating:  1016,
+			wins:    1,
+		},
+		{
+			name:    "melhor de 3 sem rating só conta nas estatísticas",
+			bestOf:  3,
+			games:   []string{"a", "a"},
+			changes: []int{0, 0},
+			rating:  StartingRating,
+			wins:    1,
+		},
+		{
+			name:    "partidas avulsas ranqueadas contam uma a uma",
+			ranked:  true,
+			games:   []string{"a", "a"},
+			changes: []int{16, 15},
+			rating:  1031,
+			wins:    2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pm = NewPlayerManager()
+			mm = NewMatchManager(1)
+			a, b := testUser(t, "a", minDeckSize), testUser(t, "b", minDeckSize)
+			players := []*User{a, b}
+			uids := map[string]string{"a": a.UID, "b": b.UID}
+
+			series := mm.newSeries(players, test.bestOf, test.ranked)
+			for i, winner := range test.games {
+				var winners []string
+				if winner != "" {
+					winners = []string{uids[winner]}
+				}
+				changes := testFinishedMatch(players, series, players[i%2].UID, winners...).scoreGame()
+				if changes[a.UID] != test.changes[i] || changes[b.UID] != -test.changes[i] {
+					t.Errorf("partida %d: Elo mudou %+d e %+d, esperava %+d e %+d", i+1, changes[a.UID], changes[b.UID], test.changes[i], -test.changes[i])
+				}
+			}
+
+			if a.Rating != test.rating || a.Rating+b.Rating != 2*StartingRating {
+				t.Errorf("ratings %d e %d, esperava %d para a", a.Rating, b.Rating, test.rating)
+			}
+			if a.TotalWins != test.wins || b.TotalLosses != test.wins {
+				t.Errorf("a com %d vitórias e b com %d derrotas, esperava %d", a.TotalWins, b.TotalLosses, test.wins)
+			}
+		})
+	}
+}
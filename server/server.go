@@ -4,10 +4,27 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 )
 
+// diretório das coleções de cartas (relido quando o admin manda SIGHUP)
+const cardSetsDir string = "data/sets"
+
+// arquivo com os rulesets
+const rulesetsFile string = "data/rulesets.json"
+
+// arquivo com as filas de pareamento
+const queuesFile string = "data/queues.json"
+
+// diretório onde cada partida grava o replay quando termina
+const replaysDir string = "data/replays"
+
 var (
+	masterSeed int64
+	rulesets   RulesetConfig
+	queues     QueueConfig
 	vault      *CardVault
 	pm         *PlayerManager
 	mm         *MatchManager
@@ -16,11 +33,30 @@ var (
 )
 
 func main() {
+	// seed mestre, de onde saem as seeds do estoque e das partidas
+	masterSeed = loadMasterSeed()
+	fmt.Println("Seed mestre:", masterSeed)
+
+	// carrega os rulesets
+	var error error
+	rulesets, error = LoadRulesets(rulesetsFile)
+	if error != nil {
+		fmt.Println("Erro ao carregar rulesets") // debug
+		panic(error)
+	}
+
+	// carrega as filas (depois dos rulesets: uma fila pode ser de um ruleset só)
+	queues, error = LoadQueues(queuesFile, rulesets)
+	if error != nil {
+		fmt.Println("Erro ao carregar filas") // debug
+		panic(error)
+	}
+
 	// cria vault e mm
-	vault = NewCardVault()
-	mm = NewMatchManager()
+	vault = NewCardVault(deriveSeed(masterSeed, "vault"))
+	mm = NewMatchManager(deriveSeed(masterSeed, "matches"))
 
-	error := vault.LoadCardsFromFile("data/cardVault.json")
+	error = vault.LoadCardsFromDir(cardSetsDir)
 
 	// verifica se realmente criou o estoque
 	if error != nil {
@@ -28,8 +64,8 @@ func main() {
 		panic(error)
 	}
 
-	// cria os boosters, adicionando-o
-	error = vault.createBoosters(1000)
+	// cria os boosters de cada coleção, adicionando-os
+	error = vault.createBoosters(BOOSTERS_PER_SET)
 
 	// verifica se realmente criou os boosters
 	if error != nil {
@@ -42,10 +78,14 @@ func main() {
 
 	// começa goroutine para pareamento
 	go mm.matchmakingLoop()
+	go mm.queueStatusLoop() // posição na fila para quem espera
 
 	// info logs
 	go logServerStats() // printa a cada 2 seg
 
+	// recarga da base de cartas pelo admin (kill -HUP / docker kill -s HUP server)
+	go watchReloadSignal()
+
 	address := ":8080"          //porta usada
 	envVar := os.Getenv("PORT") // usa env para pode trocar a porta qndo preciso
 
@@ -94,3 +134,19 @@ func handlerPing() {
 		}
 	}
 }
+
+// espera por SIGHUP e recarrega a base de cartas
+// se o arquivo novo for inválido, a base antiga continua valendo
+func watchReloadSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		fmt.Println("Recarregando base de cartas...")
+		if error := vault.ReloadCardsFromDir(cardSetsDir); error != nil {
+			fmt.Printf("Recarga cancelada, base antiga mantida: %v\n", error)
+			continue
+		}
+		fmt.Println("Base de cartas recarregada")
+	}
+}
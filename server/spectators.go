@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"time"
+)
+
+// espectadores: conexões extras que recebem a partida com as mãos escondidas
+// e com o atraso do ruleset (spectatorDelay). tudo que a partida manda para
+// os dois jogadores e é público também vai para o feed, que entrega com atraso
+
+// quanto uma escrita para um espectador pode demorar antes de ele ser largado,
+// e quantas mensagens podem esperar a escrita dele
+const (
+	spectatorWriteTimeout = 5 * time.Second
+	spectatorBuffer       = 256
+)
+
+var (
+	ErrMatchNotFound = errors.New("partida não encontrada")
+	ErrPlayerWatch   = errors.New("quem está jogando não pode assistir")
+	ErrNotWatching   = errors.New("jogador não está assistindo nenhuma partida")
+)
+
+// coloca o usuário assistindo a partida matchID (ou a de username, se matchID for 0)
+// quem já assistia outra partida sai dela
+func (mm *MatchManager) Spectate(user *User, matchID int, username string) (*Match, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if _, playing := mm.byPlayer[user.UID]; playing {
+		return nil, ErrPlayerWatch
+	}
+
+	var match *Match
+	if matchID != 0 {
+		match = mm.matches[matchID]
+	} else {
+		for _, m := range mm.matches {
+			if slices.ContainsFunc(m.Players, func(p *User) bool { return p.Username == username }) {
+				match = m
+				break
+			}
+		}
+	}
+	if match == nil {
+		return nil, ErrMatchNotFound
+	}
+
+	mm.stopWatching(user.UID)
+	mm.watching[user.UID] = match
+	match.addSpectator(user)
+
+	fmt.Printf("%s assistindo a partida %d\n", user.Username, match.ID)
+	return match, nil
+}
+
+// tira o usuário da partida que ele assiste
+func (mm *MatchManager) StopSpectating(uid string) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if !mm.stopWatching(uid) {
+		return ErrNotWatching
+	}
+	return nil
+}
+
+// igual ao StopSpectating, com mm.mu já travado
+func (mm *MatchManager) stopWatching(uid string) bool {
+	match, ok := mm.watching[uid]
+	if !ok {
+		return false
+	}
+	delete(mm.watching, uid)
+
+	match.mu.Lock()
+	match.removeSpectator(uid)
+	match.mu.Unlock()
+	return true
+}
+
+// espectador novo, já com a goroutine que escreve para ele
+func newSpectator(user *User) *spectator {
+	s := &spectator{user: user, out: make(chan Message, spectatorBuffer)}
+	go s.write(user.Connection)
+	return s
+}
+
+// escreve o que chega em out até ele deixar de assistir; depois de um erro
+// só esvazia o canal (o feed vê o failed e larga ele)
+func (s *spectator) write(connection net.Conn) {
+	if connection == nil {
+		s.failed.Store(true)
+	}
+	encoder := json.NewEncoder(connection)
+	for msg := range s.out {
+		if s.failed.Load() {
+			continue
+		}
+		s.writing.Store(time.Now().UnixNano())
+		if err := encoder.Encode(msg); err != nil {
+			s.failed.Store(true)
+		}
+		s.writing.Store(0)
+	}
+}
+
+// passa a mensagem para a goroutine do espectador sem esperar; false se
+// ele travou (escrita parada há mais de spectatorWriteTimeout, fila cheia
+// ou conexão com erro)
+func (s *spectator) send(msg Message) bool {
+	if s.failed.Load() {
+		return false
+	}
+	if since := s.writing.Load(); since != 0 && time.Since(time.Unix(0, since)) > spectatorWriteTimeout {
+		return false
+	}
+	select {
+	case s.out <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// tira o espectador da lista e para a goroutine dele (com m.mu travado)
+func (m *Match) removeSpectator(uid string) {
+	if s, ok := m.spectators[uid]; ok {
+		close(s.out)
+		delete(m.spectators, uid)
+	}
+}
+
+// tira da partida o espectador que parou de receber (se ele ainda assiste ela)
+func (m *Match) dropSpectator(uid string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if mm.watching[uid] == m {
+		mm.stopWatching(uid)
+	}
+}
+
+// entra na lista e recebe o gameStart com o estado de agora
+// (pelo feed, para chegar depois do atraso e antes do que vier a seguir)
+func (m *Match) addSpectator(user *User) {
+	m.feedMu.Lock()
+	defer m.feedMu.Unlock()
+
+	m.mu.Lock()
+	m.spectators[user.UID] = newSpectator(user)
+	start := Message{Request: gamestart, Data: m.gameStartFor("")}
+	m.mu.Unlock()
+
+	m.pushFeed(spectatorMsg{msg: start, at: time.Now(), to: []string{user.UID}})
+}
+
+// manda uma mensagem para quem está assistindo agora
+func (m *Match) toSpectators(msg Message) {
+	m.feedMu.Lock()
+	defer m.feedMu.Unlock()
+
+	m.mu.Lock()
+	to := slices.Collect(maps.Keys(m.spectators))
+	m.mu.Unlock()
+
+	if len(to) == 0 {
+		return
+	}
+	m.pushFeed(spectatorMsg{msg: msg, at: time.Now(), to: to})
+}
+
+// põe no fim do feed sem nunca esperar (com feedMu travado): quem põe pode
+// estar com o mm.mu ou ser a goroutine da partida, e o runFeed passa o
+// atraso dormindo, então um canal com limite podia encher e travar os dois
+func (m *Match) pushFeed(item spectatorMsg) {
+	m.feed = append(m.feed, item)
+	m.wakeFeed()
+}
+
+// a partida acabou: o feed entrega o que falta e para
+func (m *Match) closeFeed() {
+	m.feedMu.Lock()
+	m.feedDone = true
+	m.feedMu.Unlock()
+	m.wakeFeed()
+}
+
+func (m *Match) wakeFeed() {
+	select {
+	case m.feedWake <- struct{}{}:
+	default:
+	}
+}
+
+// próxima mensagem do feed, esperando se ele está vazio; false quando a
+// partida acabou e não sobrou nada
+func (m *Match) nextFeed() (spectatorMsg, bool) {
+	for {
+		m.feedMu.Lock()
+		if len(m.feed) > 0 {
+			item := m.feed[0]
+			m.feed = m.feed[1:]
+			m.feedMu.Unlock()
+			return item, true
+		}
+		done := m.feedDone
+		m.feedMu.Unlock()
+
+		if done {
+			return spectatorMsg{}, false
+		}
+		<-m.feedWake
+	}
+}
+
+// entrega o feed com o atraso do ruleset até a partida acabar
+// quem saiu no meio do atraso não recebe mais nada
+// ninguém espera por espectador: o feed não tem limite e cada espectador tem
+// a própria goroutine de escrita; quem trava (ver spectator.send) deixa de
+// assistir
+func (m *Match) runFeed() {
+	delay := time.Duration(m.Ruleset.SpectatorDelay) * time.Second
+
+	for {
+		item, ok := m.nextFeed()
+		if !ok {
+			break
+		}
+		time.Sleep(time.Until(item.at.Add(delay)))
+
+		var dropped []*User
+		m.mu.Lock()
+		for _, uid := range item.to {
+			if s, ok := m.spectators[uid]; ok && !s.send(item.msg) {
+				dropped = append(dropped, s.user)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, user := range dropped {
+			fmt.Printf("espectador %s largado da partida %d: parou de receber\n", user.Username, m.ID)
+			m.dropSpectator(user.UID)
+		}
+	}
+
+	// a partida acabou e o resumo já foi entregue: solta os espectadores
+	mm.mu.Lock()
+	m.mu.Lock()
+	for uid := range m.spectators {
+		if mm.watching[uid] == m {
+			delete(mm.watching, uid)
+		}
+		m.removeSpectator(uid)
+	}
+	m.mu.Unlock()
+	mm.mu.Unlock()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+// partida registrada no mm com o feed rodando e um espectador conectado por
+// um net.Pipe; devolve a ponta do cliente do espectador
+func testSpectatedMatch(t *testing.T, delay int) (*Match, *User, net.Conn) {
+	t.Helper()
+	pm = NewPlayerManager()
+	mm = NewMatchManager(1)
+
+	a, b := testUser(t, "a", minDeckSize), testUser(t, "b", minDeckSize)
+	m := &Match{
+		ID:         1,
+		Players:    []*User{a, b},
+		Ruleset:    Ruleset{Name: "teste", SpectatorDelay: delay},
+		series:     mm.newSeries([]*User{a, b}, 0, false),
+		spectators: make(map[string]*spectator),
+		feedWake:   make(chan struct{}, 1),
+	}
+	mm.matches[m.ID] = m
+	go m.runFeed()
+
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	watcher := testUser(t, "espectador", 0)
+	watcher.Connection = server
+	if _, err := mm.Spectate(watcher, m.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	return m, watcher, client
+}
+
+func TestSpectatorDelay(t *testing.T) {
+	m, _, client := testSpectatedMatch(t, 1)
+	started := time.Now()
+	m.toSpectators(Message{Request: notify, Data: json.RawMessage(`"oi"`)})
+
+	decoder := json.NewDecoder(client)
+	for _, want := range []string{gamestart, notify} {
+		var msg Message
+		if err := decoder.Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Request != want {
+			t.Fatalf("espectador recebeu %s, esperava %s", msg.Request, want)
+		}
+	}
+	if waited := time.Since(started); waited < time.Second {
+		t.Errorf("a mensagem chegou em %v, antes do spectatorDelay de 1s", waited)
+	}
+}
+
+// com um atraso longo o feed fica cheio de mensagens esperando; quem põe
+// nele (a partida, ou o Spectate com o mm.mu) não pode esperar por isso
+func TestSpectatorFeedDoesNotBlock(t *testing.T) {
+	m, _, _ := testSpectatedMatch(t, 3600)
+
+	late := testUser(t, "atrasado", 0)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5000; i++ {
+			m.toSpectators(Message{Request: notify})
+		}
+		// e o mm.mu continua livre para os outros
+		mm.Spectate(late, m.ID, "")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("toSpectators travou com o feed cheio")
+	}
+}
+
+// espectador que não lê a conexão: a fila dele enche e ele deixa de
+// assistir, sem segurar a partida
+func TestStuckSpectatorIsDropped(t *testing.T) {
+	m, watcher, _ := testSpectatedMatch(t, 0)
+
+	for i := 0; i < spectatorBuffer+10; i++ {
+		m.toSpectators(Message{Request: notify})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mm.mu.Lock()
+		_, watching := mm.watching[watcher.UID]
+		mm.mu.Unlock()
+		if !watching {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("espectador travado continua assistindo")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.spectators) != 0 {
+		t.Errorf("partida ainda com %d espectadores", len(m.spectators))
+	}
+}
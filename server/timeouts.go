@@ -0,0 +1,15 @@
+package main
+
+import "pbl-redes/engine"
+
+// turno perdido por tempo: o jogador perde a vez, e com maxTimeouts no
+// ruleset quem estoura o tempo essa quantidade de vezes seguidas perde a
+// partida (jogar uma carta ou acabar o turno zera a contagem)
+func (m *Match) timeOut(uid string) {
+	m.timeouts[uid]++
+	if m.Ruleset.MaxTimeouts > 0 && m.timeouts[uid] >= m.Ruleset.MaxTimeouts {
+		m.apply(engine.Action{Type: engine.GiveUp, Player: uid, Reason: string(engine.Timeout)})
+		return
+	}
+	m.apply(engine.Action{Type: engine.SkipTurn, Player: uid, Reason: engine.SkipTimeout})
+}
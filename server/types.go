@@ -5,7 +5,12 @@ import (
 	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"pbl-redes/cards"
+	"pbl-redes/engine"
+	"pbl-redes/replay"
 )
 
 // mensagem padrão para conversa cliente-servidor
@@ -24,34 +29,85 @@ type PlayerResponse struct {
 /* REQUESTS POSSÍVEIS
 register: registra novo usuário
 login: faz login em conta
-buyNewPack: compra pacote novo de cartas
-battle: coloca usuário na fila
+buyNewPack: compra pacote novo de cartas (opcionalmente de uma coleção)
+getInventory: lista as cartas do jogador e as coleções
+battle: coloca usuário na fila (opcionalmente de um ruleset)
 useCard: usa carta
 giveUp: desiste da batalha
+mulligan: devolve cartas da mão inicial para a pilha e compra de novo
+react: responde à carta do oponente com uma reação (sem carta = passa)
+endTurn: acaba o turno (rulesets com lucidez, onde dá para jogar várias cartas)
+getReplay: lista os últimos replays do jogador ou baixa um deles
+spectate: assiste uma partida em andamento (pelo ID ou pelo nome de um jogador)
+leaveSpectate: para de assistir
+challenge: desafia um jogador online pelo nome (opcionalmente com um ruleset)
+answerChallenge: aceita ou recusa um desafio recebido
+createLobby: abre uma partida privada e devolve o código para compartilhar
+joinLobby: entra na partida privada pelo código
+closeLobby: fecha a partida privada aberta
+practice: treino contra bots do servidor (nível facil, medio ou dificil), fora do rating
 ping: manda ping
 */
 
 const (
-	register string = "register"
-	login    string = "login"
-	buypack  string = "buyNewPack"
-	battle   string = "battle"
-	usecard  string = "useCard"
-	giveup   string = "giveUp"
-	ping     string = "ping"
+	register   string = "register"
+	login      string = "login"
+	buypack    string = "buyNewPack"
+	getinv     string = "getInventory"
+	battle     string = "battle"
+	usecard    string = "useCard"
+	giveup     string = "giveUp"
+	mulligan   string = "mulligan"
+	react      string = "react"
+	endturn    string = "endTurn"
+	getreplay  string = "getReplay"
+	spectate   string = "spectate"
+	leavespec  string = "leaveSpectate"
+	challenge  string = "challenge"
+	answerch   string = "answerChallenge"
+	newlobby   string = "createLobby"
+	joinlobby  string = "joinLobby"
+	endlobby   string = "closeLobby"
+	rematch    string = "rematch"
+	leavequeue string = "leaveQueue"
+	practice   string = "practice"
+	ping       string = "ping"
 
 	registered string = "registered"
 	loggedin   string = "loggedIn"
 	packbought string = "packBought"
+	inventory  string = "inventory"
 	enqueued   string = "enqueued"
 	gamestart  string = "gameStart"
-	cardused   string = "cardUsed"
+	cardused   string = "cardUsed" // carta resolvida, com tudo o que ela causou
 	notify     string = "notify"
 	updateinfo string = "updateInfo"
 	newturn    string = "newTurn"
 	newloss    string = "newLoss"
 	newvictory string = "newVictory"
 	newtie     string = "newTie"
+
+	mulliganresult string = "mulliganResult"
+	reactionwindow string = "reactionWindow"    // abriu a janela de reação (só para quem defende)
+	reactionclosed string = "reactionClosed"    // fechou a janela de reação (só para quem defende)
+	gameevent      string = "gameEvent"         // evento da engine fora de uma carta (estados, compras, fim da partida...)
+	replaylist     string = "replayList"        // últimos replays do jogador
+	replayfile     string = "replay"            // replay completo de uma partida
+	spectating     string = "spectating"        // entrou como espectador (o gameStart chega depois do atraso)
+	spectateleft   string = "spectateLeft"      // saiu da partida que assistia
+	matchended     string = "matchEnded"        // resumo do fim da partida, para os espectadores
+	challengesent  string = "challengeSent"     // desafio enviado (para quem desafiou)
+	challengerecv  string = "challengeReceived" // desafio chegou (para o desafiado)
+	challengeclose string = "challengeClosed"   // desafio acabou sem partida (para os dois)
+	lobbycreated   string = "lobbyCreated"      // código da partida privada
+	lobbyclosed    string = "lobbyClosed"       // partida privada fechada sem partida
+	lobbyjoined    string = "lobbyJoined"       // alguém entrou na partida privada que ainda espera gente
+	rematchoffer   string = "rematchOffer"      // fim da partida: dá para pedir revanche (para os dois)
+	rematchaccept  string = "rematchAccepted"   // um dos dois aceitou a revanche
+	rematchclosed  string = "rematchClosed"     // revanche não vai acontecer
+	seriesended    string = "seriesEnded"       // melhor de N abandonada entre duas partidas
+	queuestatus    string = "queueStatus"       // posição na fila, mandada de tempos em tempos
+	queueleft      string = "queueLeft"         // saiu da fila sem partida
 )
 
 // registro do usuário (dado persistente)
@@ -64,7 +120,12 @@ type User struct {
 	LastLogin   time.Time `json:"last_login"`
 	TotalWins   int       `json:"total_wins"`
 	TotalLosses int       `json:"total_losses"`
+	TotalTies   int       `json:"total_ties"`
+	Rating      int       `json:"rating"`  // Elo, começa em StartingRating
+	Replays     []string  `json:"replays"` // IDs dos últimos replays, o mais recente por último
 	IsInBattle  bool
+	IsBot       bool   // jogador do servidor, sem conexão (ver ai.go)
+	BotLevel    string // nível do bot (ver aiLevels.go)
 	Connection  net.Conn
 }
 
@@ -95,70 +156,111 @@ type PlayerManager struct {
 }
 
 // sobre as cartas
-type CardType string
-
-const (
-	REM  CardType = "rem"
-	NREM CardType = "nrem"
-	Pill CardType = "pill"
+// os tipos das cartas e das coleções ficam no pacote cards,
+// que é compartilhado com o cardtool (server/cmd/cardtool)
+type (
+	Card         = cards.Card
+	CardType     = cards.CardType
+	CardRarity   = cards.CardRarity
+	CardEffect   = cards.CardEffect
+	CardSet      = cards.CardSet
+	CardDatabase = cards.CardDatabase
 )
 
-type CardRarity string
-
 const (
-	Comum   CardRarity = "comum"
-	Incomum CardRarity = "incomum"
-	Rara    CardRarity = "rara"
-)
+	REM  = cards.REM
+	NREM = cards.NREM
+	Pill = cards.Pill
 
-type CardEffect string
+	Reaction = cards.Reaction
 
-const (
-	AD   CardEffect = "adormecido"
-	CONS CardEffect = "consciente"
-	PAR  CardEffect = "paralisado"
-	AS   CardEffect = "assustado"
-	NEN  CardEffect = "nenhum"
-)
+	Comum   = cards.Comum
+	Incomum = cards.Incomum
+	Rara    = cards.Rara
 
-type DreamState string
-
-const (
-	sleepy    DreamState = "adormecido"
-	conscious DreamState = "consciente"
-	paralyzed DreamState = "paralisado"
-	scared    DreamState = "assustado"
+	AD   = cards.AD
+	CONS = cards.CONS
+	PAR  = cards.PAR
+	AS   = cards.AS
+	NEN  = cards.NEN
 )
 
-type Card struct {
-	Name       string     `json:"name"`
-	CID        string     `json:"CID"`  // card ID
-	Desc       string     `json:"desc"` // descrição
-	CardType   CardType   `json:"cardtype"`
-	CardRarity CardRarity `json:"cardrarity"`
-	CardEffect CardEffect `json:"cardeffect"`
-	Points     int        `json:"points"`
-}
-
 type Booster struct {
 	BID     int
+	Set     string // coleção de onde saíram as cartas
 	Booster []Card
 }
 
 // BANCO DE CARTAS
 type CardVault struct {
-	CardGlossary map[string]Card
+	Sets         map[string]CardSet // coleções por código
+	CardGlossary map[string]Card    // cartas de todas as coleções
 	CardQuantity map[string]int
 
 	Vault           map[int]Booster
 	BoosterQuantity int
 	Total           int
 	Generator       *rand.Rand
+	nextBID         int
+
+	mu sync.Mutex // protege o estoque e o glossário (recarga a quente)
+}
+
+// REGRAS
+// conjunto de regras com nome, escolhido por fila ou por partida
+type Ruleset struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	engine.Rules
+	TurnTimeout     int  `json:"turnTimeout"`               // segundos para jogar antes de perder o turno
+	MulliganTimeout int  `json:"mulliganTimeout,omitempty"` // segundos para escolher o mulligan
+	ReactionTimeout int  `json:"reactionTimeout,omitempty"` // segundos da janela de reação
+	MaxTimeouts     int  `json:"maxTimeouts,omitempty"`     // turnos seguidos perdidos por tempo até perder a partida (0 = nunca)
+	SpectatorDelay  int  `json:"spectatorDelay,omitempty"`  // segundos de atraso do que os espectadores recebem
+	RematchTimeout  int  `json:"rematchTimeout,omitempty"`  // segundos para os dois aceitarem a revanche (0 = sem revanche)
+	Players         int  `json:"players,omitempty"`         // jogadores por partida (0 = 2)
+	Teams           bool `json:"teams,omitempty"`           // em duplas (só com 4 jogadores); sem isso é todos contra todos
 }
 
-// struct pra base de dados local das cartas em json porem virtualizada
-type CardDatabase struct {
-	Cards map[string]Card `json:"cards"`
+// arquivo data/rulesets.json
+type RulesetConfig struct {
+	Default  string             `json:"default"`
+	Rulesets map[string]Ruleset `json:"rulesets"`
+}
+
+// fila com nome: como ela pareia e se a partida vale rating
+type Queue struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Policy       string `json:"policy"`                 // fifo (ordem de chegada) ou rating (rating parecido)
+	Ranked       bool   `json:"ranked,omitempty"`       // a partida muda o Elo
+	Ruleset      string `json:"ruleset,omitempty"`      // fila de um ruleset só (vazio = o jogador escolhe)
+	BestOf       int    `json:"bestOf,omitempty"`       // cada partida da fila é uma melhor de N (0 = partida avulsa)
+	RatingWindow int    `json:"ratingWindow,omitempty"` // diferença de rating aceita logo de cara (política rating)
+	RatingGrowth int    `json:"ratingGrowth,omitempty"` // quanto a diferença aceita cresce por segundo de espera
+	BotAfter     int    `json:"botAfter,omitempty"`     // segundos de espera até completar a partida com bots (0 = nunca)
+	BotLevel     string `json:"botLevel,omitempty"`     // nível desses bots (vazio = o padrão)
+}
+
+// arquivo data/queues.json
+type QueueConfig struct {
+	Default string           `json:"default"`
+	Queues  map[string]Queue `json:"queues"`
+}
+
+// quem espera numa fila
+type queueEntry struct {
+	user  *User
+	since time.Time
+}
+
+// linha de espera: quem escolheu a mesma fila e o mesmo ruleset, por ordem
+// de chegada
+type waitLine struct {
+	Queue   Queue
+	Ruleset Ruleset
+	policy  pairingPolicy
+	entries []*queueEntry
 }
 
 // SISTEMA DE MATCHMAKING
@@ -178,28 +280,223 @@ const (
 )
 
 type Match struct {
-	ID     int
-	P1, P2 *User
-	State  MatchState
-	Turn   string // ID do jogador que joga a próxima ação
-
-	Hand             map[string][]*Card // 10 cartas por jogador
-	Sanity           map[string]int     // pontos por jogador
-	DreamStates      map[string]DreamState
-	RoundsInState    map[string]int // para controlar duração dos estados
-	StateLockedUntil map[string]int // para controlar quando pode mudar estado
-	currentRound     int
+	ID      int
+	Players []*User        // na ordem passada para a engine (em duplas, os times se alternam)
+	Teams   map[string]int // time de cada jogador (nil = todos contra todos)
+	State   MatchState
+	Seed    int64   // tudo que é sorteado na partida sai daqui (fica no log)
+	Ruleset Ruleset // regras da partida
+
+	game engine.State // mãos, sanidade, estados, turno e rodada (regras na engine)
+
+	stacked  *CardUsed                 // carta esperando a janela de reação (o cardUsed sai quando ela resolver)
+	stats    map[string]*PlayerSummary // números de cada jogador para o resumo do fim
+	timeouts map[string]int            // turnos seguidos que cada um perdeu por tempo
+	record   replay.Replay             // seed, decks e ações aceitas, gravado no fim
+	first    string                    // quem começa sem cara ou coroa (revanche)
+	series   *Series                   // placar das revanches entre os dois (protegido por mu)
+
+	spectators map[string]*spectator // espectadores por UID (protegido por mu)
+	feed       []spectatorMsg        // mensagens para os espectadores, entregues com atraso (protegido por feedMu)
+	feedDone   bool                  // a partida acabou: o feed entrega o que falta e para (protegido por feedMu)
+	feedWake   chan struct{}         // avisa o runFeed que o feed mudou
+	feedMu     sync.Mutex            // mantém a ordem de quem põe mensagens no feed
+
+	encoders map[string]*json.Encoder // conexão de cada jogador (só a goroutine da partida usa)
 
 	inbox chan matchMsg // canal para trocar msgs entre threads
-	mu    sync.Mutex
+	mu    sync.Mutex    // protege game e series (lidos por quem entra assistindo) e spectators
+}
+
+// lugar de um bot numa partida: recebe o que a partida manda para ele (no
+// lugar da conexão) e responde pelo inbox
+type aiSeat struct {
+	user  *User
+	match *Match
+	mu    sync.Mutex // protege rng (cada resposta pensa numa goroutine)
+	rng   *rand.Rand
+}
+
+// quem assiste uma partida: a escrita na conexão sai numa goroutine só dele,
+// para um espectador travado não segurar o feed; o prazo da escrita é medido
+// aqui, sem mexer no deadline da conexão (que os handlers também usam)
+type spectator struct {
+	user    *User
+	out     chan Message // fechado quando ele deixa de assistir (com o mu da partida)
+	writing atomic.Int64 // quando a escrita de agora começou (UnixNano; 0 = parado)
+	failed  atomic.Bool  // a conexão deu erro
+}
+
+// mensagem esperando o atraso dos espectadores
+// to é quem assistia quando ela foi gerada (quem entra depois recebe o gameStart antes)
+type spectatorMsg struct {
+	msg Message
+	at  time.Time
+	to  []string
+}
+
+// payload do cardUsed: a carta e o que ela causou até terminar de resolver
+type CardUsed struct {
+	Player       string         `json:"player"`
+	Card         Card           `json:"card"` // com a instância da carta na partida
+	Target       string         `json:"target"`
+	Reaction     bool           `json:"reaction,omitempty"` // jogada na janela de reação
+	SanityDeltas map[string]int `json:"sanityDeltas"`
+	StateChanges []StateChange  `json:"stateChanges"`
+	Events       []engine.Event `json:"events"` // o resto: compras, descartes, imunidade, cancelamento, reflexo
+	Round        int            `json:"round"`  // rodada depois da jogada
+}
+
+type StateChange struct {
+	Player string            `json:"player"`
+	State  engine.DreamState `json:"state"`
+}
+
+// resumo da partida, enviado no newVictory/newLoss/newTie
+type MatchSummary struct {
+	Reason  engine.EndReason          `json:"reason"`
+	Winners []string                  `json:"winners"` // vazio = empate
+	Rounds  int                       `json:"rounds"`
+	Ruleset string                    `json:"ruleset"`
+	Replay  string                    `json:"replay,omitempty"` // ID para pedir com getReplay (vazio se não gravou)
+	Series  *Series                   `json:"series"`           // placar contando esta partida
+	Players map[string]*PlayerSummary `json:"players"`
+}
+
+// placar de uma série entre os mesmos dois jogadores: revanches (bestOf 0)
+// ou melhor de N, que acaba quando alguém faz a maioria
+type Series struct {
+	ID            int            `json:"id"`
+	BestOf        int            `json:"bestOf,omitempty"` // 0 = série aberta, só de revanches
+	Games         int            `json:"games"`            // partidas já terminadas
+	Wins          map[string]int `json:"wins"`             // vitórias por UID
+	Ties          int            `json:"ties"`
+	Finished      bool           `json:"finished,omitempty"`      // só nas melhor de N
+	Winner        string         `json:"winner,omitempty"`        // vazio com finished = empate
+	RatingChanges map[string]int `json:"ratingChanges,omitempty"` // a série inteira conta como um resultado só
+	Ranked        bool           `json:"ranked"`                  // vale rating (a fila casual não vale)
+	Practice      bool           `json:"practice,omitempty"`      // treino contra bot
+
+	lastFirst string // quem começou a última partida (a próxima começa com o seguinte)
+}
+
+// payload do seriesEnded: série abandonada entre duas partidas
+type SeriesEnded struct {
+	Series *Series `json:"series"`
+	Player string  `json:"player"` // quem saiu
+	Reason string  `json:"reason"`
+}
+
+// payload do rematchOffer / rematchAccepted / rematchClosed
+type RematchInfo struct {
+	Timeout int     `json:"timeout,omitempty"` // segundos para aceitar
+	Player  string  `json:"player,omitempty"`  // quem aceitou / recusou
+	Reason  string  `json:"reason,omitempty"`  // motivo do rematchClosed
+	Series  *Series `json:"series,omitempty"`
+}
+
+// como cada jogador terminou a partida
+type PlayerSummary struct {
+	Username     string            `json:"username"`
+	Sanity       int               `json:"sanity"`
+	DreamState   engine.DreamState `json:"dreamState"`
+	CardsPlayed  []Card            `json:"cardsPlayed"` // na ordem, com as reações
+	DamageDealt  int               `json:"damageDealt"` // sanidade que as cartas dele tiraram do oponente
+	DamageTaken  int               `json:"damageTaken"` // sanidade perdida (cartas e estados)
+	Healed       int               `json:"healed"`      // sanidade recuperada (cartas e estados)
+	Rating       int               `json:"rating"`      // depois da partida
+	RatingChange int               `json:"ratingChange"`
+	Bot          bool              `json:"bot,omitempty"` // jogador do servidor (partida fora das estatísticas)
+}
+
+// item do replayList (o replay inteiro sai com getReplay + id)
+type ReplayInfo struct {
+	ID      string          `json:"id"`
+	Ruleset string          `json:"ruleset"`
+	Players []replay.Player `json:"players"`
+	Result  *engine.Result  `json:"result"`
+	Actions int             `json:"actions"`
+	Started time.Time       `json:"started"`
 }
 
 type MatchManager struct {
 	mu       sync.Mutex
-	queue    []*User
+	lines    map[string]*waitLine     // quem espera, por fila e ruleset
+	waits    map[string]time.Duration // média das últimas esperas até a partida, por linha
+	wake     chan struct{}            // acorda o pareamento
 	nextID   int
 	matches  map[int]*Match
 	byPlayer map[string]*Match
+	watching map[string]*Match // partida que cada espectador assiste
+
+	nextChallenge int
+	nextSeries    int
+	nextBot       int
+	challenges    map[int]*Challenge // desafios esperando resposta
+	lobbies       map[string]*Lobby  // partidas privadas por código
+	seeds         *rand.Rand         // sorteia a seed de cada partida
+
+	firstPlayer map[string]*FirstPlayerStats // resultados de quem começa, por ruleset
+}
+
+// desafio de um jogador para outro, esperando o aceite
+type Challenge struct {
+	ID      int
+	From    *User
+	To      *User
+	Ruleset Ruleset
+	BestOf  int         // 0 = partida avulsa
+	timer   *time.Timer // expira o desafio
+}
+
+// partida privada esperando alguém entrar com o código
+type Lobby struct {
+	Code    string
+	Host    *User
+	Guests  []*User // quem já entrou, esperando a partida encher
+	Ruleset Ruleset
+	BestOf  int // 0 = partida avulsa
+}
+
+// dados de um desafio nas mensagens
+type ChallengeInfo struct {
+	ID      int    `json:"id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Ruleset string `json:"ruleset"`
+	BestOf  int    `json:"bestOf,omitempty"`
+	Timeout int    `json:"timeout"`          // segundos para responder
+	Reason  string `json:"reason,omitempty"` // só no challengeClosed
+}
+
+// dados de uma partida privada nas mensagens
+type LobbyInfo struct {
+	Code    string   `json:"code"`
+	Host    string   `json:"host"`
+	Ruleset string   `json:"ruleset"`
+	BestOf  int      `json:"bestOf,omitempty"`
+	Players []string `json:"players,omitempty"` // quem já está na partida, com o host (rulesets de mais de dois)
+	Needed  int      `json:"needed,omitempty"`  // quantos faltam para começar
+	Reason  string   `json:"reason,omitempty"`  // só no lobbyClosed
+}
+
+// lugar de um jogador na fila nas mensagens (enqueued, queueStatus e queueLeft)
+type QueueInfo struct {
+	Queue    string `json:"queue"`
+	Ruleset  string `json:"ruleset"`
+	Position int    `json:"position"` // 1 = o próximo a ser pareado
+	Size     int    `json:"size"`     // quantos estão na fila
+	Needed   int    `json:"needed"`   // jogadores por partida no ruleset
+	Waited   int    `json:"waited"`   // segundos na fila
+	Estimate int    `json:"estimate"` // segundos que ainda faltam pela média das últimas esperas (-1 = sem média ainda)
+}
+
+// resultados de quem começa a partida, para ver o equilíbrio de um ruleset
+type FirstPlayerStats struct {
+	Games  int
+	Wins   int // quem começou venceu
+	Losses int // quem começou perdeu
+	Ties   int
 }
 
 // SISTEMA DE BATALHAS